@@ -1,38 +1,111 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/logging"
+	"github.com/ehpalumbo/go-diff/metrics"
+	"github.com/ehpalumbo/go-diff/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
-// DiffService provides access to the service layer operations
+// DiffService provides access to the service layer operations.
+// Operations run within the context of the request, so they are cancelled when the client goes away.
 type DiffService interface {
-	Save(domain.DiffPayload) error
-	GetDiffReport(string) (domain.DiffReport, error)
+	Save(context.Context, domain.DiffPayload) error
+	GetDiffReport(context.Context, string) (domain.DiffReport, error)
+	GetVersionedDiffReport(context.Context, string, int, int) (domain.DiffReport, error)
+	ListVersions(context.Context, string, domain.DiffSide) ([]domain.SideVersion, error)
+	GetSide(context.Context, string, domain.DiffSide) ([]byte, domain.SideMetadata, error)
+	GetMetadata(context.Context, string) (map[domain.DiffSide]domain.SideMetadata, error)
+	Delete(context.Context, string) error
+	DeleteSide(context.Context, string, domain.DiffSide) error
+	ListDiffs(context.Context, domain.DiffListQuery) (domain.DiffPage, error)
+	CreateSession(context.Context, bool) (domain.DiffSession, error)
+	GetSession(context.Context, string) (domain.DiffSession, error)
 }
 
 // Application is the entry point for starting this API
 type Application struct {
-	service DiffService
+	services      Services
+	authenticator Authenticator
+	uploadLimiter RateLimiter
+	reportLimiter RateLimiter
+	limits        domain.SizeLimits
+	healthChecks  map[string]HealthCheck
+	requests      *metrics.Histogram
+	tracer        *tracing.Tracer
+	logger        *logging.Logger
 }
 
-// NewApplication creates a new Application with the provided service dependency
+// NewApplication creates a new single-tenant Application with the provided service dependency.
+// Requests on behalf of any tenant other than the default one are rejected.
 func NewApplication(s DiffService) Application {
-	return Application{s}
+	return Application{services: singleTenant(s)}
+}
+
+// NewMultiTenantApplication creates a new Application serving each caller with the service of its tenant
+func NewMultiTenantApplication(services Services) Application {
+	return Application{services: services}
 }
 
 // GetRouter returns a ready-to-use Gin engine for this Application
 func (app Application) GetRouter() *gin.Engine {
-	router := gin.Default()
+	if app.logger == nil {
+		app.logger = logging.New(gin.DefaultWriter, logging.LevelInfo)
+	}
+	router := gin.New()
+	router.Use(app.logRequests, gin.CustomRecoveryWithWriter(ioutil.Discard, recoverPanic))
+	if app.tracer != nil {
+		router.Use(app.trace)
+	}
+	if app.requests != nil {
+		router.Use(app.instrument)
+	}
 
-	diff := router.Group("/v1/diff")
+	// GET endpoints for operations, without authentication: liveness, readiness of the dependencies and build information
+	router.GET("/healthz", app.live)
+	router.GET("/readyz", app.ready)
+	router.GET("/version", app.version)
 
-	// POST endpoint to upload sides to diff
+	diff := router.Group("/v1/diff", app.rateLimitClient, app.authenticate, app.rateLimitCaller, app.resolveTenant)
+
+	// POST endpoint to upload sides to diff, conditionally on If-Match and If-None-Match
 	diff.POST("/:id/:side", app.saveSide)
 
-	// GET endpoint to get diff results
+	// POST endpoint to create a diff under a server-generated ID
+	diff.POST("", app.createSession)
+
+	// GET endpoint to list stored diffs
+	diff.GET("", app.listDiffs)
+
+	// GET endpoint to get diff results, optionally between versions like ?left=v3&right=v5
 	diff.GET("/:id", app.getReport)
 
+	// GET endpoints to download side data, raw or base64-encoded in JSON,
+	// and to get the metadata of all sides at /:id/meta
+	diff.GET("/:id/:side", app.getSide)
+
+	// GET endpoint to list the stored versions of a side
+	diff.GET("/:id/:side/versions", app.listVersions)
+
+	// DELETE endpoints to remove a whole diff or a single side
+	diff.DELETE("/:id", app.deleteDiff)
+	diff.DELETE("/:id/:side", app.deleteSide)
+
 	return router
 }
 
@@ -42,52 +115,369 @@ func (app Application) saveSide(ctx *gin.Context) {
 	// check side is valid
 	side, err := domain.ParseDiffSide(ctx.Param("side"))
 	if err != nil {
-		ctx.Status(404)
+		writeError(ctx, 404, &ErrorResponseBody{id, string(domain.CodeNotFound), "side not found", err.Error(), requestIDOf(ctx)})
 		return
 	}
 
-	// parse request body
+	// parse request body, as long as it fits the size limits
+	if !app.limitBody(ctx, id) {
+		return
+	}
 	var requestBody PayloadRequestBody
-	err = ctx.BindJSON(&requestBody)
+	err = ctx.ShouldBindJSON(&requestBody)
+	if errors.Is(err, errBodyTooLarge) {
+		payloadTooLarge(ctx, id, err)
+		return
+	}
 	if err != nil {
-		ctx.JSON(400, &ErrorResponseBody{id, "invalid body", err.Error()})
+		writeError(ctx, 400, &ErrorResponseBody{id, string(domain.CodeInvalidPayload), "invalid body", err.Error(), requestIDOf(ctx)})
 		return
 	}
 
+	// authenticated callers are recorded as uploaders
+	uploader := requestBody.Uploader
+	if caller, ok := identityOf(ctx); ok {
+		uploader = caller.Subject
+	}
+
 	// save side data
 	payload := domain.DiffPayload{
 		ID:    id,
 		Side:  side,
 		Value: requestBody.Data,
+		Metadata: domain.SideMetadata{
+			Filename:    requestBody.Filename,
+			ContentType: requestBody.ContentType,
+			Labels:      requestBody.Labels,
+			Uploader:    uploader,
+		},
+		Precondition: domain.SidePrecondition{
+			IfMatch:     parseETags(ctx.GetHeader("If-Match")),
+			IfNoneMatch: parseETags(ctx.GetHeader("If-None-Match")),
+		},
 	}
-	err = app.service.Save(payload)
+	err = serviceOf(ctx).Save(ctx.Request.Context(), payload)
 	if err != nil {
-		ctx.JSON(500, &ErrorResponseBody{id, "save operation failed", err.Error()})
+		respondError(ctx, id, err, "save operation failed")
 		return
 	}
 
+	addLogFields(ctx, "payload_size", decodedLen(requestBody.Data))
 	ctx.Status(204)
 }
 
 func (app Application) getReport(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	report, err := app.service.GetDiffReport(id)
+	left, okLeft := ctx.GetQuery("left")
+	right, okRight := ctx.GetQuery("right")
+	if okLeft || okRight {
+		app.getVersionedReport(ctx, id, left, right)
+		return
+	}
+
+	report, err := serviceOf(ctx).GetDiffReport(ctx.Request.Context(), id)
+
+	if err != nil {
+		respondError(ctx, id, err, "get diff failed")
+		return
+	}
+
+	metadata, err := serviceOf(ctx).GetMetadata(ctx.Request.Context(), id)
+	if err != nil && !errors.Is(err, domain.CodeNotFound) {
+		respondError(ctx, id, err, "get diff failed")
+		return
+	}
+
+	session, ok := app.getReportSession(ctx, id)
+	if !ok {
+		return
+	}
+
+	body := toDiffReportResponseBody(&report)
+	body.Sides = toSideMetadataResponses(metadata)
+	body.Session = session
+	addLogFields(ctx, "result", report.Result.String())
+	ctx.JSON(200, body)
+}
+
+// getReportSession gets the session of a reported diff, nil for diffs with client-chosen IDs.
+// It responds with an error and returns false if the session cannot be retrieved.
+func (app Application) getReportSession(ctx *gin.Context, id string) (*SessionResponse, bool) {
+	session, err := serviceOf(ctx).GetSession(ctx.Request.Context(), id)
+	if errors.Is(err, domain.CodeNotFound) {
+		return nil, true
+	}
+	if err != nil {
+		respondError(ctx, id, err, "get diff failed")
+		return nil, false
+	}
+	return toSessionResponse(&session), true
+}
+
+// getVersionedReport compares the requested versions of each side.
+// Side metadata only describes the latest versions, so it is not included.
+func (app Application) getVersionedReport(ctx *gin.Context, id, left, right string) {
+	leftVersion, err := domain.ParseSideVersion(left)
+	if err != nil {
+		writeError(ctx, 400, &ErrorResponseBody{id, string(domain.CodeInvalidQuery), "invalid query", err.Error(), requestIDOf(ctx)})
+		return
+	}
+	rightVersion, err := domain.ParseSideVersion(right)
+	if err != nil {
+		writeError(ctx, 400, &ErrorResponseBody{id, string(domain.CodeInvalidQuery), "invalid query", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	report, err := serviceOf(ctx).GetVersionedDiffReport(ctx.Request.Context(), id, leftVersion, rightVersion)
+	if err != nil {
+		respondError(ctx, id, err, "get diff failed")
+		return
+	}
+
+	session, ok := app.getReportSession(ctx, id)
+	if !ok {
+		return
+	}
+
+	body := toDiffReportResponseBody(&report)
+	body.Session = session
+	addLogFields(ctx, "result", report.Result.String())
+	ctx.JSON(200, body)
+}
+
+func (app Application) getMetadata(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	metadata, err := serviceOf(ctx).GetMetadata(ctx.Request.Context(), id)
+	if err != nil {
+		respondError(ctx, id, err, "get metadata failed")
+		return
+	}
+
+	ctx.JSON(200, &DiffMetadataResponseBody{toSideMetadataResponses(metadata)})
+}
+
+func (app Application) getSide(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	// the router cannot tell a static segment apart from the side wildcard
+	if ctx.Param("side") == "meta" {
+		app.getMetadata(ctx)
+		return
+	}
 
+	// check side is valid
+	side, err := domain.ParseDiffSide(ctx.Param("side"))
 	if err != nil {
-		var status int
-		var message string
-		if _, ok := err.(domain.DiffNotFoundError); ok {
-			status = 404
-			message = "diff not found"
-		} else {
-			status = 500
-			message = "get diff failed"
+		writeError(ctx, 404, &ErrorResponseBody{id, string(domain.CodeNotFound), "side not found", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	data, meta, err := serviceOf(ctx).GetSide(ctx.Request.Context(), id, side)
+	if err != nil {
+		respondSideError(ctx, id, err, "get side failed")
+		return
+	}
+
+	ctx.Header("ETag", `"`+domain.Digest(data)+`"`)
+
+	if ctx.NegotiateFormat(octetStream, binding.MIMEJSON) == binding.MIMEJSON {
+		ctx.JSON(200, &SideResponseBody{base64.StdEncoding.EncodeToString(data)})
+		return
+	}
+
+	// the content type comes from the uploader, so browsers must neither sniff nor render the data inline.
+	// ServeContent takes care of Content-Length, Range and conditional requests
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = octetStream
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.Header("Content-Disposition", contentDisposition(meta.Filename))
+	http.ServeContent(ctx.Writer, ctx.Request, "", time.Time{}, bytes.NewReader(data))
+}
+
+const octetStream = "application/octet-stream"
+
+// contentDisposition returns a Content-Disposition header downloading data as an attachment, named after the file if any
+func contentDisposition(filename string) string {
+	if filename != "" {
+		if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); disposition != "" {
+			return disposition
+		}
+	}
+	return "attachment"
+}
+
+// parseETags parses the entity tags listed in If-Match and If-None-Match headers.
+// Weak tags keep their prefix, so they never match the strong tags of stored sides.
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if tag != domain.AnyTag {
+			tag = strings.Replace(tag, `"`, "", 2)
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func (app Application) listVersions(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	// check side is valid
+	side, err := domain.ParseDiffSide(ctx.Param("side"))
+	if err != nil {
+		writeError(ctx, 404, &ErrorResponseBody{id, string(domain.CodeNotFound), "side not found", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	versions, err := serviceOf(ctx).ListVersions(ctx.Request.Context(), id, side)
+	if err != nil {
+		respondSideError(ctx, id, err, "list versions failed")
+		return
+	}
+
+	ctx.JSON(200, toSideVersionListResponseBody(versions))
+}
+
+func (app Application) deleteDiff(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	err := serviceOf(ctx).Delete(ctx.Request.Context(), id)
+	if err != nil {
+		respondError(ctx, id, err, "delete operation failed")
+		return
+	}
+
+	ctx.Status(204)
+}
+
+func (app Application) deleteSide(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	// check side is valid
+	side, err := domain.ParseDiffSide(ctx.Param("side"))
+	if err != nil {
+		writeError(ctx, 404, &ErrorResponseBody{id, string(domain.CodeNotFound), "side not found", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	err = serviceOf(ctx).DeleteSide(ctx.Request.Context(), id, side)
+	if err != nil {
+		respondError(ctx, id, err, "delete operation failed")
+		return
+	}
+
+	ctx.Status(204)
+}
+
+func (app Application) createSession(ctx *gin.Context) {
+	// the request body is optional
+	var requestBody SessionRequestBody
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&requestBody); err != nil && err != io.EOF {
+		writeError(ctx, 400, &ErrorResponseBody{"", string(domain.CodeInvalidPayload), "invalid body", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	session, err := serviceOf(ctx).CreateSession(ctx.Request.Context(), requestBody.LockWhenComplete)
+	if err != nil {
+		respondError(ctx, "", err, "create session failed")
+		return
+	}
+
+	ctx.Header("Location", "/v1/diff/"+session.ID)
+	ctx.JSON(201, toSessionResponse(&session))
+}
+
+func (app Application) listDiffs(ctx *gin.Context) {
+	query := domain.DiffListQuery{
+		Prefix: ctx.Query("prefix"),
+		Cursor: ctx.Query("cursor"),
+	}
+
+	var err error
+	if limit := ctx.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			writeError(ctx, 400, &ErrorResponseBody{"", string(domain.CodeInvalidQuery), "invalid query", "limit is not a number", requestIDOf(ctx)})
+			return
+		}
+	}
+	if query.SortBy, err = domain.ParseDiffSortOrder(ctx.Query("sort")); err != nil {
+		writeError(ctx, 400, &ErrorResponseBody{"", string(domain.CodeInvalidQuery), "invalid query", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	page, err := serviceOf(ctx).ListDiffs(ctx.Request.Context(), query)
+	if err != nil {
+		respondError(ctx, "", err, "list operation failed")
+		return
+	}
+
+	ctx.JSON(200, toDiffListResponseBody(&page))
+}
+
+func toDiffListResponseBody(page *domain.DiffPage) *DiffListResponseBody {
+	diffs := make([]DiffSummaryResponse, len(page.Diffs))
+	for i, d := range page.Diffs {
+		diffs[i] = DiffSummaryResponse{
+			ID:           d.ID,
+			LastModified: d.LastModified,
+		}
+	}
+	return &DiffListResponseBody{
+		Diffs:      diffs,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func toSessionResponse(session *domain.DiffSession) *SessionResponse {
+	response := &SessionResponse{
+		ID:               session.ID,
+		CreatedAt:        session.CreatedAt,
+		LockWhenComplete: session.LockWhenComplete,
+		Locked:           session.Locked(),
+	}
+	if session.Locked() {
+		lockedAt := session.LockedAt
+		response.LockedAt = &lockedAt
+	}
+	return response
+}
+
+func toSideVersionListResponseBody(versions []domain.SideVersion) *SideVersionListResponseBody {
+	responses := make([]SideVersionResponse, len(versions))
+	for i, v := range versions {
+		responses[i] = SideVersionResponse{
+			Version:    v.Version,
+			Size:       v.Size,
+			UploadedAt: v.UploadedAt,
+		}
+	}
+	return &SideVersionListResponseBody{responses}
+}
+
+func toSideMetadataResponses(metadata map[domain.DiffSide]domain.SideMetadata) map[string]SideMetadataResponse {
+	if len(metadata) == 0 {
+		return nil
+	}
+	responses := make(map[string]SideMetadataResponse, len(metadata))
+	for side, meta := range metadata {
+		responses[side.String()] = SideMetadataResponse{
+			Filename:    meta.Filename,
+			ContentType: meta.ContentType,
+			Labels:      meta.Labels,
+			Uploader:    meta.Uploader,
+			UploadedAt:  meta.UploadedAt,
 		}
-		ctx.JSON(status, &ErrorResponseBody{id, message, err.Error()})
-	} else {
-		ctx.JSON(200, toDiffReportResponseBody(&report))
 	}
+	return responses
 }
 
 func toDiffReportResponseBody(report *domain.DiffReport) *DiffReportResponseBody {
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ehpalumbo/go-diff/api"
 	"github.com/ehpalumbo/go-diff/api/mocks"
@@ -109,7 +110,7 @@ func TestSaveFailsWith500WhenServiceSaveFails(t *testing.T) {
 		Side:  domain.DiffSide("left"),
 		Value: "abc",
 	}
-	svcMock.EXPECT().Save(expectedPayload).Return(errors.New("oops"))
+	svcMock.EXPECT().Save(gomock.Any(), expectedPayload).Return(errors.New("oops"))
 
 	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
 	w := httptest.NewRecorder()
@@ -151,7 +152,7 @@ func TestSaveSuccess(t *testing.T) {
 		Side:  domain.DiffSide("right"),
 		Value: "abc",
 	}
-	svcMock.EXPECT().Save(expectedPayload).Return(nil)
+	svcMock.EXPECT().Save(gomock.Any(), expectedPayload).Return(nil)
 
 	req, _ := http.NewRequest("POST", "/v1/diff/1/right", strings.NewReader(`{"data": "abc"}`))
 	w := httptest.NewRecorder()
@@ -170,7 +171,7 @@ func TestDiffNotFound(t *testing.T) {
 	defer tearDown()
 
 	// given
-	svcMock.EXPECT().GetDiffReport("1").Return(domain.DiffReport{}, domain.DiffNotFoundError{ID: "1"})
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{}, domain.DiffNotFoundError{ID: "1"})
 
 	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
 	w := httptest.NewRecorder()
@@ -203,7 +204,7 @@ func TestGetDiffFailed(t *testing.T) {
 	defer tearDown()
 
 	// given
-	svcMock.EXPECT().GetDiffReport("1").Return(domain.DiffReport{}, errors.New("oops"))
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{}, errors.New("oops"))
 
 	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
 	w := httptest.NewRecorder()
@@ -245,7 +246,9 @@ func TestGetDiffReportSuccess(t *testing.T) {
 			},
 		},
 	}
-	svcMock.EXPECT().GetDiffReport("1").Return(r, nil)
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(r, nil)
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, domain.DiffNotFoundError{ID: "1"})
+	svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, domain.DiffNotFoundError{ID: "1"})
 
 	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
 	w := httptest.NewRecorder()
@@ -297,7 +300,9 @@ func TestGetDiffReportSuccessWithoutInsights(t *testing.T) {
 		Result:   domain.SizeMismatch,
 		Insights: []domain.DiffInsight{},
 	}
-	svcMock.EXPECT().GetDiffReport("1").Return(r, nil)
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(r, nil)
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, domain.DiffNotFoundError{ID: "1"})
+	svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, domain.DiffNotFoundError{ID: "1"})
 
 	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
 	w := httptest.NewRecorder()
@@ -324,3 +329,1194 @@ func TestGetDiffReportSuccessWithoutInsights(t *testing.T) {
 		t.Errorf("expected no diff insights, got: %v", body.Insights)
 	}
 }
+
+func TestDeleteDiffSuccess(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/v1/diff/1", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("failed with status %v", w.Code)
+	}
+}
+
+func TestDeleteSideSuccess(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().DeleteSide(gomock.Any(), "1", domain.LeftSide).Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/v1/diff/1/left", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("failed with status %v", w.Code)
+	}
+}
+
+func TestDeleteRejectsIllegalDiffSide(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	req, _ := http.NewRequest("DELETE", "/v1/diff/1/wrong", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 404 {
+		t.Error("accepted wrong side in URI")
+	}
+}
+
+func TestDeleteFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "diff not found",
+			err:    domain.DiffNotFoundError{ID: "1"},
+			status: 404,
+			reason: "diff not found",
+		},
+		{
+			name:   "diff locked",
+			err:    domain.DiffLockedError{ID: "1"},
+			status: 409,
+			reason: "diff is locked",
+		},
+		{
+			name:   "service failure",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "delete operation failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			svcMock.EXPECT().Delete(gomock.Any(), "1").Return(c.err)
+
+			req, _ := http.NewRequest("DELETE", "/v1/diff/1", nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+
+			var body struct {
+				ID     string `json:"id"`
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("returned error response does not fit expected JSON response, got: %s", w.Body)
+			}
+			if body.ID != "1" {
+				t.Errorf("wrong ID in error response, got: %s", body.ID)
+			}
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestListDiffsSuccess(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	modified := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	expectedQuery := domain.DiffListQuery{
+		Prefix: "ci-",
+		Cursor: "abc",
+		Limit:  10,
+		SortBy: domain.SortByLastModifiedNewest,
+	}
+	page := domain.DiffPage{
+		Diffs:      []domain.DiffSummary{{ID: "ci-1", LastModified: modified}},
+		NextCursor: "def",
+	}
+	svcMock.EXPECT().ListDiffs(gomock.Any(), expectedQuery).Return(page, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff?prefix=ci-&cursor=abc&limit=10&sort=-last_modified", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+
+	var body struct {
+		Diffs []struct {
+			ID           string    `json:"id"`
+			LastModified time.Time `json:"last_modified"`
+		} `json:"diffs"`
+		NextCursor string `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("returned response does not fit expected JSON response, got: %s", w.Body)
+	}
+	if len(body.Diffs) != 1 || body.Diffs[0].ID != "ci-1" || !body.Diffs[0].LastModified.Equal(modified) {
+		t.Errorf("wrong diffs in response, got: %v", body.Diffs)
+	}
+	if body.NextCursor != "def" {
+		t.Errorf("wrong next cursor in response, got: %s", body.NextCursor)
+	}
+}
+
+func TestListDiffsReturnsEmptyArray(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().ListDiffs(gomock.Any(), domain.DiffListQuery{SortBy: domain.SortByID}).Return(domain.DiffPage{}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+	if w.Body.String() != `{"diffs":[]}` {
+		t.Errorf("wrong response body, got: %s", w.Body)
+	}
+}
+
+func TestListDiffsFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		query  string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "limit is not a number",
+			query:  "limit=ten",
+			status: 400,
+			reason: "invalid query",
+		},
+		{
+			name:   "sort order is unknown",
+			query:  "sort=size",
+			status: 400,
+			reason: "invalid query",
+		},
+		{
+			name:   "service rejected query",
+			err:    domain.IllegalDiffQueryError("invalid cursor"),
+			status: 400,
+			reason: "invalid query",
+		},
+		{
+			name:   "service failure",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "list operation failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			if c.err != nil {
+				svcMock.EXPECT().ListDiffs(gomock.Any(), gomock.Any()).Return(domain.DiffPage{}, c.err)
+			}
+
+			req, _ := http.NewRequest("GET", "/v1/diff?"+c.query, nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("returned error response does not fit expected JSON response, got: %s", w.Body)
+			}
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestGetSideRaw(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return([]byte("hello"), domain.SideMetadata{}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+	if w.Body.String() != "hello" {
+		t.Errorf("wrong body, got: %s", w.Body)
+	}
+	headers := map[string]string{
+		"Content-Type":           "application/octet-stream",
+		"Content-Length":         "5",
+		"X-Content-Type-Options": "nosniff",
+		"Content-Disposition":    "attachment",
+		// sha256("hello")
+		"ETag": `"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`,
+	}
+	for k, v := range headers {
+		if actual := w.Header().Get(k); actual != v {
+			t.Errorf("wrong %s header, expected: %s, got: %s", k, v, actual)
+		}
+	}
+}
+
+func TestGetSideRange(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return([]byte("hello"), domain.SideMetadata{}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+	req.Header.Set("Range", "bytes=1-3")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 206 {
+		t.Fatalf("wrong status code, expected: 206, got: %v", w.Code)
+	}
+	if w.Body.String() != "ell" {
+		t.Errorf("wrong body, got: %s", w.Body)
+	}
+	if cr := w.Header().Get("Content-Range"); cr != "bytes 1-3/5" {
+		t.Errorf("wrong Content-Range header, got: %s", cr)
+	}
+}
+
+func TestGetSideNotModified(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return([]byte("hello"), domain.SideMetadata{}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+	req.Header.Set("If-None-Match", `"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 304 {
+		t.Errorf("wrong status code, expected: 304, got: %v", w.Code)
+	}
+}
+
+func TestGetSideJSON(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.RightSide).Return([]byte("Go go go!"), domain.SideMetadata{}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/right", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+
+	var body struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("returned response does not fit expected JSON response, got: %s", w.Body)
+	}
+	if body.Data != "R28gZ28gZ28h" {
+		t.Errorf("wrong data in response, got: %s", body.Data)
+	}
+}
+
+func TestGetSideFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "side not found",
+			err:    domain.DiffNotFoundError{ID: "1"},
+			status: 404,
+			reason: "side not found",
+		},
+		{
+			name:   "service failure",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "get side failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return(nil, domain.SideMetadata{}, c.err)
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+
+			var body struct {
+				ID     string `json:"id"`
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("returned error response does not fit expected JSON response, got: %s", w.Body)
+			}
+			if body.ID != "1" {
+				t.Errorf("wrong ID in error response, got: %s", body.ID)
+			}
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestGetSideRejectsIllegalDiffSide(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	req, _ := http.NewRequest("GET", "/v1/diff/1/wrong", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 404 {
+		t.Error("accepted wrong side in URI")
+	}
+}
+
+func TestGetDiffReportIncludesSideMetadata(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	uploaded := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{Result: domain.Equal}, nil)
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(map[domain.DiffSide]domain.SideMetadata{
+		domain.LeftSide: {Filename: "left.txt", Labels: map[string]string{"pipeline": "ci"}, UploadedAt: uploaded},
+	}, nil)
+	svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, domain.DiffNotFoundError{ID: "1"})
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+
+	var body struct {
+		Result string `json:"result"`
+		Sides  map[string]struct {
+			Filename   string            `json:"filename"`
+			Labels     map[string]string `json:"labels"`
+			UploadedAt time.Time         `json:"uploaded_at"`
+		} `json:"sides"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("returned response does not fit expected JSON response, got: %s", w.Body)
+	}
+	left, ok := body.Sides["left"]
+	if !ok || len(body.Sides) != 1 {
+		t.Fatalf("wrong sides in response, got: %v", body.Sides)
+	}
+	if left.Filename != "left.txt" || left.Labels["pipeline"] != "ci" || !left.UploadedAt.Equal(uploaded) {
+		t.Errorf("wrong side metadata in response, got: %v", left)
+	}
+}
+
+func TestGetDiffReportFailsWhenMetadataFails(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{Result: domain.Equal}, nil)
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, errors.New("oops"))
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 500 {
+		t.Errorf("wrong status code, expected: 500, got: %d", w.Code)
+	}
+}
+
+func TestGetMetadataSuccess(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(map[domain.DiffSide]domain.SideMetadata{
+		domain.LeftSide:  {ContentType: "text/plain", Uploader: "gopher"},
+		domain.RightSide: {Filename: "right.bin"},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/meta", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+
+	var body struct {
+		Sides map[string]struct {
+			Filename    string `json:"filename"`
+			ContentType string `json:"content_type"`
+			Uploader    string `json:"uploader"`
+		} `json:"sides"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("returned response does not fit expected JSON response, got: %s", w.Body)
+	}
+	if body.Sides["left"].ContentType != "text/plain" || body.Sides["left"].Uploader != "gopher" {
+		t.Errorf("wrong left side metadata, got: %v", body.Sides["left"])
+	}
+	if body.Sides["right"].Filename != "right.bin" {
+		t.Errorf("wrong right side metadata, got: %v", body.Sides["right"])
+	}
+}
+
+func TestGetMetadataFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "diff not found",
+			err:    domain.DiffNotFoundError{ID: "1"},
+			status: 404,
+			reason: "diff not found",
+		},
+		{
+			name:   "service failure",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "get metadata failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, c.err)
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1/meta", nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestGetSideUsesStoredContentType(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return([]byte("hello"), domain.SideMetadata{ContentType: "text/plain"}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("wrong content type header: %s", ct)
+	}
+}
+
+func TestGetSideDownloadsStoredFilename(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	meta := domain.SideMetadata{Filename: "left page.html", ContentType: "text/html"}
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return([]byte("<p>hello</p>"), meta, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="left page.html"` {
+		t.Errorf("wrong content disposition header: %s", cd)
+	}
+	if nosniff := w.Header().Get("X-Content-Type-Options"); nosniff != "nosniff" {
+		t.Errorf("wrong content type options header: %s", nosniff)
+	}
+}
+
+func TestSavePassesMetadataToService(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	expectedPayload := domain.DiffPayload{
+		ID:    "1",
+		Side:  domain.LeftSide,
+		Value: "abc",
+		Metadata: domain.SideMetadata{
+			Filename:    "left.txt",
+			ContentType: "text/plain",
+			Labels:      map[string]string{"pipeline": "ci"},
+			Uploader:    "gopher",
+		},
+	}
+	svcMock.EXPECT().Save(gomock.Any(), expectedPayload).Return(nil)
+
+	body := `{"data": "abc", "filename": "left.txt", "content_type": "text/plain", "labels": {"pipeline": "ci"}, "uploader": "gopher"}`
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("failed with status %v", w.Code)
+	}
+}
+
+func TestGetVersionedDiffReport(t *testing.T) {
+
+	cases := []struct {
+		name        string
+		query       string
+		left, right int
+	}{
+		{
+			name:  "both versions",
+			query: "left=v3&right=5",
+			left:  3,
+			right: 5,
+		},
+		{
+			name:  "latest right side",
+			query: "left=v2",
+			left:  2,
+			right: domain.LatestVersion,
+		},
+		{
+			name:  "explicitly latest left side",
+			query: "left=latest&right=v1",
+			left:  domain.LatestVersion,
+			right: 1,
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			svcMock.EXPECT().GetVersionedDiffReport(gomock.Any(), "1", c.left, c.right).Return(domain.DiffReport{Result: domain.Equal}, nil)
+			svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, domain.DiffNotFoundError{ID: "1"})
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1?"+c.query, nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 200 {
+				t.Fatalf("failed with status %v", w.Code)
+			}
+			var body struct {
+				Result string `json:"result"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Result != "EQUAL" {
+				t.Errorf("wrong result, got: %s", body.Result)
+			}
+		})
+
+	}
+}
+
+func TestGetVersionedDiffReportFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		query  string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "invalid left version",
+			query:  "left=first",
+			status: 400,
+			reason: "invalid query",
+		},
+		{
+			name:   "invalid right version",
+			query:  "left=1&right=v0",
+			status: 400,
+			reason: "invalid query",
+		},
+		{
+			name:   "version not found",
+			query:  "left=1&right=2",
+			err:    domain.DiffNotFoundError{ID: "1"},
+			status: 404,
+			reason: "diff not found",
+		},
+		{
+			name:   "service failure",
+			query:  "left=1&right=2",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "get diff failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			if c.err != nil {
+				svcMock.EXPECT().GetVersionedDiffReport(gomock.Any(), "1", 1, 2).Return(domain.DiffReport{}, c.err)
+			}
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1?"+c.query, nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestListVersionsSuccess(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	uploaded := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	svcMock.EXPECT().ListVersions(gomock.Any(), "1", domain.RightSide).Return([]domain.SideVersion{
+		{Version: 1, Size: 5, UploadedAt: uploaded},
+		{Version: 2, Size: 6, UploadedAt: uploaded.Add(time.Hour)},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/right/versions", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+	var body struct {
+		Versions []struct {
+			Version    int       `json:"version"`
+			Size       int64     `json:"size"`
+			UploadedAt time.Time `json:"uploaded_at"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("returned response does not fit expected JSON response, got: %s", w.Body)
+	}
+	if len(body.Versions) != 2 {
+		t.Fatalf("wrong number of versions, got: %v", body.Versions)
+	}
+	if v := body.Versions[1]; v.Version != 2 || v.Size != 6 || !v.UploadedAt.Equal(uploaded.Add(time.Hour)) {
+		t.Errorf("wrong version in response, got: %v", v)
+	}
+}
+
+func TestListVersionsFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		side   string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "invalid side",
+			side:   "center",
+			status: 404,
+			reason: "side not found",
+		},
+		{
+			name:   "side not found",
+			side:   "left",
+			err:    domain.DiffNotFoundError{ID: "1"},
+			status: 404,
+			reason: "side not found",
+		},
+		{
+			name:   "service failure",
+			side:   "left",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "list versions failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			if c.err != nil {
+				svcMock.EXPECT().ListVersions(gomock.Any(), "1", domain.DiffSide(c.side)).Return(nil, c.err)
+			}
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1/"+c.side+"/versions", nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestSavePassesPreconditionToService(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		headers  map[string]string
+		expected domain.SidePrecondition
+	}{
+		{
+			name:    "if match",
+			headers: map[string]string{"If-Match": `"abc", "def"`},
+			expected: domain.SidePrecondition{
+				IfMatch: []string{"abc", "def"},
+			},
+		},
+		{
+			name:    "if none match any",
+			headers: map[string]string{"If-None-Match": "*"},
+			expected: domain.SidePrecondition{
+				IfNoneMatch: []string{domain.AnyTag},
+			},
+		},
+		{
+			name:    "weak tag",
+			headers: map[string]string{"If-None-Match": `W/"abc"`},
+			expected: domain.SidePrecondition{
+				IfNoneMatch: []string{"W/abc"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			expectedPayload := domain.DiffPayload{
+				ID:           "1",
+				Side:         domain.LeftSide,
+				Value:        "abc",
+				Precondition: c.expected,
+			}
+			svcMock.EXPECT().Save(gomock.Any(), expectedPayload).Return(nil)
+
+			req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 204 {
+				t.Errorf("failed with status %v", w.Code)
+			}
+		})
+
+	}
+}
+
+func TestSaveRespondsPreconditionFailed(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(domain.PreconditionFailedError{ID: "1", Side: "left"})
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+	req.Header.Set("If-Match", `"abc"`)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 412 {
+		t.Errorf("wrong status code, expected: 412, got: %d", w.Code)
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Reason != "precondition failed" {
+		t.Errorf("wrong reason in error response, got: %s", body.Reason)
+	}
+}
+
+func TestSaveRespondsConflictWhenDiffIsLocked(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(domain.DiffLockedError{ID: "1"})
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 409 {
+		t.Errorf("wrong status code, expected: 409, got: %d", w.Code)
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Reason != "diff is locked" {
+		t.Errorf("wrong reason in error response, got: %s", body.Reason)
+	}
+}
+
+func TestCreateSessionSuccess(t *testing.T) {
+
+	created := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name             string
+		body             string
+		lockWhenComplete bool
+	}{
+		{
+			name: "without body",
+		},
+		{
+			name: "with empty body",
+			body: "{}",
+		},
+		{
+			name:             "locking when complete",
+			body:             `{"lock_when_complete": true}`,
+			lockWhenComplete: true,
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			session := domain.DiffSession{ID: "abc", CreatedAt: created, LockWhenComplete: c.lockWhenComplete}
+			svcMock.EXPECT().CreateSession(gomock.Any(), c.lockWhenComplete).Return(session, nil)
+
+			req, _ := http.NewRequest("POST", "/v1/diff", strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 201 {
+				t.Fatalf("wrong status code, expected: 201, got: %d", w.Code)
+			}
+			if location := w.Header().Get("Location"); location != "/v1/diff/abc" {
+				t.Errorf("wrong location, got: %s", location)
+			}
+			var body api.SessionResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response does not fit expected JSON response, got: %s", w.Body)
+			}
+			if body.ID != "abc" || !body.CreatedAt.Equal(created) || body.LockWhenComplete != c.lockWhenComplete || body.Locked {
+				t.Errorf("wrong session in response, got: %+v", body)
+			}
+		})
+
+	}
+}
+
+func TestCreateSessionFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		reason string
+	}{
+		{
+			name:   "invalid body",
+			body:   "not JSON",
+			status: 400,
+			reason: "invalid body",
+		},
+		{
+			name:   "service failure",
+			err:    errors.New("oops"),
+			status: 500,
+			reason: "create session failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			if c.err != nil {
+				svcMock.EXPECT().CreateSession(gomock.Any(), false).Return(domain.DiffSession{}, c.err)
+			}
+
+			req, _ := http.NewRequest("POST", "/v1/diff", strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Reason != c.reason {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
+
+func TestGetDiffReportIncludesSession(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	created := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	locked := created.Add(time.Minute)
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{Result: domain.Equal}, nil)
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(map[domain.DiffSide]domain.SideMetadata{}, nil)
+	svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{ID: "1", CreatedAt: created, LockWhenComplete: true, LockedAt: locked}, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Fatalf("failed with status %v", w.Code)
+	}
+	var body api.DiffReportResponseBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response does not fit expected JSON response, got: %s", w.Body)
+	}
+	if body.Session == nil || !body.Session.Locked || !body.Session.CreatedAt.Equal(created) || !body.Session.LockedAt.Equal(locked) {
+		t.Errorf("wrong session in report, got: %+v", body.Session)
+	}
+}
+
+func TestGetDiffReportFailsWhenSessionFails(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{Result: domain.Equal}, nil)
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(map[domain.DiffSide]domain.SideMetadata{}, nil)
+	svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, errors.New("oops"))
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 500 {
+		t.Errorf("wrong status code, expected: 500, got: %d", w.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator maps the credentials of a request to the identity of the caller
+type Authenticator interface {
+	Authenticate(*http.Request) (domain.Identity, error)
+}
+
+// identityKey is the gin context key of the authenticated caller
+const identityKey = "identity"
+
+// WithAuthenticator returns a copy of the Application that requires every diff request to be authenticated
+func (app Application) WithAuthenticator(a Authenticator) Application {
+	app.authenticator = a
+	return app
+}
+
+// authenticate is a middleware that rejects requests without valid credentials,
+// keeping the identity of the caller for later handlers
+func (app Application) authenticate(ctx *gin.Context) {
+	if app.authenticator == nil {
+		return
+	}
+	identity, err := app.authenticator.Authenticate(ctx.Request)
+	if err != nil {
+		ctx.Header("WWW-Authenticate", `Bearer realm="go-diff"`)
+		writeError(ctx, 401, &ErrorResponseBody{ctx.Param("id"), CodeUnauthorized, "unauthorized", err.Error(), requestIDOf(ctx)})
+		return
+	}
+	ctx.Set(identityKey, identity)
+}
+
+// identityOf returns the authenticated caller, if any
+func identityOf(ctx *gin.Context) (domain.Identity, bool) {
+	identity, ok := ctx.Get(identityKey)
+	if !ok {
+		return domain.Identity{}, false
+	}
+	return identity.(domain.Identity), true
+}
@@ -0,0 +1,229 @@
+//go:generate mockgen -destination mocks/authenticator_mock.go -package=mocks . Authenticator
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+// setUpAuthenticated creates a router whose callers are authenticated by a mock,
+// recording the identity each service is resolved for
+func setUpAuthenticated(t *testing.T) (*mocks.MockAuthenticator, *mocks.MockDiffService, *domain.Identity, http.Handler) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+	authenticator := mocks.NewMockAuthenticator(ctrl)
+	svc := mocks.NewMockDiffService(ctrl)
+	var resolved domain.Identity
+	app := api.NewMultiTenantApplication(func(caller domain.Identity) (api.DiffService, error) {
+		resolved = caller
+		return svc, nil
+	}).WithAuthenticator(authenticator)
+	return authenticator, svc, &resolved, app.GetRouter()
+}
+
+func TestAuthenticatedCallerUsesServiceOfItsTenant(t *testing.T) {
+	authenticator, svc, resolved, router := setUpAuthenticated(t)
+
+	// given
+	caller := domain.Identity{Subject: "ci", Tenant: domain.Tenant("acme")}
+	authenticator.EXPECT().Authenticate(gomock.Any()).Return(caller, nil)
+	svc.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/v1/diff/1", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("wrong status code, expected: 204, got: %d", w.Code)
+	}
+	if *resolved != caller {
+		t.Errorf("wrong caller, got: %v", *resolved)
+	}
+}
+
+func TestAuthenticationFailures(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		caller domain.Identity
+		err    error
+		tenant string
+		status int
+		reason string
+	}{
+		{
+			name:   "invalid credentials",
+			err:    errors.New("invalid credentials: unknown API key"),
+			status: 401,
+			reason: "unauthorized",
+		},
+		{
+			name:   "access to another tenant",
+			caller: domain.Identity{Subject: "ci", Tenant: domain.Tenant("acme")},
+			tenant: "other",
+			status: 403,
+			reason: "forbidden",
+		},
+		{
+			name:   "access to a tenant without belonging to any",
+			caller: domain.Identity{Subject: "ci"},
+			tenant: "acme",
+			status: 403,
+			reason: "forbidden",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			authenticator, _, _, router := setUpAuthenticated(t)
+
+			// given
+			authenticator.EXPECT().Authenticate(gomock.Any()).Return(c.caller, c.err)
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+			req.Header.Set(api.TenantHeader, c.tenant)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+			var body struct {
+				ID     string `json:"id"`
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("returned error response does not fit expected JSON response, got: %s", w.Body)
+			}
+			if body.ID != "1" || body.Reason != c.reason {
+				t.Errorf("wrong error response, got: %s", w.Body)
+			}
+		})
+
+	}
+}
+
+func TestUnauthorizedResponseAsksForCredentials(t *testing.T) {
+	authenticator, _, _, router := setUpAuthenticated(t)
+
+	// given
+	authenticator.EXPECT().Authenticate(gomock.Any()).Return(domain.Identity{}, errors.New("no credentials"))
+
+	req, _ := http.NewRequest("GET", "/v1/diff", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 401 || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("wrong unauthorized response, got: %d, %v", w.Code, w.Header())
+	}
+}
+
+func TestAuthenticatedCallerIsRecordedAsUploader(t *testing.T) {
+	authenticator, svc, _, router := setUpAuthenticated(t)
+
+	// given
+	authenticator.EXPECT().Authenticate(gomock.Any()).Return(domain.Identity{Subject: "ci"}, nil)
+	svc.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, p domain.DiffPayload) error {
+		if p.Metadata.Uploader != "ci" {
+			t.Errorf("wrong uploader, got: %s", p.Metadata.Uploader)
+		}
+		return nil
+	})
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc", "uploader": "someone else"}`))
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("wrong status code, expected: 204, got: %d", w.Code)
+	}
+}
+
+func TestForbiddenOperations(t *testing.T) {
+	forbidden := domain.ForbiddenError{Subject: "ci", Operation: "delete", ID: "1"}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		expect func()
+	}{
+		{name: "save", method: "POST", path: "/v1/diff/1/left", body: `{"data": "abc"}`, expect: func() {
+			svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(forbidden)
+		}},
+		{name: "report", method: "GET", path: "/v1/diff/1", expect: func() {
+			svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{}, forbidden)
+		}},
+		{name: "metadata", method: "GET", path: "/v1/diff/1/meta", expect: func() {
+			svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, forbidden)
+		}},
+		{name: "side", method: "GET", path: "/v1/diff/1/left", expect: func() {
+			svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return(nil, domain.SideMetadata{}, forbidden)
+		}},
+		{name: "versions", method: "GET", path: "/v1/diff/1/left/versions", expect: func() {
+			svcMock.EXPECT().ListVersions(gomock.Any(), "1", domain.LeftSide).Return(nil, forbidden)
+		}},
+		{name: "delete", method: "DELETE", path: "/v1/diff/1", expect: func() {
+			svcMock.EXPECT().Delete(gomock.Any(), "1").Return(forbidden)
+		}},
+		{name: "list", method: "GET", path: "/v1/diff", expect: func() {
+			svcMock.EXPECT().ListDiffs(gomock.Any(), gomock.Any()).Return(domain.DiffPage{}, forbidden)
+		}},
+		{name: "create session", method: "POST", path: "/v1/diff", expect: func() {
+			svcMock.EXPECT().CreateSession(gomock.Any(), false).Return(domain.DiffSession{}, forbidden)
+		}},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			c.expect()
+			req, _ := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 403 {
+				t.Errorf("wrong status code, expected: 403, got: %d", w.Code)
+			}
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Reason != "forbidden" {
+				t.Errorf("wrong reason in error response, got: %s", body.Reason)
+			}
+		})
+
+	}
+}
@@ -1,8 +1,33 @@
 package api
 
+import "time"
+
 // PayloadRequestBody is the definition of the JSON request body for uploading side data
 type PayloadRequestBody struct {
-	Data string `json:"data" binding:"required"`
+	Data        string            `json:"data" binding:"required"`
+	Filename    string            `json:"filename"`
+	ContentType string            `json:"content_type"`
+	Labels      map[string]string `json:"labels"`
+	Uploader    string            `json:"uploader"`
+}
+
+// SessionRequestBody is the definition of the optional JSON request body for creating diff sessions
+type SessionRequestBody struct {
+	LockWhenComplete bool `json:"lock_when_complete"`
+}
+
+// SessionResponse contains information about a diff created under a server-generated ID
+type SessionResponse struct {
+	ID               string     `json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LockWhenComplete bool       `json:"lock_when_complete"`
+	Locked           bool       `json:"locked"`
+	LockedAt         *time.Time `json:"locked_at,omitempty"`
+}
+
+// SideResponseBody is the definition of the JSON response body for downloading side data
+type SideResponseBody struct {
+	Data string `json:"data"`
 }
 
 // DiffInsightResponse contains information about a single difference in the data
@@ -11,15 +36,99 @@ type DiffInsightResponse struct {
 	Length uint `json:"length"`
 }
 
+// SideMetadataResponse contains the metadata attached to an uploaded side
+type SideMetadataResponse struct {
+	Filename    string            `json:"filename,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Uploader    string            `json:"uploader,omitempty"`
+	UploadedAt  time.Time         `json:"uploaded_at"`
+}
+
+// DiffMetadataResponseBody contains the metadata of every uploaded side of a diff
+type DiffMetadataResponseBody struct {
+	Sides map[string]SideMetadataResponse `json:"sides"`
+}
+
 // DiffReportResponseBody contains information about differences in the data
 type DiffReportResponseBody struct {
-	Result   string                `json:"result"`
-	Insights []DiffInsightResponse `json:"insights,omitempty"`
+	Result   string                          `json:"result"`
+	Insights []DiffInsightResponse           `json:"insights,omitempty"`
+	Sides    map[string]SideMetadataResponse `json:"sides,omitempty"`
+	Session  *SessionResponse                `json:"session,omitempty"`
+}
+
+// DiffSummaryResponse contains information about a stored diff
+type DiffSummaryResponse struct {
+	ID           string    `json:"id"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// DiffListResponseBody contains a page of stored diffs
+type DiffListResponseBody struct {
+	Diffs      []DiffSummaryResponse `json:"diffs"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// SideVersionResponse contains information about a stored version of a side
+type SideVersionResponse struct {
+	Version    int       `json:"version"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
 }
 
-// ErrorResponseBody is the definition of JSON response body returned in case of errors
+// SideVersionListResponseBody contains every stored version of a side, oldest first
+type SideVersionListResponseBody struct {
+	Versions []SideVersionResponse `json:"versions"`
+}
+
+// ErrorResponseBody is the definition of JSON response body returned in case of errors.
+// Code is stable and machine-readable, while Reason and Cause are meant for humans.
+// RequestID identifies the request in logs, as echoed in the X-Request-ID header.
 type ErrorResponseBody struct {
-	ID     string `json:"id"`
-	Reason string `json:"reason"`
-	Cause  string `json:"cause"`
+	ID        string `json:"id"`
+	Code      string `json:"code"`
+	Reason    string `json:"reason"`
+	Cause     string `json:"cause"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ProblemResponseBody is the RFC 7807 alternative to ErrorResponseBody.
+// ID, Code and RequestID are extension members with the same meaning as in ErrorResponseBody.
+type ProblemResponseBody struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance"`
+	ID        string `json:"id"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Statuses of the application and its dependencies in health responses
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// CheckResponse contains the result of the health check of a dependency
+type CheckResponse struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// HealthResponseBody contains the health of the application, down if any of its dependencies is
+type HealthResponseBody struct {
+	Status string                   `json:"status"`
+	Checks map[string]CheckResponse `json:"checks,omitempty"`
+}
+
+// VersionResponseBody contains the build information of the running application
+type VersionResponseBody struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Codes of the errors detected by the API itself, complementing the codes of domain errors
+const (
+	CodeUnauthorized  = "unauthorized"
+	CodeRateLimited   = "rate_limited"
+	CodeInvalidTenant = "invalid_tenant"
+)
+
+// ProblemJSON is the media type of RFC 7807 problem details, sent instead of ErrorResponseBody to clients accepting it
+const ProblemJSON = "application/problem+json"
+
+// ProblemTypePrefix prefixes the error code in the type of problem details
+const ProblemTypePrefix = "urn:go-diff:problem:"
+
+// errorStatuses maps the codes of domain errors to HTTP statuses
+var errorStatuses = map[domain.ErrorCode]int{
+	domain.CodeNotFound:           404,
+	domain.CodeInvalidPayload:     400,
+	domain.CodeInvalidQuery:       400,
+	domain.CodeTooLarge:           413,
+	domain.CodeConflict:           409,
+	domain.CodePreconditionFailed: 412,
+	domain.CodeForbidden:          403,
+	domain.CodeQuotaExceeded:      403,
+	domain.CodeStorageUnavailable: 503,
+	domain.CodeTimeout:            504,
+}
+
+var errorReasons = map[domain.ErrorCode]string{
+	domain.CodeNotFound:           "diff not found",
+	domain.CodeInvalidPayload:     "invalid payload",
+	domain.CodeInvalidQuery:       "invalid query",
+	domain.CodeTooLarge:           "payload too large",
+	domain.CodeConflict:           "diff is locked",
+	domain.CodePreconditionFailed: "precondition failed",
+	domain.CodeForbidden:          "forbidden",
+	domain.CodeQuotaExceeded:      "quota exceeded",
+	domain.CodeStorageUnavailable: "storage unavailable",
+	domain.CodeTimeout:            "storage timeout",
+}
+
+// respondError responds with the status and code of a service error.
+// Errors without a known code are internal, reported with the reason of the failed operation.
+func respondError(ctx *gin.Context, id string, err error, failed string) {
+	code := domain.CodeOf(err)
+	status, ok := errorStatuses[code]
+	if !ok {
+		writeError(ctx, 500, &ErrorResponseBody{id, string(domain.CodeInternal), failed, err.Error(), requestIDOf(ctx)})
+		return
+	}
+	writeError(ctx, status, &ErrorResponseBody{id, string(code), errorReasons[code], err.Error(), requestIDOf(ctx)})
+}
+
+// respondSideError is like respondError, reporting missing diffs as missing sides
+func respondSideError(ctx *gin.Context, id string, err error, failed string) {
+	if errors.Is(err, domain.CodeNotFound) {
+		writeError(ctx, 404, &ErrorResponseBody{id, string(domain.CodeNotFound), "side not found", err.Error(), requestIDOf(ctx)})
+		return
+	}
+	respondError(ctx, id, err, failed)
+}
+
+// writeError responds with an error and skips the pending handlers.
+// The error is sent as problem details if the client prefers them to plain JSON.
+func writeError(ctx *gin.Context, status int, body *ErrorResponseBody) {
+	ctx.Abort()
+	addLogFields(ctx, "error_code", body.Code, "error", body.Cause)
+	if ctx.NegotiateFormat(binding.MIMEJSON, ProblemJSON) != ProblemJSON {
+		ctx.JSON(status, body)
+		return
+	}
+	ctx.Render(status, problemRender{&ProblemResponseBody{
+		Type:      ProblemTypePrefix + body.Code,
+		Title:     body.Reason,
+		Status:    status,
+		Detail:    body.Cause,
+		Instance:  ctx.Request.URL.Path,
+		ID:        body.ID,
+		Code:      body.Code,
+		RequestID: body.RequestID,
+	}})
+}
+
+// problemRender renders problem details as JSON with their own media type
+type problemRender struct {
+	problem *ProblemResponseBody
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.problem)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ProblemJSON)
+}
@@ -0,0 +1,207 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestSaveMapsErrorCodes(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		reason string
+	}{
+		{
+			name:   "invalid payload",
+			err:    domain.IllegalDiffPayloadError("payload value is not in base64"),
+			status: 400,
+			code:   "invalid_payload",
+			reason: "invalid payload",
+		},
+		{
+			name:   "too large",
+			err:    domain.PayloadTooLargeError{ID: "1", Side: domain.LeftSide, Limit: 2},
+			status: 413,
+			code:   "too_large",
+			reason: "payload too large",
+		},
+		{
+			name:   "conflict",
+			err:    domain.DiffLockedError{ID: "1"},
+			status: 409,
+			code:   "conflict",
+			reason: "diff is locked",
+		},
+		{
+			name:   "storage unavailable",
+			err:    domain.StorageError{Op: "cannot save payload", Err: errors.New("connection refused")},
+			status: 503,
+			code:   "storage_unavailable",
+			reason: "storage unavailable",
+		},
+		{
+			name:   "timeout",
+			err:    fmt.Errorf("cannot save payload: %w", domain.StorageError{Op: "cannot get session 1 from storage", Err: context.DeadlineExceeded}),
+			status: 504,
+			code:   "timeout",
+			reason: "storage timeout",
+		},
+		{
+			name:   "wrapped domain error",
+			err:    fmt.Errorf("cannot save payload: %w", domain.QuotaExceededError{ID: "1", Reason: "cannot store more than 2 diffs"}),
+			status: 403,
+			code:   "quota_exceeded",
+			reason: "quota exceeded",
+		},
+		{
+			name:   "internal",
+			err:    errors.New("oops"),
+			status: 500,
+			code:   "internal",
+			reason: "save operation failed",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(c.err)
+
+			req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+			req.Header.Set(api.RequestIDHeader, "req-1")
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+			var body api.ErrorResponseBody
+			json.Unmarshal(w.Body.Bytes(), &body)
+			expected := api.ErrorResponseBody{ID: "1", Code: c.code, Reason: c.reason, Cause: c.err.Error(), RequestID: "req-1"}
+			if body != expected {
+				t.Errorf("wrong error response, expected: %+v, got: %+v", expected, body)
+			}
+		})
+
+	}
+}
+
+func TestGetSideReportsMissingSideCode(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().GetSide(gomock.Any(), "1", domain.LeftSide).Return(nil, domain.SideMetadata{}, domain.DiffNotFoundError{ID: "1"})
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/left", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	var body api.ErrorResponseBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != 404 || body.Code != "not_found" || body.Reason != "side not found" {
+		t.Errorf("wrong error response, got: %d, %+v", w.Code, body)
+	}
+}
+
+func TestErrorsAsProblemDetails(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	req, _ := http.NewRequest("POST", "/v1/diff/1/center", strings.NewReader(`{"data": "abc"}`))
+	req.Header.Set("Accept", "application/problem+json, application/json")
+	req.Header.Set(api.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 404 {
+		t.Errorf("wrong status code, expected: 404, got: %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != api.ProblemJSON {
+		t.Errorf("wrong content type, got: %s", contentType)
+	}
+	var body api.ProblemResponseBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON, got: %s", w.Body)
+	}
+	expected := api.ProblemResponseBody{
+		Type:      "urn:go-diff:problem:not_found",
+		Title:     "side not found",
+		Status:    404,
+		Detail:    "invalid side value",
+		Instance:  "/v1/diff/1/center",
+		ID:        "1",
+		Code:      "not_found",
+		RequestID: "req-1",
+	}
+	if body != expected {
+		t.Errorf("wrong problem details, expected: %+v, got: %+v", expected, body)
+	}
+}
+
+func TestErrorsNegotiateFormat(t *testing.T) {
+
+	cases := []struct {
+		accept      string
+		contentType string
+	}{
+		{accept: "", contentType: "application/json; charset=utf-8"},
+		{accept: "*/*", contentType: "application/json; charset=utf-8"},
+		{accept: "application/json", contentType: "application/json; charset=utf-8"},
+		{accept: "application/problem+json", contentType: api.ProblemJSON},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.accept, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{}, domain.DiffNotFoundError{ID: "1"})
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+			req.Header.Set("Accept", c.accept)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 404 {
+				t.Errorf("wrong status code, expected: 404, got: %d", w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != c.contentType {
+				t.Errorf("wrong content type, expected: %s, got: %s", c.contentType, contentType)
+			}
+		})
+
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+
+	"github.com/ehpalumbo/go-diff/buildinfo"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthCheck reports details about a dependency, failing while it is unhealthy
+type HealthCheck func(ctx context.Context) (details interface{}, err error)
+
+// WithHealthChecks returns a copy of the Application that is only ready while every check passes
+func (app Application) WithHealthChecks(checks map[string]HealthCheck) Application {
+	app.healthChecks = checks
+	return app
+}
+
+// live responds as long as the application is able to serve requests at all
+func (app Application) live(ctx *gin.Context) {
+	ctx.JSON(200, HealthResponseBody{Status: HealthUp})
+}
+
+// ready responds with the result of every health check, as unavailable if any of them fails
+func (app Application) ready(ctx *gin.Context) {
+	body := HealthResponseBody{Status: HealthUp, Checks: make(map[string]CheckResponse, len(app.healthChecks))}
+	for name, check := range app.healthChecks {
+		details, err := check(ctx.Request.Context())
+		result := CheckResponse{Status: HealthUp, Details: details}
+		if err != nil {
+			body.Status = HealthDown
+			result.Status = HealthDown
+			result.Error = err.Error()
+		}
+		body.Checks[name] = result
+	}
+	status := 200
+	if body.Status == HealthDown {
+		status = 503
+	}
+	ctx.JSON(status, body)
+}
+
+// version responds with the build information of the running binary
+func (app Application) version(ctx *gin.Context) {
+	info := buildinfo.Get()
+	ctx.JSON(200, VersionResponseBody{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+	})
+}
@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func TestReadinessReportsDependencies(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		health string
+	}{
+		{name: "up", status: 200, health: api.HealthUp},
+		{name: "down", err: errors.New("circuit breaker is open"), status: 503, health: api.HealthDown},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// given
+			router := api.NewApplication(nil).WithHealthChecks(map[string]api.HealthCheck{
+				"repository": func(context.Context) (interface{}, error) {
+					return map[string]string{"state": "closed"}, c.err
+				},
+			}).GetRouter()
+			req, _ := http.NewRequest("GET", "/readyz", nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.status {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.status, w.Code)
+			}
+			var body api.HealthResponseBody
+			json.Unmarshal(w.Body.Bytes(), &body)
+			repository := body.Checks["repository"]
+			if body.Status != c.health || repository.Status != c.health || repository.Details == nil {
+				t.Errorf("wrong health response, got: %s", w.Body)
+			}
+			if c.err != nil && repository.Error != c.err.Error() {
+				t.Errorf("wrong check error, got: %s", repository.Error)
+			}
+		})
+	}
+}
+
+func TestOperationalEndpointsWithoutChecks(t *testing.T) {
+
+	cases := []struct {
+		path  string
+		check func(t *testing.T, body []byte)
+	}{
+		{path: "/healthz", check: func(t *testing.T, body []byte) {
+			var health api.HealthResponseBody
+			json.Unmarshal(body, &health)
+			if health.Status != api.HealthUp {
+				t.Errorf("wrong liveness response, got: %s", body)
+			}
+		}},
+		{path: "/readyz", check: func(t *testing.T, body []byte) {
+			var health api.HealthResponseBody
+			json.Unmarshal(body, &health)
+			if health.Status != api.HealthUp || len(health.Checks) != 0 {
+				t.Errorf("wrong readiness response, got: %s", body)
+			}
+		}},
+		{path: "/version", check: func(t *testing.T, body []byte) {
+			var version api.VersionResponseBody
+			json.Unmarshal(body, &version)
+			if version.Version == "" || version.GoVersion != runtime.Version() {
+				t.Errorf("wrong version response, got: %s", body)
+			}
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+
+			// given
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			authenticator := mocks.NewMockAuthenticator(ctrl)
+			router := api.NewApplication(nil).WithAuthenticator(authenticator).GetRouter()
+			req, _ := http.NewRequest("GET", c.path, nil)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 200 {
+				t.Errorf("wrong status code, expected: 200, got: %d", w.Code)
+			}
+			c.check(t, w.Body.Bytes())
+		})
+	}
+}
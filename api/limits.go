@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMetadataBytes is the allowance for the JSON fields of an upload other than its base64 data
+const maxMetadataBytes = 64 << 10
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// WithSizeLimits returns a copy of the Application that rejects upload bodies
+// that cannot fit the limits while streaming them, before they are fully read.
+// The service enforces the exact limits on the decoded data.
+func (app Application) WithSizeLimits(l domain.SizeLimits) Application {
+	app.limits = l
+	return app
+}
+
+// limitBody bounds the upload body to what a payload within the limits may take once base64-encoded.
+// It responds with 413 and returns false if the declared length is already over the bound.
+func (app Application) limitBody(ctx *gin.Context, id string) bool {
+	max := app.limits.MaxPayloadBytes()
+	if max <= 0 {
+		return true
+	}
+	bound := 4*((max+2)/3) + maxMetadataBytes
+	if ctx.Request.ContentLength > bound {
+		payloadTooLarge(ctx, id, errBodyTooLarge)
+		return false
+	}
+	ctx.Request.Body = &limitedBody{ctx.Request.Body, bound}
+	return true
+}
+
+func payloadTooLarge(ctx *gin.Context, id string, err error) {
+	writeError(ctx, 413, &ErrorResponseBody{id, string(domain.CodeTooLarge), "payload too large", err.Error(), requestIDOf(ctx)})
+}
+
+// limitedBody reads up to a number of bytes, failing with errBodyTooLarge past them
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// check whether the body ends right at the limit
+		var probe [1]byte
+		if n, err := b.body.Read(probe[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
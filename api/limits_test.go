@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestSaveRejectsBodiesOverSizeLimits(t *testing.T) {
+
+	limits := domain.SizeLimits{MaxSideBytes: 3, MaxDiffBytes: 5}
+	// base64 data over the limits, in a body over the metadata allowance
+	oversized := `{"data": "` + strings.Repeat("A", 70<<10) + `"}`
+
+	cases := []struct {
+		name          string
+		body          string
+		contentLength int64
+	}{
+		{name: "declared length over limits", body: oversized, contentLength: int64(len(oversized))},
+		{name: "streamed body over limits", body: oversized, contentLength: -1},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			router := api.NewApplication(svcMock).WithSizeLimits(limits).GetRouter()
+			req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(c.body))
+			req.ContentLength = c.contentLength
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 413 {
+				t.Errorf("wrong status code, expected: 413, got: %d", w.Code)
+			}
+			var body api.ErrorResponseBody
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.ID != "1" || body.Reason != "payload too large" {
+				t.Errorf("wrong error response, got: %+v", body)
+			}
+		})
+
+	}
+}
+
+func TestSaveAcceptsBodiesWithinSizeLimits(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	router := api.NewApplication(svcMock).WithSizeLimits(domain.SizeLimits{MaxSideBytes: 3}).GetRouter()
+	svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "YWJj", "filename": "`+strings.Repeat("a", 60<<10)+`"}`))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("wrong status code, expected: 204, got: %d", w.Code)
+	}
+}
+
+func TestSaveRespondsPayloadTooLarge(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(domain.PayloadTooLargeError{ID: "1", Side: domain.LeftSide, Limit: 5})
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 413 {
+		t.Errorf("wrong status code, expected: 413, got: %d", w.Code)
+	}
+	var body api.ErrorResponseBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Reason != "payload too large" {
+		t.Errorf("wrong reason in error response, got: %s", body.Reason)
+	}
+}
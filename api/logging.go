@@ -0,0 +1,128 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader identifies each request, taken from the client when valid and generated otherwise,
+// and is echoed in every response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// operationalRoutes are polled by orchestrators and scrapers rather than requested by clients
+var operationalRoutes = map[string]bool{"/healthz": true, "/readyz": true, "/version": true, "/metrics": true}
+
+const (
+	requestIDKey = "requestID"
+	logFieldsKey = "logFields"
+)
+
+// WithLogger returns a copy of the Application that logs every request with the logger
+func (app Application) WithLogger(l *logging.Logger) Application {
+	app.logger = l
+	return app
+}
+
+// logRequests is a middleware that identifies requests and logs each one once handled,
+// along with the fields added by handlers. Requests to operational endpoints are only logged at debug level.
+func (app Application) logRequests(ctx *gin.Context) {
+	start := time.Now()
+	id := ctx.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx.Set(requestIDKey, id)
+	ctx.Header(RequestIDHeader, id)
+
+	ctx.Next()
+
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := ctx.Writer.Status()
+	args := []interface{}{
+		"request_id", id,
+		"method", ctx.Request.Method,
+		"route", route,
+		"path", ctx.Request.URL.Path,
+		"status", status,
+		"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+		"client_ip", clientIP(ctx),
+	}
+	if diffID := ctx.Param("id"); diffID != "" {
+		args = append(args, "diff_id", diffID)
+	}
+	if side := ctx.Param("side"); side != "" {
+		args = append(args, "side", side)
+	}
+	if fields, ok := ctx.Get(logFieldsKey); ok {
+		args = append(args, fields.([]interface{})...)
+	}
+
+	level := logging.LevelInfo
+	switch {
+	case status >= 500:
+		level = logging.LevelError
+	case operationalRoutes[route]:
+		level = logging.LevelDebug
+	}
+	app.logger.Log(level, "request handled", args...)
+}
+
+// recoverPanic responds to requests whose handlers panicked as internal errors, logging the panic with them
+func recoverPanic(ctx *gin.Context, recovered interface{}) {
+	addLogFields(ctx, "panic", fmt.Sprint(recovered))
+	writeError(ctx, 500, &ErrorResponseBody{ctx.Param("id"), string(domain.CodeInternal), "internal error", "unexpected failure", requestIDOf(ctx)})
+}
+
+// addLogFields adds key-value pairs to the log record of the request
+func addLogFields(ctx *gin.Context, args ...interface{}) {
+	fields, _ := ctx.Get(logFieldsKey)
+	existing, _ := fields.([]interface{})
+	ctx.Set(logFieldsKey, append(existing, args...))
+}
+
+// requestIDOf returns the ID of the request, empty if it is not identified
+func requestIDOf(ctx *gin.Context) string {
+	return ctx.GetString(requestIDKey)
+}
+
+// validRequestID tells whether a request ID from a client is short and made of printable ASCII only,
+// so that it is safe to echo and to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID of 32 hex digits
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// decodedLen returns the length of the data encoded as padded base64
+func decodedLen(encoded string) int {
+	n := len(encoded) / 4 * 3
+	for i := len(encoded) - 1; i >= 0 && i >= len(encoded)-2 && encoded[i] == '='; i-- {
+		n--
+	}
+	return n
+}
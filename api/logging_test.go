@@ -0,0 +1,153 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/logging"
+	"github.com/golang/mock/gomock"
+)
+
+// logRecords parses the JSON lines of a log
+func logRecords(t *testing.T, log string) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(log, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestIDIsEchoedOrGenerated(t *testing.T) {
+
+	generated := regexp.MustCompile("^[0-9a-f]{32}$")
+	cases := []struct {
+		name      string
+		requestID string
+		echoed    bool
+	}{
+		{"from client", "6f1c2d4e-req", true},
+		{"missing", "", false},
+		{"with spaces", "my request", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// given
+			router := api.NewApplication(nil).WithLogger(logging.New(&strings.Builder{}, logging.LevelInfo)).GetRouter()
+			req, _ := http.NewRequest("GET", "/healthz", nil)
+			if c.requestID != "" {
+				req.Header.Set(api.RequestIDHeader, c.requestID)
+			}
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			requestID := w.Header().Get(api.RequestIDHeader)
+			if c.echoed && requestID != c.requestID {
+				t.Errorf("should have echoed %q, got: %q", c.requestID, requestID)
+			}
+			if !c.echoed && !generated.MatchString(requestID) {
+				t.Errorf("should have generated a request ID, got: %q", requestID)
+			}
+		})
+	}
+}
+
+func TestRequestsAreLoggedWithDiffFields(t *testing.T) {
+
+	// given
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	svc := mocks.NewMockDiffService(ctrl)
+	var b strings.Builder
+	router := api.NewApplication(svc).WithLogger(logging.New(&b, logging.LevelInfo)).GetRouter()
+
+	svc.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+	svc.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{Result: domain.Equal}, nil)
+	svc.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, nil)
+	svc.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, domain.DiffNotFoundError{ID: "1"})
+	svc.EXPECT().Delete(gomock.Any(), "1").Return(errors.New("oops"))
+
+	save, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "YWJjZA=="}`))
+	save.Header.Set(api.RequestIDHeader, "req-1")
+	report, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	remove, _ := http.NewRequest("DELETE", "/v1/diff/1", nil)
+	health, _ := http.NewRequest("GET", "/healthz", nil)
+
+	// when
+	for _, req := range []*http.Request{save, report, remove, health} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// then
+	records := logRecords(t, b.String())
+	if len(records) != 3 {
+		t.Fatalf("should have logged the diff requests only, got: %s", b.String())
+	}
+	expected := []map[string]interface{}{
+		{"level": "INFO", "msg": "request handled", "request_id": "req-1", "method": "POST", "route": "/v1/diff/:id/:side",
+			"path": "/v1/diff/1/left", "status": 204.0, "diff_id": "1", "side": "left", "payload_size": 4.0},
+		{"level": "INFO", "route": "/v1/diff/:id", "status": 200.0, "diff_id": "1", "result": "EQUAL"},
+		{"level": "ERROR", "method": "DELETE", "status": 500.0, "diff_id": "1", "error_code": "internal", "error": "oops"},
+	}
+	for i, fields := range expected {
+		for key, value := range fields {
+			if records[i][key] != value {
+				t.Errorf("record %d: %s should be %v, got: %v", i, key, value, records[i][key])
+			}
+		}
+		if _, ok := records[i]["latency_ms"]; !ok {
+			t.Errorf("record %d: missing latency", i)
+		}
+	}
+}
+
+func TestPanicsAreRecoveredAsInternalErrors(t *testing.T) {
+
+	// given
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	svc := mocks.NewMockDiffService(ctrl)
+	var b strings.Builder
+	router := api.NewApplication(svc).WithLogger(logging.New(&b, logging.LevelInfo)).GetRouter()
+
+	svc.EXPECT().GetDiffReport(gomock.Any(), "1").DoAndReturn(func(interface{}, string) (domain.DiffReport, error) {
+		panic("nil map")
+	})
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.Header.Set(api.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	var body api.ErrorResponseBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	expected := api.ErrorResponseBody{ID: "1", Code: "internal", Reason: "internal error", Cause: "unexpected failure", RequestID: "req-1"}
+	if w.Code != 500 || body != expected {
+		t.Errorf("wrong error response, got: %d, %+v", w.Code, body)
+	}
+	records := logRecords(t, b.String())
+	if len(records) != 1 || records[0]["level"] != "ERROR" || records[0]["panic"] != "nil map" {
+		t.Errorf("should have logged the panic, got: %s", b.String())
+	}
+}
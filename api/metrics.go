@@ -0,0 +1,29 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// WithMetrics returns a copy of the Application that measures the count and latency of requests by route and status
+func (app Application) WithMetrics(registry *metrics.Registry) Application {
+	app.requests = registry.Histogram("godiff_http_request_duration_seconds",
+		"Latency of HTTP requests by route, method and status.",
+		metrics.Seconds, metrics.DefBuckets, "route", "method", "status")
+	return app
+}
+
+// instrument is a middleware that measures requests once they are handled.
+// Routes are the matched path patterns, so that IDs do not end up in metrics.
+func (app Application) instrument(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	app.requests.Observe(time.Since(start).Seconds(), route, ctx.Request.Method, strconv.Itoa(ctx.Writer.Status()))
+}
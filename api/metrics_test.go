@@ -0,0 +1,36 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/metrics"
+)
+
+func TestMetricsMeasureRequestsByRoute(t *testing.T) {
+
+	// given
+	registry := metrics.NewRegistry()
+	router := api.NewApplication(nil).WithMetrics(registry).GetRouter()
+
+	// when
+	for _, path := range []string{"/healthz", "/healthz", "/v2/diff/1"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// then
+	var b strings.Builder
+	registry.WriteText(&b)
+	for _, sample := range []string{
+		`godiff_http_request_duration_seconds_count{method="GET",route="/healthz",status="200"} 2`,
+		`godiff_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(b.String(), sample) {
+			t.Errorf("missing sample %s, got:\n%s", sample, b.String())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter decides whether the client identified by a key may make another request.
+// Implementations backed by a shared store may fail, in which case requests are let through.
+type RateLimiter interface {
+	Allow(key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// WithRateLimits returns a copy of the Application that limits the requests of each client,
+// with separate limits for uploads and deletions and for reports and downloads. Nil limiters do not limit.
+func (app Application) WithRateLimits(uploads, reports RateLimiter) Application {
+	app.uploadLimiter = uploads
+	app.reportLimiter = reports
+	return app
+}
+
+// rateLimitClient is a middleware that rejects requests over the limit of the client IP.
+// It runs before authentication, so that credentials cannot be guessed without limit.
+func (app Application) rateLimitClient(ctx *gin.Context) {
+	app.rateLimit(ctx, "ip:"+clientIP(ctx))
+}
+
+// rateLimitCaller is a middleware that rejects requests over the limit of the authenticated caller, if any,
+// so that callers cannot go over their limit by spreading their requests over several IPs
+func (app Application) rateLimitCaller(ctx *gin.Context) {
+	if caller, ok := identityOf(ctx); ok {
+		app.rateLimit(ctx, "caller:"+caller.Tenant.Scope(caller.Subject))
+	}
+}
+
+// rateLimit rejects the request if it is over the limit of the client identified by the key
+func (app Application) rateLimit(ctx *gin.Context, key string) {
+	limiter := app.uploadLimiter
+	if ctx.Request.Method == "GET" || ctx.Request.Method == "HEAD" {
+		limiter = app.reportLimiter
+	}
+	if limiter == nil {
+		return
+	}
+
+	allowed, retryAfter, err := limiter.Allow(key)
+	if err != nil || allowed {
+		return
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	ctx.Header("Retry-After", strconv.Itoa(seconds))
+	reason := fmt.Sprintf("rate limit exceeded, retry in %d seconds", seconds)
+	writeError(ctx, 429, &ErrorResponseBody{ctx.Param("id"), CodeRateLimited, "too many requests", reason, requestIDOf(ctx)})
+}
+
+// clientIP returns the IP of the client, as seen by API Gateway in Lambda and by the connection otherwise.
+// Forwarding headers like X-Forwarded-For are never trusted, since any client can set them.
+func clientIP(ctx *gin.Context) string {
+	if gateway, ok := core.GetAPIGatewayContextFromContext(ctx.Request.Context()); ok && gateway.Identity.SourceIP != "" {
+		return gateway.Identity.SourceIP
+	}
+	if ip, _ := ctx.RemoteIP(); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
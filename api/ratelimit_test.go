@@ -0,0 +1,210 @@
+//go:generate mockgen -destination mocks/ratelimiter_mock.go -package=mocks . RateLimiter
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func setUpRateLimited(t *testing.T) (*mocks.MockRateLimiter, *mocks.MockRateLimiter, http.Handler) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+	svcMock = mocks.NewMockDiffService(ctrl)
+	uploads := mocks.NewMockRateLimiter(ctrl)
+	reports := mocks.NewMockRateLimiter(ctrl)
+	router := api.NewApplication(svcMock).WithRateLimits(uploads, reports).GetRouter()
+	return uploads, reports, router
+}
+
+func TestRateLimitRejectsRequestsOverLimit(t *testing.T) {
+	uploads, _, router := setUpRateLimited(t)
+
+	// given
+	uploads.EXPECT().Allow("ip:192.0.2.1").Return(false, 1500*time.Millisecond, nil)
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 429 {
+		t.Errorf("wrong status code, expected: 429, got: %d", w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("wrong Retry-After header, got: %s", retryAfter)
+	}
+	var body struct {
+		ID     string `json:"id"`
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.ID != "1" || body.Reason != "too many requests" {
+		t.Errorf("wrong error response, got: %s", w.Body)
+	}
+}
+
+func TestRateLimitUsesLimiterOfRoute(t *testing.T) {
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		upload  bool
+		expect  func()
+		success int
+	}{
+		{name: "upload", method: "POST", path: "/v1/diff/1/left", body: `{"data": "abc"}`, upload: true, success: 204, expect: func() {
+			svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+		}},
+		{name: "delete", method: "DELETE", path: "/v1/diff/1", upload: true, success: 204, expect: func() {
+			svcMock.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+		}},
+		{name: "report", method: "GET", path: "/v1/diff/1", success: 200, expect: func() {
+			svcMock.EXPECT().GetDiffReport(gomock.Any(), "1").Return(domain.DiffReport{Result: domain.Equal}, nil)
+			svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, nil)
+			svcMock.EXPECT().GetSession(gomock.Any(), "1").Return(domain.DiffSession{}, domain.DiffNotFoundError{ID: "1"})
+		}},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			uploads, reports, router := setUpRateLimited(t)
+
+			// given
+			limiter := reports
+			if c.upload {
+				limiter = uploads
+			}
+			limiter.EXPECT().Allow(gomock.Any()).Return(true, time.Duration(0), nil)
+			c.expect()
+
+			req, _ := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != c.success {
+				t.Errorf("wrong status code, expected: %d, got: %d", c.success, w.Code)
+			}
+		})
+
+	}
+}
+
+func TestRateLimitKeysAuthenticatedCallers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// given
+	authenticator := mocks.NewMockAuthenticator(ctrl)
+	reports := mocks.NewMockRateLimiter(ctrl)
+	router := api.NewMultiTenantApplication(func(domain.Identity) (api.DiffService, error) {
+		return nil, nil
+	}).WithAuthenticator(authenticator).WithRateLimits(nil, reports).GetRouter()
+
+	gomock.InOrder(
+		reports.EXPECT().Allow("ip:192.0.2.1").Return(true, time.Duration(0), nil),
+		authenticator.EXPECT().Authenticate(gomock.Any()).Return(domain.Identity{Subject: "ci", Tenant: domain.Tenant("acme")}, nil),
+		reports.EXPECT().Allow("caller:acme/ci").Return(false, time.Second, nil),
+	)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 429 {
+		t.Errorf("wrong status code, expected: 429, got: %d", w.Code)
+	}
+}
+
+func TestRateLimitAppliesBeforeAuthentication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// given
+	authenticator := mocks.NewMockAuthenticator(ctrl)
+	reports := mocks.NewMockRateLimiter(ctrl)
+	router := api.NewMultiTenantApplication(func(domain.Identity) (api.DiffService, error) {
+		return nil, nil
+	}).WithAuthenticator(authenticator).WithRateLimits(nil, reports).GetRouter()
+
+	// credentials are not even checked once the client is over its limit
+	reports.EXPECT().Allow("ip:192.0.2.1").Return(false, time.Second, nil)
+	authenticator.EXPECT().Authenticate(gomock.Any()).Times(0)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Authorization", "Bearer guess")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 429 {
+		t.Errorf("wrong status code, expected: 429, got: %d", w.Code)
+	}
+}
+
+func TestRateLimitIgnoresForwardingHeaders(t *testing.T) {
+	uploads, _, router := setUpRateLimited(t)
+
+	// given
+	uploads.EXPECT().Allow("ip:192.0.2.1").Return(false, time.Second, nil).Times(2)
+
+	for _, forwarded := range []string{"203.0.113.1", "203.0.113.2"} {
+		req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		req.Header.Set("X-Real-IP", forwarded)
+		w := httptest.NewRecorder()
+
+		// when
+		router.ServeHTTP(w, req)
+
+		// then
+		if w.Code != 429 {
+			t.Errorf("wrong status code, expected: 429, got: %d", w.Code)
+		}
+	}
+}
+
+func TestRateLimitLetsRequestsThroughOnLimiterFailure(t *testing.T) {
+	_, reports, router := setUpRateLimited(t)
+
+	// given
+	reports.EXPECT().Allow(gomock.Any()).Return(false, time.Duration(0), errors.New("store unavailable"))
+	svcMock.EXPECT().GetMetadata(gomock.Any(), "1").Return(nil, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1/meta", nil)
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 200 {
+		t.Errorf("wrong status code, expected: 200, got: %d", w.Code)
+	}
+}
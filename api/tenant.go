@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader is the request header naming the tenant that owns the requested diffs
+const TenantHeader = "X-Tenant-ID"
+
+// Services provides the service acting on behalf of a caller, confined to the diffs of its tenant
+type Services func(domain.Identity) (DiffService, error)
+
+// serviceKey is the gin context key of the service resolved for the request
+const serviceKey = "service"
+
+func singleTenant(s DiffService) Services {
+	return func(caller domain.Identity) (DiffService, error) {
+		if caller.Tenant != domain.DefaultTenant {
+			return nil, errors.New("tenants are not supported")
+		}
+		return s, nil
+	}
+}
+
+// resolveTenant is a middleware that picks the service of the caller.
+// Authenticated callers belong to the tenant of their identity, which the tenant header can only repeat;
+// anonymous callers act on behalf of the tenant named in the header.
+func (app Application) resolveTenant(ctx *gin.Context) {
+	id := ctx.Param("id")
+	tenant, err := domain.ParseTenant(ctx.GetHeader(TenantHeader))
+	if err != nil {
+		writeError(ctx, 400, &ErrorResponseBody{id, CodeInvalidTenant, "invalid tenant", err.Error(), requestIDOf(ctx)})
+		return
+	}
+
+	caller, authenticated := identityOf(ctx)
+	if !authenticated {
+		caller = domain.Identity{Tenant: tenant}
+	} else if ctx.GetHeader(TenantHeader) != "" && tenant != caller.Tenant {
+		reason := fmt.Sprintf("caller %s cannot access tenant %s", caller.Subject, tenant)
+		writeError(ctx, 403, &ErrorResponseBody{id, string(domain.CodeForbidden), "forbidden", reason, requestIDOf(ctx)})
+		return
+	}
+
+	s, err := app.services(caller)
+	if err != nil {
+		writeError(ctx, 400, &ErrorResponseBody{id, CodeInvalidTenant, "invalid tenant", err.Error(), requestIDOf(ctx)})
+		return
+	}
+	ctx.Set(serviceKey, s)
+}
+
+func serviceOf(ctx *gin.Context) DiffService {
+	return ctx.MustGet(serviceKey).(DiffService)
+}
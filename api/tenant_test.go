@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestMultiTenantApplicationUsesServiceOfTenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// given
+	acme := mocks.NewMockDiffService(ctrl)
+	var resolved domain.Tenant
+	router := api.NewMultiTenantApplication(func(caller domain.Identity) (api.DiffService, error) {
+		resolved = caller.Tenant
+		return acme, nil
+	}).GetRouter()
+	acme.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/v1/diff/1", nil)
+	req.Header.Set(api.TenantHeader, "acme")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 204 {
+		t.Errorf("wrong status code, expected: 204, got: %d", w.Code)
+	}
+	if resolved != domain.Tenant("acme") {
+		t.Errorf("wrong tenant, got: %s", resolved)
+	}
+}
+
+func TestTenantRejections(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		tenant   string
+		services api.Services
+	}{
+		{
+			name:   "invalid tenant",
+			tenant: "Not/Valid",
+			services: func(domain.Identity) (api.DiffService, error) {
+				return nil, nil
+			},
+		},
+		{
+			name:   "unknown tenant",
+			tenant: "acme",
+			services: func(domain.Identity) (api.DiffService, error) {
+				return nil, errors.New("unknown tenant")
+			},
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			router := api.NewMultiTenantApplication(c.services).GetRouter()
+
+			req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+			req.Header.Set(api.TenantHeader, c.tenant)
+			w := httptest.NewRecorder()
+
+			// when
+			router.ServeHTTP(w, req)
+
+			// then
+			if w.Code != 400 {
+				t.Errorf("wrong status code, expected: 400, got: %d", w.Code)
+			}
+			var body struct {
+				ID     string `json:"id"`
+				Reason string `json:"reason"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.ID != "1" || body.Reason != "invalid tenant" {
+				t.Errorf("wrong error response, got: %s", w.Body)
+			}
+		})
+
+	}
+}
+
+func TestSingleTenantApplicationRejectsTenants(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.Header.Set(api.TenantHeader, "acme")
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 400 {
+		t.Errorf("wrong status code, expected: 400, got: %d", w.Code)
+	}
+}
+
+func TestSaveRespondsForbiddenWhenQuotaIsExceeded(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	svcMock.EXPECT().Save(gomock.Any(), gomock.Any()).Return(domain.QuotaExceededError{ID: "1", Reason: "cannot store more than 2 diffs"})
+
+	req, _ := http.NewRequest("POST", "/v1/diff/1/left", strings.NewReader(`{"data": "abc"}`))
+	w := httptest.NewRecorder()
+
+	// when
+	router.ServeHTTP(w, req)
+
+	// then
+	if w.Code != 403 {
+		t.Errorf("wrong status code, expected: 403, got: %d", w.Code)
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Reason != "quota exceeded" {
+		t.Errorf("wrong reason in error response, got: %s", body.Reason)
+	}
+}
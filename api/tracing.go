@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ehpalumbo/go-diff/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// WithTracer returns a copy of the Application that traces every request,
+// continuing the trace of the caller given by the W3C traceparent header
+func (app Application) WithTracer(t *tracing.Tracer) Application {
+	app.tracer = t
+	return app
+}
+
+// trace is a middleware that handles requests within a server span, named after the matched route
+func (app Application) trace(ctx *gin.Context) {
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	parent := tracing.Extract(ctx.Request.Context(), ctx.Request.Header)
+	traced, span := app.tracer.Start(parent, ctx.Request.Method+" "+route, tracing.KindServer,
+		tracing.String("http.method", ctx.Request.Method),
+		tracing.String("http.route", route),
+		tracing.String("http.target", ctx.Request.URL.Path))
+	defer span.End()
+	ctx.Request = ctx.Request.WithContext(traced)
+
+	ctx.Next()
+
+	status := ctx.Writer.Status()
+	span.SetAttributes(tracing.Int("http.status_code", status))
+	if status >= 500 {
+		span.SetError(errors.New(http.StatusText(status)))
+	}
+}
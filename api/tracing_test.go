@@ -0,0 +1,57 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/tracing"
+	"github.com/golang/mock/gomock"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingContinuesTraceOfCaller(t *testing.T) {
+
+	// given
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	svc := mocks.NewMockDiffService(ctrl)
+	var b strings.Builder
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&b), "go-diff")
+	router := api.NewApplication(svc).WithTracer(tracer).GetRouter()
+
+	var traced trace.SpanContext
+	svc.EXPECT().GetDiffReport(gomock.Any(), "1").DoAndReturn(func(ctx context.Context, _ string) (domain.DiffReport, error) {
+		traced = tracing.SpanFromContext(ctx).SpanContext()
+		return domain.DiffReport{}, errors.New("oops")
+	})
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// when
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Shutdown(context.Background())
+
+	// then
+	if traced.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("service not called within the trace of the caller, got: %v", traced.TraceID())
+	}
+	for _, field := range []string{
+		`"name":"GET /v1/diff/:id"`,
+		`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"span_id":"` + traced.SpanID().String() + `"`,
+		`"parent_span_id":"00f067aa0ba902b7"`,
+		`"http.status_code":500`,
+		`"status":"Error"`,
+	} {
+		if !strings.Contains(b.String(), field) {
+			t.Errorf("missing %s in span, got: %s", field, b.String())
+		}
+	}
+}
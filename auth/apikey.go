@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// APIKeyHeader is the request header carrying static API keys
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator authenticates callers by static API keys.
+// Only the SHA-256 digests of the keys are kept, so the configuration holds no secrets.
+type APIKeyAuthenticator struct {
+	identities map[string]domain.Identity
+}
+
+// NewAPIKeyAuthenticator creates a new APIKeyAuthenticator from the identities of each hex-encoded SHA-256 key digest
+func NewAPIKeyAuthenticator(identities map[string]domain.Identity) *APIKeyAuthenticator {
+	normalized := make(map[string]domain.Identity, len(identities))
+	for digest, identity := range identities {
+		normalized[strings.ToLower(digest)] = identity
+	}
+	return &APIKeyAuthenticator{normalized}
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 digest under which an API key is configured
+func HashAPIKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+// Authenticate returns the identity of the API key in the request
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (domain.Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return domain.Identity{}, ErrNoCredentials
+	}
+	identity, ok := a.identities[HashAPIKey(key)]
+	if !ok {
+		return domain.Identity{}, InvalidCredentialsError("unknown API key")
+	}
+	return identity, nil
+}
@@ -0,0 +1,39 @@
+// Package auth provides the authenticators of API callers, from static API keys and JWT bearer tokens
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// ErrNoCredentials is returned when a request carries none of the credentials an authenticator accepts
+var ErrNoCredentials = errors.New("no credentials")
+
+// InvalidCredentialsError is returned when a request carries credentials that cannot be trusted
+type InvalidCredentialsError string
+
+func (err InvalidCredentialsError) Error() string {
+	return "invalid credentials: " + string(err)
+}
+
+// Authenticator maps the credentials of a request to the identity of the caller
+type Authenticator interface {
+	Authenticate(*http.Request) (domain.Identity, error)
+}
+
+// Chain is an Authenticator that tries each authenticator in order until one finds credentials
+type Chain []Authenticator
+
+// Authenticate returns the identity from the first authenticator whose credentials are present.
+// Invalid credentials fail right away instead of falling through to the next authenticator.
+func (c Chain) Authenticate(r *http.Request) (domain.Identity, error) {
+	for _, a := range c {
+		identity, err := a.Authenticate(r)
+		if err != ErrNoCredentials {
+			return identity, err
+		}
+	}
+	return domain.Identity{}, ErrNoCredentials
+}
@@ -0,0 +1,76 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/auth"
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	ci := domain.Identity{Subject: "ci", Tenant: domain.Tenant("acme")}
+	authenticator := auth.NewAPIKeyAuthenticator(map[string]domain.Identity{auth.HashAPIKey("s3cr3t"): ci})
+
+	cases := []struct {
+		name     string
+		key      string
+		expected domain.Identity
+		err      error
+	}{
+		{name: "known key", key: "s3cr3t", expected: ci},
+		{name: "unknown key", key: "guess", err: auth.InvalidCredentialsError("unknown API key")},
+		{name: "no key", err: auth.ErrNoCredentials},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+			if c.key != "" {
+				req.Header.Set(auth.APIKeyHeader, c.key)
+			}
+
+			// when
+			identity, err := authenticator.Authenticate(req)
+
+			// then
+			if err != c.err {
+				t.Errorf("wrong error, expected: %v, got: %v", c.err, err)
+			}
+			if identity != c.expected {
+				t.Errorf("wrong identity, expected: %v, got: %v", c.expected, identity)
+			}
+		})
+
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	expected := "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+	if digest := auth.HashAPIKey("secret"); digest != expected {
+		t.Errorf("wrong digest, got: %s", digest)
+	}
+}
+
+func TestChainUsesFirstAuthenticatorWithCredentials(t *testing.T) {
+	apiKeys := auth.NewAPIKeyAuthenticator(map[string]domain.Identity{auth.HashAPIKey("s3cr3t"): {Subject: "ci"}})
+	tokens := auth.NewJWTAuthenticator(auth.JWTConfig{Secret: []byte("key")})
+	chain := auth.Chain{apiKeys, tokens}
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	if _, err := chain.Authenticate(req); err != auth.ErrNoCredentials {
+		t.Errorf("wrong error without credentials, got: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer not.a.token")
+	if _, err := chain.Authenticate(req); err == nil || err == auth.ErrNoCredentials {
+		t.Errorf("invalid token did not fail, got: %v", err)
+	}
+
+	req.Header.Set(auth.APIKeyHeader, "s3cr3t")
+	if identity, err := chain.Authenticate(req); err != nil || identity.Subject != "ci" {
+		t.Errorf("wrong identity, got: %v, %v", identity, err)
+	}
+}
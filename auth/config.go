@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// Config is the JSON configuration of the accepted credentials, like:
+//
+//	{
+//	  "api_keys": [{"sha256": "<hex digest of the key>", "subject": "ci", "tenant": "acme"}],
+//	  "jwt": {"hs256_secret": "...", "jwks_file": "jwks.json", "issuer": "...", "audience": "go-diff"}
+//	}
+type Config struct {
+	APIKeys []APIKeyConfig `json:"api_keys"`
+	JWT     *JWTFileConfig `json:"jwt"`
+}
+
+// APIKeyConfig binds the digest of an API key to the identity of its owner
+type APIKeyConfig struct {
+	SHA256  string `json:"sha256"`
+	Subject string `json:"subject"`
+	Tenant  string `json:"tenant"`
+}
+
+// JWTFileConfig is the JSON configuration of JWT bearer tokens.
+// A relative JWKS file is resolved from the directory of the configuration file.
+type JWTFileConfig struct {
+	HS256Secret   string `json:"hs256_secret"`
+	JWKSFile      string `json:"jwks_file"`
+	Issuer        string `json:"issuer"`
+	Audience      string `json:"audience"`
+	TenantClaim   string `json:"tenant_claim"`
+	LeewaySeconds int    `json:"leeway_seconds"`
+}
+
+// LoadConfig reads a configuration file and builds the Authenticator of its credentials
+func LoadConfig(path string) (Authenticator, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse auth configuration: %v", err)
+	}
+	return config.Authenticator(filepath.Dir(path))
+}
+
+// Authenticator builds the Authenticator of the configured credentials, API keys first.
+// Relative JWKS files are resolved from dir.
+func (c Config) Authenticator(dir string) (Authenticator, error) {
+	var chain Chain
+
+	if len(c.APIKeys) > 0 {
+		identities := make(map[string]domain.Identity, len(c.APIKeys))
+		for _, k := range c.APIKeys {
+			tenant, err := domain.ParseTenant(k.Tenant)
+			if err != nil || k.SHA256 == "" || k.Subject == "" {
+				return nil, fmt.Errorf("invalid API key configuration for subject %q", k.Subject)
+			}
+			identities[k.SHA256] = domain.Identity{Subject: k.Subject, Tenant: tenant}
+		}
+		chain = append(chain, NewAPIKeyAuthenticator(identities))
+	}
+
+	if c.JWT != nil {
+		config := JWTConfig{
+			Secret:      []byte(c.JWT.HS256Secret),
+			Issuer:      c.JWT.Issuer,
+			Audience:    c.JWT.Audience,
+			TenantClaim: c.JWT.TenantClaim,
+			Leeway:      time.Duration(c.JWT.LeewaySeconds) * time.Second,
+		}
+		if c.JWT.JWKSFile != "" {
+			path := c.JWT.JWKSFile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			keys, err := LoadJWKS(path)
+			if err != nil {
+				return nil, err
+			}
+			config.Keys = keys
+		}
+		if len(config.Secret) == 0 && len(config.Keys) == 0 {
+			return nil, fmt.Errorf("JWT configuration without keys")
+		}
+		chain = append(chain, NewJWTAuthenticator(config))
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("auth configuration without credentials")
+	}
+	return chain, nil
+}
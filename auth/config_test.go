@@ -0,0 +1,112 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/auth"
+)
+
+func writeFile(t *testing.T, dir, name string, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal("cannot serialize test file", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal("cannot write test file", err)
+	}
+	return path
+}
+
+func jwk(kid string) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.PublicKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.PublicKey.E)).Bytes()),
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{
+			jwk("key-1"),
+			map[string]string{"kty": "EC", "kid": "key-2", "crv": "P-256"},
+			map[string]string{"kty": "RSA", "kid": "key-3", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	})
+
+	keys, err := auth.ParseJWKS(b)
+
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if len(keys) != 1 || keys["key-1"] == nil || !keys["key-1"].Equal(&rsaKey.PublicKey) {
+		t.Errorf("wrong keys, got: %v", keys)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	writeFile(t, dir, "jwks.json", map[string]interface{}{"keys": []interface{}{jwk("")}})
+	path := writeFile(t, dir, "auth.json", map[string]interface{}{
+		"api_keys": []map[string]string{{"sha256": auth.HashAPIKey("s3cr3t"), "subject": "ci", "tenant": "acme"}},
+		"jwt":      map[string]string{"jwks_file": "jwks.json", "audience": "go-diff"},
+	})
+
+	// when
+	authenticator, err := auth.LoadConfig(path)
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.Header.Set(auth.APIKeyHeader, "s3cr3t")
+	if identity, err := authenticator.Authenticate(req); err != nil || identity.Subject != "ci" || identity.Tenant != "acme" {
+		t.Errorf("wrong API key identity, got: %v, %v", identity, err)
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/diff/1", nil)
+	claims := map[string]interface{}{"sub": "alice", "aud": "go-diff", "exp": time.Now().Add(time.Hour).Unix()}
+	req.Header.Set("Authorization", "Bearer "+token(t, map[string]interface{}{"alg": "RS256"}, claims, rsaKey))
+	if identity, err := authenticator.Authenticate(req); err != nil || identity.Subject != "alice" {
+		t.Errorf("wrong token identity, got: %v, %v", identity, err)
+	}
+}
+
+func TestLoadConfigRejectsInvalidConfigurations(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{name: "no credentials", config: map[string]interface{}{}},
+		{name: "API key without digest", config: map[string]interface{}{"api_keys": []map[string]string{{"subject": "ci"}}}},
+		{name: "API key with invalid tenant", config: map[string]interface{}{"api_keys": []map[string]string{{"sha256": "abc", "subject": "ci", "tenant": "Not/Valid"}}}},
+		{name: "JWT without keys", config: map[string]interface{}{"jwt": map[string]string{"issuer": "issuer"}}},
+		{name: "missing JWKS file", config: map[string]interface{}{"jwt": map[string]string{"jwks_file": "missing.json"}}},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), "auth.json", c.config)
+
+			if _, err := auth.LoadConfig(path); err == nil {
+				t.Error("accepted invalid configuration")
+			}
+		})
+
+	}
+}
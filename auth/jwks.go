@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+type jwks struct {
+	Keys []struct {
+		KeyType   string `json:"kty"`
+		KeyID     string `json:"kid"`
+		Use       string `json:"use"`
+		Algorithm string `json:"alg"`
+		Modulus   string `json:"n"`
+		Exponent  string `json:"e"`
+	} `json:"keys"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS file by key ID.
+// Keys of other types or for other uses are ignored.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses the RSA signing keys of a JWKS document by key ID
+func ParseJWKS(b []byte) (map[string]*rsa.PublicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("cannot parse JWKS: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Algorithm != "" && k.Algorithm != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse modulus of key %s: %v", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse exponent of key %s: %v", k.KeyID, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent of key %s", k.KeyID)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	return keys, nil
+}
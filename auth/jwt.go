@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// DefaultTenantClaim is the token claim naming the tenant of the caller unless configured otherwise
+const DefaultTenantClaim = "tenant"
+
+// JWTConfig contains the keys and expected claims of JWT bearer tokens.
+// Tokens are accepted with HS256 if a secret is set, and with RS256 if public keys are set.
+type JWTConfig struct {
+	Secret []byte
+	// Keys are the RS256 public keys by key ID, as loaded from a JWKS
+	Keys        map[string]*rsa.PublicKey
+	Issuer      string
+	Audience    string
+	TenantClaim string
+	// Leeway is the tolerated clock skew when checking expiration and validity times
+	Leeway time.Duration
+}
+
+// JWTAuthenticator authenticates callers by signed JWT bearer tokens
+type JWTAuthenticator struct {
+	config JWTConfig
+	now    func() time.Time
+}
+
+// NewJWTAuthenticator creates a new JWTAuthenticator with the provided configuration
+func NewJWTAuthenticator(config JWTConfig) *JWTAuthenticator {
+	if config.TenantClaim == "" {
+		config.TenantClaim = DefaultTenantClaim
+	}
+	return &JWTAuthenticator{config, time.Now}
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jwtClaims map[string]interface{}
+
+// Authenticate returns the identity of the subject of the bearer token in the request
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (domain.Identity, error) {
+	var identity domain.Identity
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return identity, ErrNoCredentials
+	}
+	claims, err := a.verify(strings.TrimSpace(authorization[7:]))
+	if err != nil {
+		return identity, err
+	}
+	if err := a.validate(claims); err != nil {
+		return identity, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return identity, InvalidCredentialsError("token without subject")
+	}
+	tenant, _ := claims[a.config.TenantClaim].(string)
+	identity.Subject = sub
+	if identity.Tenant, err = domain.ParseTenant(tenant); err != nil {
+		return identity, InvalidCredentialsError("token with invalid tenant")
+	}
+	return identity, nil
+}
+
+// verify checks the signature of a compact token and returns its claims
+func (a *JWTAuthenticator) verify(token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, InvalidCredentialsError("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, InvalidCredentialsError("malformed token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, InvalidCredentialsError("malformed token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Algorithm {
+	case "HS256":
+		if len(a.config.Secret) == 0 {
+			return nil, InvalidCredentialsError("unsupported signing algorithm")
+		}
+		mac := hmac.New(sha256.New, a.config.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, InvalidCredentialsError("invalid token signature")
+		}
+	case "RS256":
+		key := a.key(header.KeyID)
+		if key == nil {
+			return nil, InvalidCredentialsError("unknown token key")
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, InvalidCredentialsError("invalid token signature")
+		}
+	default:
+		// notably rejects unsigned tokens with the "none" algorithm
+		return nil, InvalidCredentialsError("unsupported signing algorithm")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, InvalidCredentialsError("malformed token claims")
+	}
+	return claims, nil
+}
+
+// key returns the RS256 public key with the ID, or the only one if the token does not name any
+func (a *JWTAuthenticator) key(ID string) *rsa.PublicKey {
+	if ID == "" && len(a.config.Keys) == 1 {
+		for _, key := range a.config.Keys {
+			return key
+		}
+	}
+	return a.config.Keys[ID]
+}
+
+// validate checks the registered claims of a token with a valid signature
+func (a *JWTAuthenticator) validate(claims jwtClaims) error {
+	now := a.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return InvalidCredentialsError("token without expiration")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.config.Leeway)) {
+		return InvalidCredentialsError("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return InvalidCredentialsError("token is not valid yet")
+	}
+	if a.config.Issuer != "" && claims["iss"] != a.config.Issuer {
+		return InvalidCredentialsError("token from unexpected issuer")
+	}
+	if a.config.Audience != "" && !hasAudience(claims["aud"], a.config.Audience) {
+		return InvalidCredentialsError("token for unexpected audience")
+	}
+	return nil
+}
+
+// hasAudience tells whether the aud claim, a string or an array of strings, contains the audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
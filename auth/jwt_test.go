@@ -0,0 +1,155 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/auth"
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+var rsaKey, otherRSAKey *rsa.PrivateKey
+
+func init() {
+	rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	otherRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// token builds a compact JWT signed with an HMAC secret or an RSA private key, unsigned otherwise
+func token(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal("cannot serialize token segment", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := encode(header) + "." + encode(claims)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	now := time.Now()
+	valid := map[string]interface{}{
+		"sub": "alice", "tenant": "acme", "iss": "issuer", "aud": []string{"other", "go-diff"},
+		"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(-time.Minute).Unix(),
+	}
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		claims := make(map[string]interface{})
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "key-1"}
+
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{
+		Secret:   []byte("secret"),
+		Keys:     map[string]*rsa.PublicKey{"key-1": &rsaKey.PublicKey},
+		Issuer:   "issuer",
+		Audience: "go-diff",
+		Leeway:   5 * time.Second,
+	})
+
+	cases := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{name: "HS256 token", token: token(t, hs256, valid, []byte("secret"))},
+		{name: "RS256 token", token: token(t, rs256, valid, rsaKey)},
+		{name: "token expired within leeway", token: token(t, hs256, with(map[string]interface{}{"exp": now.Add(-time.Second).Unix()}), []byte("secret"))},
+		{name: "wrong secret", token: token(t, hs256, valid, []byte("guess")), err: "invalid token signature"},
+		{name: "wrong RSA key", token: token(t, rs256, valid, otherRSAKey), err: "invalid token signature"},
+		{name: "unknown key ID", token: token(t, map[string]interface{}{"alg": "RS256", "kid": "key-2"}, valid, rsaKey), err: "unknown token key"},
+		{name: "unsigned token", token: token(t, map[string]interface{}{"alg": "none"}, valid, nil), err: "unsupported signing algorithm"},
+		{name: "expired token", token: token(t, hs256, with(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), []byte("secret")), err: "token is expired"},
+		{name: "token without expiration", token: token(t, hs256, with(map[string]interface{}{"exp": nil}), []byte("secret")), err: "token without expiration"},
+		{name: "token not valid yet", token: token(t, hs256, with(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), []byte("secret")), err: "token is not valid yet"},
+		{name: "wrong issuer", token: token(t, hs256, with(map[string]interface{}{"iss": "other"}), []byte("secret")), err: "token from unexpected issuer"},
+		{name: "wrong audience", token: token(t, hs256, with(map[string]interface{}{"aud": "other"}), []byte("secret")), err: "token for unexpected audience"},
+		{name: "token without subject", token: token(t, hs256, with(map[string]interface{}{"sub": nil}), []byte("secret")), err: "token without subject"},
+		{name: "invalid tenant", token: token(t, hs256, with(map[string]interface{}{"tenant": "Not/Valid"}), []byte("secret")), err: "token with invalid tenant"},
+		{name: "malformed token", token: "not-a-token", err: "malformed token"},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+			req.Header.Set("Authorization", "Bearer "+c.token)
+
+			// when
+			identity, err := authenticator.Authenticate(req)
+
+			// then
+			if c.err != "" {
+				if err != auth.InvalidCredentialsError(c.err) {
+					t.Errorf("wrong error, expected: %s, got: %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed with error: %v", err)
+			}
+			if identity != (domain.Identity{Subject: "alice", Tenant: domain.Tenant("acme")}) {
+				t.Errorf("wrong identity, got: %v", identity)
+			}
+		})
+
+	}
+}
+
+func TestJWTAuthenticatorWithoutBearerToken(t *testing.T) {
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{Secret: []byte("secret")})
+
+	for _, authorization := range []string{"", "Basic YWxpY2U6c2VjcmV0"} {
+		req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+		req.Header.Set("Authorization", authorization)
+		if _, err := authenticator.Authenticate(req); err != auth.ErrNoCredentials {
+			t.Errorf("wrong error for authorization %q, got: %v", authorization, err)
+		}
+	}
+}
+
+func TestJWTAuthenticatorRejectsHS256WithoutSecret(t *testing.T) {
+	authenticator := auth.NewJWTAuthenticator(auth.JWTConfig{Keys: map[string]*rsa.PublicKey{"key-1": &rsaKey.PublicKey}})
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	req, _ := http.NewRequest("GET", "/v1/diff/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token(t, map[string]interface{}{"alg": "HS256"}, claims, []byte("")))
+
+	_, err := authenticator.Authenticate(req)
+	if err == nil || !strings.Contains(err.Error(), "unsupported signing algorithm") {
+		t.Errorf("accepted HS256 token without a configured secret, got: %v", err)
+	}
+}
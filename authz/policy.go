@@ -0,0 +1,136 @@
+// Package authz provides the role-based authorization of diff operations
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// Role is a level of permissions, each one including the permissions of the lower ones
+type Role int
+
+// Role constants
+const (
+	// Reader may fetch reports, sides, versions and metadata
+	Reader Role = iota + 1
+	// Writer may also upload sides and create sessions
+	Writer
+	// Admin may also delete and list diffs
+	Admin
+)
+
+var roleNames = map[Role]string{Reader: "reader", Writer: "writer", Admin: "admin"}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// ParseRole returns a Role if the value is a valid role name
+func ParseRole(value string) (Role, error) {
+	for role, name := range roleNames {
+		if name == value {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid role value: %s", value)
+}
+
+// AnySubject matches every caller in a binding, anonymous ones included
+const AnySubject = "*"
+
+// Binding grants a role to the callers with a subject, optionally within a tenant,
+// on the IDs starting with any of the prefixes, or on every ID if there are none
+type Binding struct {
+	Subject  string
+	Tenant   domain.Tenant
+	Role     Role
+	Prefixes []string
+}
+
+// Policy is a set of bindings, denying everything they do not grant
+type Policy struct {
+	Bindings []Binding
+}
+
+// Allows tells whether the caller has at least the role on the ID
+func (p Policy) Allows(caller domain.Identity, role Role, ID string) bool {
+	for _, b := range p.Bindings {
+		if b.Role >= role && b.matches(caller) && b.covers(ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b Binding) matches(caller domain.Identity) bool {
+	if b.Subject != AnySubject && b.Subject != caller.Subject {
+		return false
+	}
+	return b.Tenant == domain.DefaultTenant || b.Tenant == caller.Tenant
+}
+
+func (b Binding) covers(ID string) bool {
+	if len(b.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range b.Prefixes {
+		if strings.HasPrefix(ID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type policyFile struct {
+	Bindings []struct {
+		Subject  string   `json:"subject"`
+		Tenant   string   `json:"tenant"`
+		Role     string   `json:"role"`
+		Prefixes []string `json:"prefixes"`
+	} `json:"bindings"`
+}
+
+// LoadPolicy reads a policy file, like:
+//
+//	{
+//	  "bindings": [
+//	    {"subject": "alice", "role": "admin"},
+//	    {"subject": "ci", "tenant": "acme", "role": "writer", "prefixes": ["ci-"]},
+//	    {"subject": "*", "role": "reader"}
+//	  ]
+//	}
+func LoadPolicy(path string) (Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+	return ParsePolicy(b)
+}
+
+// ParsePolicy parses a JSON policy document
+func ParsePolicy(b []byte) (Policy, error) {
+	var policy Policy
+	var file policyFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return policy, fmt.Errorf("cannot parse policy: %v", err)
+	}
+	for i, fb := range file.Bindings {
+		role, err := ParseRole(fb.Role)
+		if err != nil {
+			return policy, fmt.Errorf("binding %d: %v", i, err)
+		}
+		tenant, err := domain.ParseTenant(fb.Tenant)
+		if err != nil {
+			return policy, fmt.Errorf("binding %d: %v", i, err)
+		}
+		if fb.Subject == "" {
+			return policy, fmt.Errorf("binding %d: missing subject", i)
+		}
+		policy.Bindings = append(policy.Bindings, Binding{fb.Subject, tenant, role, fb.Prefixes})
+	}
+	return policy, nil
+}
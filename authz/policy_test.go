@@ -0,0 +1,89 @@
+package authz_test
+
+import (
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/authz"
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+const policyDocument = `{
+	"bindings": [
+		{"subject": "alice", "role": "admin"},
+		{"subject": "ci", "tenant": "acme", "role": "writer", "prefixes": ["ci-", "build-"]},
+		{"subject": "*", "role": "reader", "prefixes": ["public-"]}
+	]
+}`
+
+func TestPolicyAllows(t *testing.T) {
+	policy, err := authz.ParsePolicy([]byte(policyDocument))
+	if err != nil {
+		t.Fatalf("cannot parse policy: %v", err)
+	}
+
+	alice := domain.Identity{Subject: "alice"}
+	ci := domain.Identity{Subject: "ci", Tenant: domain.Tenant("acme")}
+	otherCI := domain.Identity{Subject: "ci", Tenant: domain.Tenant("other")}
+	anonymous := domain.Identity{}
+
+	cases := []struct {
+		name    string
+		caller  domain.Identity
+		role    authz.Role
+		ID      string
+		allowed bool
+	}{
+		{name: "admin deletes any diff", caller: alice, role: authz.Admin, ID: "1", allowed: true},
+		{name: "admin reads any diff", caller: alice, role: authz.Reader, ID: "1", allowed: true},
+		{name: "writer uploads within namespace", caller: ci, role: authz.Writer, ID: "ci-1", allowed: true},
+		{name: "writer uploads within second namespace", caller: ci, role: authz.Writer, ID: "build-1", allowed: true},
+		{name: "writer reads within namespace", caller: ci, role: authz.Reader, ID: "ci-1", allowed: true},
+		{name: "writer uploads outside namespace", caller: ci, role: authz.Writer, ID: "prod-1"},
+		{name: "writer deletes within namespace", caller: ci, role: authz.Admin, ID: "ci-1"},
+		{name: "writer of another tenant", caller: otherCI, role: authz.Writer, ID: "ci-1"},
+		{name: "anyone reads public diffs", caller: anonymous, role: authz.Reader, ID: "public-1", allowed: true},
+		{name: "anyone uploads public diffs", caller: anonymous, role: authz.Writer, ID: "public-1"},
+		{name: "anyone reads other diffs", caller: anonymous, role: authz.Reader, ID: "1"},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			if allowed := policy.Allows(c.caller, c.role, c.ID); allowed != c.allowed {
+				t.Errorf("wrong decision, expected: %v, got: %v", c.allowed, allowed)
+			}
+		})
+
+	}
+}
+
+func TestParsePolicyRejectsInvalidBindings(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		document string
+	}{
+		{name: "not JSON", document: "bindings"},
+		{name: "unknown role", document: `{"bindings": [{"subject": "ci", "role": "owner"}]}`},
+		{name: "missing subject", document: `{"bindings": [{"role": "reader"}]}`},
+		{name: "invalid tenant", document: `{"bindings": [{"subject": "ci", "tenant": "Not/Valid", "role": "reader"}]}`},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := authz.ParsePolicy([]byte(c.document)); err == nil {
+				t.Error("accepted invalid policy")
+			}
+		})
+
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []authz.Role{authz.Reader, authz.Writer, authz.Admin} {
+		if parsed, err := authz.ParseRole(role.String()); err != nil || parsed != role {
+			t.Errorf("wrong role parsed from %s, got: %v, %v", role, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// AuthorizedDiffService is a DiffService decorator that only lets the caller
+// run the operations granted by the policy, failing with domain.ForbiddenError otherwise
+type AuthorizedDiffService struct {
+	policy  Policy
+	caller  domain.Identity
+	service api.DiffService
+}
+
+// NewAuthorizedDiffService creates a new instance of the AuthorizedDiffService decorator for a caller
+func NewAuthorizedDiffService(policy Policy, caller domain.Identity, service api.DiffService) *AuthorizedDiffService {
+	return &AuthorizedDiffService{policy, caller, service}
+}
+
+func (s *AuthorizedDiffService) authorize(role Role, operation, ID string) error {
+	if !s.policy.Allows(s.caller, role, ID) {
+		return domain.ForbiddenError{Subject: s.caller.Subject, Operation: operation, ID: ID}
+	}
+	return nil
+}
+
+// Save requires the writer role on the ID of the payload
+func (s *AuthorizedDiffService) Save(ctx context.Context, p domain.DiffPayload) error {
+	if err := s.authorize(Writer, "save", p.ID); err != nil {
+		return err
+	}
+	return s.service.Save(ctx, p)
+}
+
+// GetDiffReport requires the reader role on the ID
+func (s *AuthorizedDiffService) GetDiffReport(ctx context.Context, ID string) (domain.DiffReport, error) {
+	if err := s.authorize(Reader, "read", ID); err != nil {
+		return domain.DiffReport{}, err
+	}
+	return s.service.GetDiffReport(ctx, ID)
+}
+
+// GetVersionedDiffReport requires the reader role on the ID
+func (s *AuthorizedDiffService) GetVersionedDiffReport(ctx context.Context, ID string, left, right int) (domain.DiffReport, error) {
+	if err := s.authorize(Reader, "read", ID); err != nil {
+		return domain.DiffReport{}, err
+	}
+	return s.service.GetVersionedDiffReport(ctx, ID, left, right)
+}
+
+// ListVersions requires the reader role on the ID
+func (s *AuthorizedDiffService) ListVersions(ctx context.Context, ID string, side domain.DiffSide) ([]domain.SideVersion, error) {
+	if err := s.authorize(Reader, "read", ID); err != nil {
+		return nil, err
+	}
+	return s.service.ListVersions(ctx, ID, side)
+}
+
+// GetSide requires the reader role on the ID
+func (s *AuthorizedDiffService) GetSide(ctx context.Context, ID string, side domain.DiffSide) ([]byte, domain.SideMetadata, error) {
+	if err := s.authorize(Reader, "read", ID); err != nil {
+		return nil, domain.SideMetadata{}, err
+	}
+	return s.service.GetSide(ctx, ID, side)
+}
+
+// GetMetadata requires the reader role on the ID
+func (s *AuthorizedDiffService) GetMetadata(ctx context.Context, ID string) (map[domain.DiffSide]domain.SideMetadata, error) {
+	if err := s.authorize(Reader, "read", ID); err != nil {
+		return nil, err
+	}
+	return s.service.GetMetadata(ctx, ID)
+}
+
+// Delete requires the admin role on the ID
+func (s *AuthorizedDiffService) Delete(ctx context.Context, ID string) error {
+	if err := s.authorize(Admin, "delete", ID); err != nil {
+		return err
+	}
+	return s.service.Delete(ctx, ID)
+}
+
+// DeleteSide requires the admin role on the ID
+func (s *AuthorizedDiffService) DeleteSide(ctx context.Context, ID string, side domain.DiffSide) error {
+	if err := s.authorize(Admin, "delete", ID); err != nil {
+		return err
+	}
+	return s.service.DeleteSide(ctx, ID, side)
+}
+
+// ListDiffs requires the admin role on every ID matching the prefix of the query
+func (s *AuthorizedDiffService) ListDiffs(ctx context.Context, q domain.DiffListQuery) (domain.DiffPage, error) {
+	if !s.policy.Allows(s.caller, Admin, q.Prefix) {
+		return domain.DiffPage{}, domain.ForbiddenError{Subject: s.caller.Subject, Operation: "list diffs"}
+	}
+	return s.service.ListDiffs(ctx, q)
+}
+
+// CreateSession requires the writer role on every ID, since session IDs are generated
+func (s *AuthorizedDiffService) CreateSession(ctx context.Context, lockWhenComplete bool) (domain.DiffSession, error) {
+	if !s.policy.Allows(s.caller, Writer, "") {
+		return domain.DiffSession{}, domain.ForbiddenError{Subject: s.caller.Subject, Operation: "create sessions"}
+	}
+	return s.service.CreateSession(ctx, lockWhenComplete)
+}
+
+// GetSession requires the reader role on the ID
+func (s *AuthorizedDiffService) GetSession(ctx context.Context, ID string) (domain.DiffSession, error) {
+	if err := s.authorize(Reader, "read", ID); err != nil {
+		return domain.DiffSession{}, err
+	}
+	return s.service.GetSession(ctx, ID)
+}
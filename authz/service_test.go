@@ -0,0 +1,143 @@
+package authz_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/api/mocks"
+	"github.com/ehpalumbo/go-diff/authz"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthorizedDiffService(t *testing.T) {
+	policy, _ := authz.ParsePolicy([]byte(policyDocument))
+	ci := domain.Identity{Subject: "ci", Tenant: domain.Tenant("acme")}
+
+	cases := []struct {
+		name    string
+		call    func(s *authz.AuthorizedDiffService) error
+		expect  func(m *mocks.MockDiffService)
+		allowed bool
+	}{
+		{
+			name: "save within namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				return s.Save(context.Background(), domain.DiffPayload{ID: "ci-1", Side: domain.LeftSide})
+			},
+			expect: func(m *mocks.MockDiffService) {
+				m.EXPECT().Save(gomock.Any(), domain.DiffPayload{ID: "ci-1", Side: domain.LeftSide}).Return(nil)
+			},
+			allowed: true,
+		},
+		{
+			name: "save outside namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				return s.Save(context.Background(), domain.DiffPayload{ID: "prod-1", Side: domain.LeftSide})
+			},
+		},
+		{
+			name: "report within namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				_, err := s.GetDiffReport(context.Background(), "ci-1")
+				return err
+			},
+			expect: func(m *mocks.MockDiffService) {
+				m.EXPECT().GetDiffReport(gomock.Any(), "ci-1").Return(domain.DiffReport{}, nil)
+			},
+			allowed: true,
+		},
+		{
+			name: "versioned report outside namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				_, err := s.GetVersionedDiffReport(context.Background(), "prod-1", 1, 2)
+				return err
+			},
+		},
+		{
+			name: "side download outside namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				_, _, err := s.GetSide(context.Background(), "prod-1", domain.LeftSide)
+				return err
+			},
+		},
+		{
+			name: "delete within namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				return s.Delete(context.Background(), "ci-1")
+			},
+		},
+		{
+			name: "side delete within namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				return s.DeleteSide(context.Background(), "ci-1", domain.LeftSide)
+			},
+		},
+		{
+			name: "listing within namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				_, err := s.ListDiffs(context.Background(), domain.DiffListQuery{Prefix: "ci-"})
+				return err
+			},
+		},
+		{
+			name: "session creation outside namespace",
+			call: func(s *authz.AuthorizedDiffService) error {
+				_, err := s.CreateSession(context.Background(), false)
+				return err
+			},
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// given
+			m := mocks.NewMockDiffService(ctrl)
+			if c.expect != nil {
+				c.expect(m)
+			}
+			s := authz.NewAuthorizedDiffService(policy, ci, m)
+
+			// when
+			err := c.call(s)
+
+			// then
+			if _, forbidden := err.(domain.ForbiddenError); forbidden == c.allowed {
+				t.Errorf("wrong decision, got: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestAuthorizedDiffServiceGrantsAdminsEverything(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// given
+	policy, _ := authz.ParsePolicy([]byte(policyDocument))
+	m := mocks.NewMockDiffService(ctrl)
+	s := authz.NewAuthorizedDiffService(policy, domain.Identity{Subject: "alice"}, m)
+
+	m.EXPECT().ListDiffs(gomock.Any(), domain.DiffListQuery{}).Return(domain.DiffPage{}, nil)
+	m.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+	m.EXPECT().CreateSession(gomock.Any(), true).Return(domain.DiffSession{ID: "abc"}, nil)
+	m.EXPECT().GetSession(gomock.Any(), "abc").Return(domain.DiffSession{ID: "abc"}, nil)
+
+	// when
+	_, listErr := s.ListDiffs(context.Background(), domain.DiffListQuery{})
+	deleteErr := s.Delete(context.Background(), "1")
+	session, createErr := s.CreateSession(context.Background(), true)
+	_, getErr := s.GetSession(context.Background(), session.ID)
+
+	// then
+	for _, err := range []error{listErr, deleteErr, createErr, getErr} {
+		if err != nil {
+			t.Errorf("failed with error: %v", err)
+		}
+	}
+}
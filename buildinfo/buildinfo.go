@@ -0,0 +1,38 @@
+// Package buildinfo provides the build information embedded in the binary at compile time.
+// Version, Commit and BuildTime are set by the linker, for example:
+//
+//	go build -ldflags "-X github.com/ehpalumbo/go-diff/buildinfo.Version=v1.2.0 -X github.com/ehpalumbo/go-diff/buildinfo.Commit=$(git rev-parse HEAD)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set by the linker, empty unless provided at compile time
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// Info describes the build of the running binary
+type Info struct {
+	Version   string
+	Commit    string
+	BuildTime string
+	GoVersion string
+}
+
+// Get returns the build information of the running binary.
+// Without a version set by the linker, it falls back to the version of the main module, if built from one.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if info.Version == "" {
+		info.Version = "unknown"
+		if build, ok := debug.ReadBuildInfo(); ok && build.Main.Version != "" {
+			info.Version = build.Main.Version
+		}
+	}
+	return info
+}
@@ -0,0 +1,35 @@
+package buildinfo_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/buildinfo"
+)
+
+func TestGetReportsLinkedValues(t *testing.T) {
+
+	// given
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "v1.2.0", "abc123", "2021-07-01T00:00:00Z"
+	defer func() { buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "", "", "" }()
+
+	// when
+	info := buildinfo.Get()
+
+	// then
+	expected := buildinfo.Info{Version: "v1.2.0", Commit: "abc123", BuildTime: "2021-07-01T00:00:00Z", GoVersion: runtime.Version()}
+	if info != expected {
+		t.Errorf("wrong build info, expected: %+v, got: %+v", expected, info)
+	}
+}
+
+func TestGetFallsBackWithoutLinkedVersion(t *testing.T) {
+
+	// when
+	info := buildinfo.Get()
+
+	// then
+	if info.Version == "" || info.GoVersion != runtime.Version() {
+		t.Errorf("wrong build info, got: %+v", info)
+	}
+}
@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 // DifferImpl is the implementation of the diff logic between two binary streams
 type DifferImpl struct {
@@ -37,8 +40,12 @@ func (c *counter) save() {
 	}
 }
 
-// Diff compares two byte slices and returns a DiffReport with insights on the differences
-func (d *DifferImpl) Diff(left, right []byte) (DiffReport, error) {
+// checkInterval is the number of bytes compared between checks for cancellation
+const checkInterval = 64 << 10
+
+// Diff compares two byte slices and returns a DiffReport with insights on the differences.
+// Comparisons stop with the context error once the context is done.
+func (d *DifferImpl) Diff(ctx context.Context, left, right []byte) (DiffReport, error) {
 	var r DiffReport
 
 	if left == nil || right == nil {
@@ -50,18 +57,21 @@ func (d *DifferImpl) Diff(left, right []byte) (DiffReport, error) {
 		return r, nil
 	}
 
-	r = generateReport(left, right)
-
-	return r, nil
+	return generateReport(ctx, left, right)
 }
 
-func generateReport(left, right []byte) DiffReport {
+func generateReport(ctx context.Context, left, right []byte) (DiffReport, error) {
 	var c counter
 	for i := range left {
+		if i%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return DiffReport{}, err
+			}
+		}
 		c.count(left[i] == right[i])
 	}
 	c.save()
-	return toDiffReport(c)
+	return toDiffReport(c), nil
 }
 
 func toDiffReport(c counter) (r DiffReport) {
@@ -1,6 +1,7 @@
 package domain_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ehpalumbo/go-diff/domain"
@@ -11,7 +12,7 @@ func TestDiffRejectsInputIfOneOfTheSidesIsMissing(t *testing.T) {
 	d := domain.NewDifferImpl()
 
 	// when
-	_, err := d.Diff(nil, nil)
+	_, err := d.Diff(context.Background(), nil, nil)
 
 	// then
 	if err == nil {
@@ -99,7 +100,7 @@ func TestDiffReport(t *testing.T) {
 
 		t.Run(c.name, func(t *testing.T) {
 			// when
-			r, err := d.Diff([]byte(c.left), []byte(c.right))
+			r, err := d.Diff(context.Background(), []byte(c.left), []byte(c.right))
 
 			// then
 			if err != nil {
@@ -120,3 +121,19 @@ func TestDiffReport(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffStopsWhenContextIsDone(t *testing.T) {
+	// given
+	d := domain.NewDifferImpl()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := make([]byte, 1<<20)
+
+	// when
+	_, err := d.Diff(ctx, data, data)
+
+	// then
+	if err != context.Canceled {
+		t.Errorf("did not stop on cancellation, got: %v", err)
+	}
+}
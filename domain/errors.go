@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorCode is a stable, machine-readable classification of errors.
+// Codes are errors themselves, so that errors.Is(err, CodeNotFound) tells the class of a wrapped error.
+type ErrorCode string
+
+func (c ErrorCode) Error() string {
+	return string(c)
+}
+
+const (
+	// CodeNotFound is the code of requests for missing diffs, sides or versions
+	CodeNotFound = ErrorCode("not_found")
+	// CodeInvalidPayload is the code of uploads with illegal attributes
+	CodeInvalidPayload = ErrorCode("invalid_payload")
+	// CodeInvalidQuery is the code of queries with illegal attributes
+	CodeInvalidQuery = ErrorCode("invalid_query")
+	// CodeTooLarge is the code of uploads exceeding the size limits
+	CodeTooLarge = ErrorCode("too_large")
+	// CodeConflict is the code of changes conflicting with the state of a diff, like locked ones
+	CodeConflict = ErrorCode("conflict")
+	// CodePreconditionFailed is the code of conditional uploads not matching the stored side
+	CodePreconditionFailed = ErrorCode("precondition_failed")
+	// CodeForbidden is the code of operations the caller is not allowed to perform
+	CodeForbidden = ErrorCode("forbidden")
+	// CodeQuotaExceeded is the code of uploads exceeding the quota of a tenant
+	CodeQuotaExceeded = ErrorCode("quota_exceeded")
+	// CodeStorageUnavailable is the code of storage failures
+	CodeStorageUnavailable = ErrorCode("storage_unavailable")
+	// CodeTimeout is the code of operations that ran out of time
+	CodeTimeout = ErrorCode("timeout")
+	// CodeInternal is the code of any other error
+	CodeInternal = ErrorCode("internal")
+)
+
+// CodeOf returns the code of the first error in the chain of err that has one, CodeInternal if none has.
+// Deadlines exceeded anywhere in the chain are timeouts.
+func CodeOf(err error) ErrorCode {
+	var coded interface{ Code() ErrorCode }
+	if errors.As(err, &coded) {
+		return coded.Code()
+	}
+	if isTimeout(err) {
+		return CodeTimeout
+	}
+	return CodeInternal
+}
+
+// StorageError is returned when the storage fails to perform an operation
+type StorageError struct {
+	Op  string
+	Err error
+}
+
+func (e StorageError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e StorageError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the code of the cause if it has one, so domain errors from the storage keep their meaning
+func (e StorageError) Code() ErrorCode {
+	var coded interface{ Code() ErrorCode }
+	if errors.As(e.Err, &coded) {
+		return coded.Code()
+	}
+	if isTimeout(e.Err) {
+		return CodeTimeout
+	}
+	return CodeStorageUnavailable
+}
+
+func (e StorageError) Is(target error) bool {
+	return target == e.Code()
+}
+
+func isTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// Code returns CodeNotFound
+func (e DiffNotFoundError) Code() ErrorCode { return CodeNotFound }
+
+func (e DiffNotFoundError) Is(target error) bool { return target == CodeNotFound }
+
+// Code returns CodeInvalidPayload
+func (err IllegalDiffPayloadError) Code() ErrorCode { return CodeInvalidPayload }
+
+func (err IllegalDiffPayloadError) Is(target error) bool { return target == CodeInvalidPayload }
+
+// Code returns CodeInvalidQuery
+func (err IllegalDiffQueryError) Code() ErrorCode { return CodeInvalidQuery }
+
+func (err IllegalDiffQueryError) Is(target error) bool { return target == CodeInvalidQuery }
+
+// Code returns CodeTooLarge
+func (e PayloadTooLargeError) Code() ErrorCode { return CodeTooLarge }
+
+func (e PayloadTooLargeError) Is(target error) bool { return target == CodeTooLarge }
+
+// Code returns CodeConflict
+func (e DiffLockedError) Code() ErrorCode { return CodeConflict }
+
+func (e DiffLockedError) Is(target error) bool { return target == CodeConflict }
+
+// Code returns CodePreconditionFailed
+func (e PreconditionFailedError) Code() ErrorCode { return CodePreconditionFailed }
+
+func (e PreconditionFailedError) Is(target error) bool { return target == CodePreconditionFailed }
+
+// Code returns CodeForbidden
+func (e ForbiddenError) Code() ErrorCode { return CodeForbidden }
+
+func (e ForbiddenError) Is(target error) bool { return target == CodeForbidden }
+
+// Code returns CodeQuotaExceeded
+func (e QuotaExceededError) Code() ErrorCode { return CodeQuotaExceeded }
+
+func (e QuotaExceededError) Is(target error) bool { return target == CodeQuotaExceeded }
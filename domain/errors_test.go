@@ -0,0 +1,71 @@
+package domain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestErrorCodes(t *testing.T) {
+
+	cases := []struct {
+		err      error
+		expected domain.ErrorCode
+	}{
+		{err: domain.DiffNotFoundError{ID: "1"}, expected: domain.CodeNotFound},
+		{err: domain.IllegalDiffPayloadError("oops"), expected: domain.CodeInvalidPayload},
+		{err: domain.IllegalDiffQueryError("oops"), expected: domain.CodeInvalidQuery},
+		{err: domain.PayloadTooLargeError{ID: "1"}, expected: domain.CodeTooLarge},
+		{err: domain.DiffLockedError{ID: "1"}, expected: domain.CodeConflict},
+		{err: domain.PreconditionFailedError{ID: "1"}, expected: domain.CodePreconditionFailed},
+		{err: domain.ForbiddenError{ID: "1"}, expected: domain.CodeForbidden},
+		{err: domain.QuotaExceededError{ID: "1"}, expected: domain.CodeQuotaExceeded},
+		{err: domain.StorageError{Op: "get", Err: errors.New("oops")}, expected: domain.CodeStorageUnavailable},
+		{err: domain.StorageError{Op: "get", Err: timeoutError{}}, expected: domain.CodeTimeout},
+		{err: domain.StorageError{Op: "get", Err: fmt.Errorf("cancelled: %w", context.DeadlineExceeded)}, expected: domain.CodeTimeout},
+		{err: domain.StorageError{Op: "save", Err: domain.PreconditionFailedError{ID: "1"}}, expected: domain.CodePreconditionFailed},
+	}
+
+	for _, c := range cases {
+		wrapped := fmt.Errorf("wrapped: %w", c.err)
+		if code := domain.CodeOf(wrapped); code != c.expected {
+			t.Errorf("wrong code of %v, expected: %s, got: %s", c.err, c.expected, code)
+		}
+		if !errors.Is(wrapped, c.expected) {
+			t.Errorf("%v is not %s", c.err, c.expected)
+		}
+		if errors.Is(wrapped, domain.CodeInternal) {
+			t.Errorf("%v is internal", c.err)
+		}
+	}
+}
+
+func TestCodeOfUncodedErrors(t *testing.T) {
+	if code := domain.CodeOf(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)); code != domain.CodeTimeout {
+		t.Errorf("exceeded deadline is not a timeout, got: %s", code)
+	}
+	if code := domain.CodeOf(errors.New("oops")); code != domain.CodeInternal {
+		t.Errorf("uncoded error is not internal, got: %s", code)
+	}
+}
+
+func TestStorageErrorUnwrapsCause(t *testing.T) {
+	cause := domain.DiffNotFoundError{ID: "1"}
+	err := fmt.Errorf("cannot save payload: %w", domain.StorageError{Op: "cannot get resource 1 from storage", Err: cause})
+
+	var notFound domain.DiffNotFoundError
+	if !errors.As(err, &notFound) || notFound != cause {
+		t.Errorf("cause not found in %v", err)
+	}
+	if err.Error() != "cannot save payload: cannot get resource 1 from storage: diff not found for ID: 1" {
+		t.Errorf("wrong message, got: %s", err.Error())
+	}
+}
@@ -0,0 +1,27 @@
+package domain
+
+// Identity is the authenticated caller of the API
+type Identity struct {
+	// Subject names the caller, like the owner of an API key or the subject of a token
+	Subject string
+	// Tenant is the only tenant whose diffs the caller can access
+	Tenant Tenant
+}
+
+// ForbiddenError is returned when the caller is not allowed an operation
+type ForbiddenError struct {
+	Subject   string
+	Operation string
+	ID        string
+}
+
+func (e ForbiddenError) Error() string {
+	subject := e.Subject
+	if subject == "" {
+		subject = "anonymous caller"
+	}
+	if e.ID == "" {
+		return subject + " is not allowed to " + e.Operation
+	}
+	return subject + " is not allowed to " + e.Operation + " ID: " + e.ID
+}
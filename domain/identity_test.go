@@ -0,0 +1,24 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestCreateForbiddenError(t *testing.T) {
+
+	cases := []struct {
+		err      domain.ForbiddenError
+		expected string
+	}{
+		{err: domain.ForbiddenError{Subject: "ci", Operation: "delete", ID: "1"}, expected: "ci is not allowed to delete ID: 1"},
+		{err: domain.ForbiddenError{Operation: "list diffs"}, expected: "anonymous caller is not allowed to list diffs"},
+	}
+
+	for _, c := range cases {
+		if c.err.Error() != c.expected {
+			t.Errorf("wrong error message, expected: %s, got: %s", c.expected, c.err)
+		}
+	}
+}
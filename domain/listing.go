@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// DiffSortOrder defines the possible orderings of a diff listing
+type DiffSortOrder string
+
+// DiffSortOrder constants
+const (
+	SortByID                 = DiffSortOrder("id")
+	SortByLastModified       = DiffSortOrder("last_modified")
+	SortByLastModifiedNewest = DiffSortOrder("-last_modified")
+)
+
+func (o DiffSortOrder) String() string {
+	return string(o)
+}
+
+// ParseDiffSortOrder returns a DiffSortOrder if the value is a valid ordering.
+// An empty value defaults to sorting by ID.
+func ParseDiffSortOrder(value string) (DiffSortOrder, error) {
+	switch o := DiffSortOrder(value); o {
+	case "":
+		return SortByID, nil
+	case SortByID, SortByLastModified, SortByLastModifiedNewest:
+		return o, nil
+	}
+	return DiffSortOrder(""), errors.New("invalid sort value")
+}
+
+// DiffSummary contains information about a stored diff.
+// Size is the number of bytes of the latest version of every side.
+type DiffSummary struct {
+	ID           string
+	LastModified time.Time
+	Size         int64
+}
+
+// LessID tells whether the diff ID a comes before b in listings sorted by ID.
+// IDs compare as if they ended with a slash, which is the order of storages keeping
+// the sides of each diff under a path of its ID, like S3.
+func LessID(a, b string) bool {
+	return a+"/" < b+"/"
+}
+
+// DiffListQuery contains the filtering, ordering and pagination of a diff listing
+type DiffListQuery struct {
+	Prefix string
+	Cursor string
+	Limit  int
+	SortBy DiffSortOrder
+}
+
+// DiffPage is a page of a diff listing.
+// NextCursor is empty when there are no more results.
+type DiffPage struct {
+	Diffs      []DiffSummary
+	NextCursor string
+}
+
+// IllegalDiffQueryError is returned when a query contains illegal attributes
+type IllegalDiffQueryError string
+
+func (err IllegalDiffQueryError) Error() string {
+	return string(err)
+}
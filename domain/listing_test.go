@@ -0,0 +1,35 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestParseDiffSortOrder(t *testing.T) {
+	expected := map[string]domain.DiffSortOrder{
+		"":               domain.SortByID,
+		"id":             domain.SortByID,
+		"last_modified":  domain.SortByLastModified,
+		"-last_modified": domain.SortByLastModifiedNewest,
+	}
+	for v, o := range expected {
+		actual, err := domain.ParseDiffSortOrder(v)
+		if err != nil {
+			t.Errorf("%q not recognized, got: %v", v, err)
+		}
+		if actual != o {
+			t.Errorf("%q NOK, expected %s, got %s", v, o, actual)
+		}
+	}
+}
+
+func TestParseDiffSortOrderInvalid(t *testing.T) {
+	_, err := domain.ParseDiffSortOrder("size")
+	if err == nil {
+		t.Fatal("invalid sort order was accepted")
+	}
+	if err.Error() != "invalid sort value" {
+		t.Errorf("invalid sort order error is wrong, got: %v", err)
+	}
+}
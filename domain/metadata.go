@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// SideMetadata contains descriptive information attached to an uploaded side
+type SideMetadata struct {
+	Filename    string
+	ContentType string
+	Labels      map[string]string
+	Uploader    string
+	UploadedAt  time.Time
+}
+
+// MaxLabels bounds the number of labels attached to a side
+const MaxLabels = 16
+
+// MaxMetadataBytes bounds the filename, uploader and labels of a side together.
+// Repositories may store them URL-encoded, up to three times larger,
+// and S3 only keeps 2 KB of user-defined metadata per object.
+const MaxMetadataBytes = 512
+
+// Size returns the number of bytes of the filename, the uploader and the labels of the metadata
+func (m SideMetadata) Size() int {
+	size := len(m.Filename) + len(m.Uploader)
+	for k, v := range m.Labels {
+		size += len(k) + len(v)
+	}
+	return size
+}
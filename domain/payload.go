@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // DiffSide is used to refer to the side of the comparison
 type DiffSide string
@@ -19,9 +22,11 @@ func ParseDiffSide(value string) (DiffSide, error) {
 
 // DiffPayload contains data to upload a side of the comparison
 type DiffPayload struct {
-	ID    string
-	Side  DiffSide
-	Value string
+	ID           string
+	Side         DiffSide
+	Value        string
+	Metadata     SideMetadata
+	Precondition SidePrecondition
 }
 
 // LeftSide is the left side constant
@@ -36,3 +41,32 @@ type IllegalDiffPayloadError string
 func (err IllegalDiffPayloadError) Error() string {
 	return string(err)
 }
+
+// SizeLimits bounds the data stored for each side and for both sides of a diff together.
+// Zero values mean no limit.
+type SizeLimits struct {
+	MaxSideBytes int64
+	MaxDiffBytes int64
+}
+
+// MaxPayloadBytes returns the most bytes a single side may have, zero meaning no limit
+func (l SizeLimits) MaxPayloadBytes() int64 {
+	if l.MaxDiffBytes > 0 && (l.MaxSideBytes <= 0 || l.MaxDiffBytes < l.MaxSideBytes) {
+		return l.MaxDiffBytes
+	}
+	if l.MaxSideBytes > 0 {
+		return l.MaxSideBytes
+	}
+	return 0
+}
+
+// PayloadTooLargeError is returned when a payload exceeds the size limits
+type PayloadTooLargeError struct {
+	ID    string
+	Side  DiffSide
+	Limit int64
+}
+
+func (e PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("payload too large for side %s of ID %s: limit is %d bytes", e.Side, e.ID, e.Limit)
+}
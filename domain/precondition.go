@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// AnyTag is the entity tag matching any stored side
+const AnyTag = "*"
+
+// Digest returns the entity tag of side data, the hex-encoded SHA-256 of its content
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SidePrecondition restricts a side upload to a given state of the stored side,
+// identified by the Digest of its latest version
+type SidePrecondition struct {
+	// IfMatch requires the stored side to match one of the tags
+	IfMatch []string
+	// IfNoneMatch requires the stored side to match none of the tags
+	IfNoneMatch []string
+}
+
+// IsZero tells whether the precondition does not restrict uploads at all
+func (p SidePrecondition) IsZero() bool {
+	return len(p.IfMatch) == 0 && len(p.IfNoneMatch) == 0
+}
+
+// Allows tells whether the stored side satisfies the precondition.
+// An empty digest stands for a side that is not stored.
+func (p SidePrecondition) Allows(digest string) bool {
+	if len(p.IfMatch) > 0 && !matches(p.IfMatch, digest) {
+		return false
+	}
+	return !matches(p.IfNoneMatch, digest)
+}
+
+func matches(tags []string, digest string) bool {
+	if digest == "" {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == AnyTag || tag == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// PreconditionFailedError is returned when a conditional upload does not match the stored side
+type PreconditionFailedError struct {
+	ID   string
+	Side string
+}
+
+func (e PreconditionFailedError) Error() string {
+	return "precondition failed for side " + e.Side + " of ID: " + e.ID
+}
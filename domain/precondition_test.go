@@ -0,0 +1,83 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestSidePreconditionAllows(t *testing.T) {
+	stored := domain.Digest([]byte("hello"))
+
+	cases := []struct {
+		name         string
+		precondition domain.SidePrecondition
+		digest       string
+		expected     bool
+	}{
+		{
+			name:     "no precondition",
+			digest:   stored,
+			expected: true,
+		},
+		{
+			name:         "if match on same digest",
+			precondition: domain.SidePrecondition{IfMatch: []string{"other", stored}},
+			digest:       stored,
+			expected:     true,
+		},
+		{
+			name:         "if match on different digest",
+			precondition: domain.SidePrecondition{IfMatch: []string{"other"}},
+			digest:       stored,
+		},
+		{
+			name:         "if match any on stored side",
+			precondition: domain.SidePrecondition{IfMatch: []string{domain.AnyTag}},
+			digest:       stored,
+			expected:     true,
+		},
+		{
+			name:         "if match any on missing side",
+			precondition: domain.SidePrecondition{IfMatch: []string{domain.AnyTag}},
+		},
+		{
+			name:         "if none match any on missing side",
+			precondition: domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}},
+			expected:     true,
+		},
+		{
+			name:         "if none match any on stored side",
+			precondition: domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}},
+			digest:       stored,
+		},
+		{
+			name:         "if none match on different digest",
+			precondition: domain.SidePrecondition{IfNoneMatch: []string{"other"}},
+			digest:       stored,
+			expected:     true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.precondition.Allows(c.digest); actual != c.expected {
+				t.Errorf("wrong outcome, expected: %v, got: %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDigest(t *testing.T) {
+	expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if actual := domain.Digest([]byte("hello")); actual != expected {
+		t.Errorf("wrong digest, expected: %s, got: %s", expected, actual)
+	}
+}
+
+func TestCreatePreconditionFailedError(t *testing.T) {
+	err := domain.PreconditionFailedError{ID: "1", Side: "left"}
+	if err.Error() != "precondition failed for side left of ID: 1" {
+		t.Error("PreconditionFailedError does not generate expected error message")
+	}
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+// DiffSession is a diff created under a server-generated ID
+type DiffSession struct {
+	ID        string
+	CreatedAt time.Time
+	// LockWhenComplete makes the sides immutable once both are uploaded, though the whole diff can still be deleted
+	LockWhenComplete bool
+	// LockedAt is zero while the diff accepts changes
+	LockedAt time.Time
+}
+
+// Locked tells whether the diff no longer accepts changes
+func (s DiffSession) Locked() bool {
+	return !s.LockedAt.IsZero()
+}
+
+// DiffLockedError is returned when changing a locked diff
+type DiffLockedError struct {
+	ID string
+}
+
+func (e DiffLockedError) Error() string {
+	return "diff is locked for ID: " + e.ID
+}
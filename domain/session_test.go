@@ -0,0 +1,26 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestDiffSessionLocked(t *testing.T) {
+	s := domain.DiffSession{ID: "1", LockWhenComplete: true}
+	if s.Locked() {
+		t.Error("session without lock time is locked")
+	}
+	s.LockedAt = time.Now()
+	if !s.Locked() {
+		t.Error("session with lock time is not locked")
+	}
+}
+
+func TestCreateDiffLockedError(t *testing.T) {
+	err := domain.DiffLockedError{ID: "1"}
+	if err.Error() != "diff is locked for ID: 1" {
+		t.Error("DiffLockedError does not generate expected error message")
+	}
+}
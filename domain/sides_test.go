@@ -36,3 +36,30 @@ func TestParseDiffSideEmpty(t *testing.T) {
 		t.Errorf("empty side error is wrong, got: %v", actualMessage)
 	}
 }
+
+func TestSizeLimitsMaxPayloadBytes(t *testing.T) {
+
+	cases := []struct {
+		limits   domain.SizeLimits
+		expected int64
+	}{
+		{limits: domain.SizeLimits{}, expected: 0},
+		{limits: domain.SizeLimits{MaxSideBytes: 10}, expected: 10},
+		{limits: domain.SizeLimits{MaxDiffBytes: 15}, expected: 15},
+		{limits: domain.SizeLimits{MaxSideBytes: 10, MaxDiffBytes: 15}, expected: 10},
+		{limits: domain.SizeLimits{MaxSideBytes: 10, MaxDiffBytes: 5}, expected: 5},
+	}
+
+	for _, c := range cases {
+		if max := c.limits.MaxPayloadBytes(); max != c.expected {
+			t.Errorf("wrong maximum payload size for %+v, expected: %d, got: %d", c.limits, c.expected, max)
+		}
+	}
+}
+
+func TestCreatePayloadTooLargeError(t *testing.T) {
+	err := domain.PayloadTooLargeError{ID: "1", Side: domain.LeftSide, Limit: 10}
+	if err.Error() != "payload too large for side left of ID 1: limit is 10 bytes" {
+		t.Error("PayloadTooLargeError does not generate expected error message")
+	}
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tenant identifies the owner of a set of diffs, isolated from other tenants
+type Tenant string
+
+// DefaultTenant owns the diffs of callers that do not belong to any tenant
+const DefaultTenant = Tenant("")
+
+// tenantSeparator joins tenants and IDs in storage, and never appears in either of them
+const tenantSeparator = "/"
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+func (t Tenant) String() string {
+	return string(t)
+}
+
+// ParseTenant returns a Tenant if the value is a valid tenant name.
+// An empty value is the default tenant.
+func ParseTenant(value string) (Tenant, error) {
+	if value == "" {
+		return DefaultTenant, nil
+	}
+	if !tenantPattern.MatchString(value) {
+		return DefaultTenant, errors.New("invalid tenant value")
+	}
+	return Tenant(value), nil
+}
+
+// Scope returns the storage ID of a diff of the tenant.
+// Diffs of the default tenant keep their IDs, so existing data remains accessible.
+func (t Tenant) Scope(ID string) string {
+	if t == DefaultTenant {
+		return ID
+	}
+	return string(t) + tenantSeparator + ID
+}
+
+// Unscope returns the ID of a diff from its storage ID, if it belongs to the tenant
+func (t Tenant) Unscope(storageID string) (string, bool) {
+	if t == DefaultTenant {
+		if strings.Contains(storageID, tenantSeparator) {
+			return "", false
+		}
+		return storageID, true
+	}
+	prefix := string(t) + tenantSeparator
+	if !strings.HasPrefix(storageID, prefix) {
+		return "", false
+	}
+	return storageID[len(prefix):], true
+}
+
+// TenantOf returns the tenant owning a storage ID
+func TenantOf(storageID string) Tenant {
+	if i := strings.Index(storageID, tenantSeparator); i >= 0 {
+		return Tenant(storageID[:i])
+	}
+	return DefaultTenant
+}
+
+// Usage is the storage used by the diffs of a tenant
+type Usage struct {
+	// Diffs counts the diffs having at least one side
+	Diffs int
+	// Bytes adds up the sizes of every stored version of their sides
+	Bytes int64
+}
+
+// TenantQuota limits the diffs stored by a tenant. Zero values mean no limit.
+type TenantQuota struct {
+	MaxDiffs int
+	MaxBytes int64
+}
+
+// IsZero tells whether the quota sets no limit at all
+func (q TenantQuota) IsZero() bool {
+	return q.MaxDiffs <= 0 && q.MaxBytes <= 0
+}
+
+// QuotaExceededError is returned when saving a side would exceed the quota of the tenant
+type QuotaExceededError struct {
+	ID     string
+	Reason string
+}
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded saving ID %s: %s", e.ID, e.Reason)
+}
@@ -0,0 +1,86 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestParseTenant(t *testing.T) {
+
+	cases := []struct {
+		value    string
+		expected domain.Tenant
+		invalid  bool
+	}{
+		{value: "", expected: domain.DefaultTenant},
+		{value: "acme", expected: domain.Tenant("acme")},
+		{value: "team-1_ci", expected: domain.Tenant("team-1_ci")},
+		{value: "Acme", invalid: true},
+		{value: "acme/other", invalid: true},
+		{value: "-acme", invalid: true},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.value, func(t *testing.T) {
+			tenant, err := domain.ParseTenant(c.value)
+			if (err != nil) != c.invalid {
+				t.Fatalf("wrong validation, got: %v", err)
+			}
+			if tenant != c.expected {
+				t.Errorf("wrong tenant, expected: %s, got: %s", c.expected, tenant)
+			}
+		})
+
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	acme := domain.Tenant("acme")
+
+	if ID := acme.Scope("1"); ID != "acme/1" {
+		t.Errorf("wrong scoped ID, got: %s", ID)
+	}
+	if ID := domain.DefaultTenant.Scope("1"); ID != "1" {
+		t.Errorf("default tenant changed ID, got: %s", ID)
+	}
+
+	cases := []struct {
+		tenant    domain.Tenant
+		storageID string
+		ID        string
+		owned     bool
+	}{
+		{tenant: acme, storageID: "acme/1", ID: "1", owned: true},
+		{tenant: acme, storageID: "acmeco/1"},
+		{tenant: acme, storageID: "1"},
+		{tenant: domain.DefaultTenant, storageID: "1", ID: "1", owned: true},
+		{tenant: domain.DefaultTenant, storageID: "acme/1"},
+	}
+	for _, c := range cases {
+		ID, owned := c.tenant.Unscope(c.storageID)
+		if owned != c.owned || ID != c.ID {
+			t.Errorf("wrong unscoping of %s for tenant %q, got: %s, %v", c.storageID, c.tenant, ID, owned)
+		}
+	}
+}
+
+func TestTenantOf(t *testing.T) {
+	cases := map[string]domain.Tenant{
+		"acme/1": domain.Tenant("acme"),
+		"1":      domain.DefaultTenant,
+	}
+	for storageID, expected := range cases {
+		if tenant := domain.TenantOf(storageID); tenant != expected {
+			t.Errorf("wrong tenant of %s, expected: %q, got: %q", storageID, expected, tenant)
+		}
+	}
+}
+
+func TestCreateQuotaExceededError(t *testing.T) {
+	err := domain.QuotaExceededError{ID: "1", Reason: "too many diffs"}
+	if err.Error() != "quota exceeded saving ID 1: too many diffs" {
+		t.Error("QuotaExceededError does not generate expected error message")
+	}
+}
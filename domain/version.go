@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatestVersion selects the most recent version of a side
+const LatestVersion = 0
+
+// SideVersion describes a stored version of a side.
+// Versions of a side are numbered from 1 in upload order.
+type SideVersion struct {
+	Version    int
+	Size       int64
+	UploadedAt time.Time
+}
+
+// ParseSideVersion returns a version number if the value is either "v3" or "3".
+// An empty value or "latest" selects the LatestVersion.
+func ParseSideVersion(value string) (int, error) {
+	if value == "" || value == "latest" {
+		return LatestVersion, nil
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(value, "v"))
+	if err != nil || v < 1 {
+		return 0, errors.New("invalid version value")
+	}
+	return v, nil
+}
@@ -0,0 +1,37 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+func TestParseSideVersion(t *testing.T) {
+	expected := map[string]int{
+		"":       domain.LatestVersion,
+		"latest": domain.LatestVersion,
+		"3":      3,
+		"v3":     3,
+		"v12":    12,
+	}
+	for v, n := range expected {
+		actual, err := domain.ParseSideVersion(v)
+		if err != nil {
+			t.Errorf("%q not recognized, got: %v", v, err)
+		}
+		if actual != n {
+			t.Errorf("%q NOK, expected %d, got %d", v, n, actual)
+		}
+	}
+}
+
+func TestParseSideVersionInvalid(t *testing.T) {
+	for _, v := range []string{"v", "0", "v0", "-1", "three", "vv3"} {
+		_, err := domain.ParseSideVersion(v)
+		if err == nil {
+			t.Errorf("invalid version %q was accepted", v)
+		} else if err.Error() != "invalid version value" {
+			t.Errorf("invalid version error is wrong, got: %v", err)
+		}
+	}
+}
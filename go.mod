@@ -3,11 +3,24 @@ module github.com/ehpalumbo/go-diff
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/aws/aws-lambda-go v1.25.0
 	github.com/aws/aws-sdk-go-v2 v1.7.1
 	github.com/aws/aws-sdk-go-v2/config v1.5.0
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.11.1
+	github.com/aws/smithy-go v1.6.0
 	github.com/awslabs/aws-lambda-go-api-proxy v0.10.0
 	github.com/gin-gonic/gin v1.7.2
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/golang/mock v1.6.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/prometheus/client_golang v1.12.2
+	github.com/prometheus/common v0.32.1
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+	go.opentelemetry.io/proto/otlp v0.16.0
+	google.golang.org/protobuf v1.28.0
 )
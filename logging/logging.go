@@ -0,0 +1,188 @@
+// Package logging provides structured logging as JSON lines, in the style of log/slog:
+// each record has a time, a level and a message, followed by the key-value pairs given
+// to the logger and to the call, like logger.Info("saved side", "id", id, "size", n).
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the importance of a record, valued like slog levels
+type Level int
+
+// Levels of records
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l >= LevelError:
+		return "ERROR"
+	case l >= LevelWarn:
+		return "WARN"
+	case l >= LevelInfo:
+		return "INFO"
+	}
+	return "DEBUG"
+}
+
+// ParseLevel parses the name of a level, like debug, info, warn or error, in any case
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// badKey is the key of values missing their key, like in slog
+const badKey = "!BADKEY"
+
+// Logger writes records at or above its level as JSON lines. It is safe for concurrent use.
+type Logger struct {
+	out   *output
+	level Level
+	// attrs are the encoded pairs given to With, each preceded by a comma
+	attrs []byte
+}
+
+// output serializes the writes of a logger and of those derived from it
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New creates a new Logger writing the records at or above the level to w
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level}
+}
+
+// With returns a Logger that adds the key-value pairs to each record
+func (l *Logger) With(args ...interface{}) *Logger {
+	var b bytes.Buffer
+	b.Write(l.attrs)
+	appendPairs(&b, args)
+	return &Logger{out: l.out, level: l.level, attrs: b.Bytes()}
+}
+
+// Enabled tells whether records of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Log writes a record with the message and the key-value pairs, if its level is enabled
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	appendValue(&b, time.Now())
+	b.WriteString(`,"level":`)
+	appendValue(&b, level.String())
+	b.WriteString(`,"msg":`)
+	appendValue(&b, msg)
+	b.Write(l.attrs)
+	appendPairs(&b, args)
+	b.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(b.Bytes())
+}
+
+// Debug logs at LevelDebug
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.Log(LevelDebug, msg, args...)
+}
+
+// Info logs at LevelInfo
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.Log(LevelInfo, msg, args...)
+}
+
+// Warn logs at LevelWarn
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.Log(LevelWarn, msg, args...)
+}
+
+// Error logs at LevelError
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.Log(LevelError, msg, args...)
+}
+
+// Writer returns a writer logging each line written to it as the message of a record of the level,
+// to redirect the standard log package and other plain text loggers
+func (l *Logger) Writer(level Level) io.Writer {
+	return lineWriter{l, level}
+}
+
+type lineWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.logger.Log(w.level, line)
+	}
+	return len(p), nil
+}
+
+// appendPairs encodes the key-value pairs, each preceded by a comma.
+// Arguments that are not string keys followed by a value are reported as values of badKey.
+func appendPairs(b *bytes.Buffer, args []interface{}) {
+	for len(args) > 0 {
+		key, ok := args[0].(string)
+		if !ok || len(args) == 1 {
+			appendPair(b, badKey, args[0])
+			args = args[1:]
+			continue
+		}
+		appendPair(b, key, args[1])
+		args = args[2:]
+	}
+}
+
+func appendPair(b *bytes.Buffer, key string, value interface{}) {
+	b.WriteByte(',')
+	appendValue(b, key)
+	b.WriteByte(':')
+	appendValue(b, value)
+}
+
+// appendValue encodes the value as JSON, errors and fmt.Stringers as their text
+func appendValue(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+	case time.Duration:
+		value = v.String()
+	case json.Marshaler:
+	case fmt.Stringer:
+		value = v.String()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprintf("!ERROR: %v", err))
+	}
+	b.Write(encoded)
+}
@@ -0,0 +1,138 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/logging"
+)
+
+type side string
+
+func (s side) String() string {
+	return strings.ToUpper(string(s))
+}
+
+func lines(t *testing.T, s string) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggerWritesJSONLines(t *testing.T) {
+
+	// given
+	var b strings.Builder
+	logger := logging.New(&b, logging.LevelInfo).With("request_id", "abc")
+
+	// when
+	logger.Info("side saved", "id", "1", "side", side("left"), "payload_size", 3, "error", errors.New("boom"), 42)
+
+	// then
+	if !strings.HasPrefix(b.String(), `{"time":"`) || !strings.Contains(b.String(), `,"level":"INFO","msg":"side saved","request_id":"abc","id":"1",`) {
+		t.Errorf("should start with time, level, message and the logger pairs, got: %s", b.String())
+	}
+	records := lines(t, b.String())
+	if len(records) != 1 {
+		t.Fatalf("should have written one line, got: %q", b.String())
+	}
+	expected := map[string]interface{}{
+		"level":        "INFO",
+		"msg":          "side saved",
+		"request_id":   "abc",
+		"id":           "1",
+		"side":         "LEFT",
+		"payload_size": 3.0,
+		"error":        "boom",
+		"!BADKEY":      42.0,
+	}
+	for key, value := range expected {
+		if records[0][key] != value {
+			t.Errorf("%s should be %v, got: %v", key, value, records[0][key])
+		}
+	}
+}
+
+func TestLoggerSkipsRecordsBelowItsLevel(t *testing.T) {
+
+	// given
+	var b strings.Builder
+	logger := logging.New(&b, logging.LevelWarn)
+
+	// when
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	// then
+	records := lines(t, b.String())
+	if len(records) != 2 || records[0]["level"] != "WARN" || records[1]["level"] != "ERROR" {
+		t.Errorf("should have written warnings and errors only, got: %q", b.String())
+	}
+	if logger.Enabled(logging.LevelInfo) || !logger.Enabled(logging.LevelError) {
+		t.Error("should be enabled from warnings up")
+	}
+}
+
+func TestWriterLogsEachLine(t *testing.T) {
+
+	// given
+	var b strings.Builder
+	std := log.New(logging.New(&b, logging.LevelInfo).With("source", "std").Writer(logging.LevelError), "", 0)
+
+	// when
+	std.Print("cannot export spans\nconnection refused")
+
+	// then
+	records := lines(t, b.String())
+	if len(records) != 2 || records[0]["msg"] != "cannot export spans" || records[1]["msg"] != "connection refused" {
+		t.Fatalf("should have logged each line, got: %q", b.String())
+	}
+	if records[0]["level"] != "ERROR" || records[0]["source"] != "std" {
+		t.Errorf("should have logged at the level of the writer with the logger pairs, got: %q", b.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected logging.Level
+		err      bool
+	}{
+		{"debug", logging.LevelDebug, false},
+		{"INFO", logging.LevelInfo, false},
+		{"warn", logging.LevelWarn, false},
+		{"Warning", logging.LevelWarn, false},
+		{"error", logging.LevelError, false},
+		{"verbose", 0, true},
+		{"", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// when
+			level, err := logging.ParseLevel(c.name)
+
+			// then
+			if (err != nil) != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if level != c.expected {
+				t.Errorf("should be %v, got: %v", c.expected, level)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import "testing"
+
+func TestSQLRepositoryBackend(t *testing.T) {
+	testRepositoryWiring(t, repositoryConfig{backend: "sql", sqlDriver: "sqlite3", sqlDSN: ":memory:"})
+	testRepositoryWiring(t, repositoryConfig{backend: "sql", sqlDriver: "sqlite3", sqlDSN: ":memory:", cache: "memory", cacheTTL: defaultCacheTTL})
+}
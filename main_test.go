@@ -1,13 +1,29 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/ehpalumbo/go-diff/api"
+	"github.com/ehpalumbo/go-diff/auth"
+	"github.com/ehpalumbo/go-diff/authz"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/logging"
+	"github.com/ehpalumbo/go-diff/metrics"
+	"github.com/ehpalumbo/go-diff/ratelimit"
+	"github.com/ehpalumbo/go-diff/repository"
 	"github.com/ehpalumbo/go-diff/repository/fake"
+	"github.com/ehpalumbo/go-diff/tracing"
 )
 
 type DiffResponseBody struct {
@@ -21,7 +37,7 @@ type DiffResponseBody struct {
 var handler LambdaHandler
 
 func TestMain(m *testing.M) {
-	handler = initLambdaHandler(fake.NewFakeDiffRepository())
+	handler = initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{})
 	c := m.Run()
 	os.Exit(c)
 }
@@ -114,6 +130,28 @@ func TestDiffWithOverride(t *testing.T) {
 
 }
 
+func TestProblemDetails(t *testing.T) {
+
+	r, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/v1/diff/5",
+		Headers:    map[string]string{"Accept": "application/problem+json"},
+	})
+
+	var body struct {
+		Type   string `json:"type"`
+		Status int    `json:"status"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil || body.Status != 404 || body.ID != "5" || body.Type != "urn:go-diff:problem:not_found" {
+		t.Errorf("missing diff, got wrong problem details: %d, %s", r.StatusCode, r.Body)
+	}
+	if contentType := r.MultiValueHeaders["Content-Type"]; len(contentType) != 1 || contentType[0] != "application/problem+json" {
+		t.Errorf("missing diff, got wrong content type: %v", contentType)
+	}
+
+}
+
 func TestPayloadRejected(t *testing.T) {
 
 	r := performPOST(t, "7", "left", []byte("not/base64"))
@@ -122,10 +160,605 @@ func TestPayloadRejected(t *testing.T) {
 		t.Fatalf("accepted invalid data, got status: %d, body: %v", r.StatusCode, r.Body)
 	}
 
+	r = performPOST(t, "7", "left", []byte(`{"data": "not base64"}`))
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil || r.StatusCode != 400 || body.Code != "invalid_payload" {
+		t.Errorf("accepted data not in base64, got status: %d, body: %v", r.StatusCode, r.Body)
+	}
+
+}
+
+func TestDeleteDiff(t *testing.T) {
+
+	upload(t, "8", "left", "R29sYW5n")
+	upload(t, "8", "right", "R29sYW5n")
+
+	if r := performDELETE(t, "8/right"); r.StatusCode != 204 {
+		t.Fatalf("DELETE 8/right, got wrong status code: %d", r.StatusCode)
+	}
+
+	diff := diff(t, "8")
+
+	if diff.Result != "SIZE_MISMATCH" {
+		t.Errorf("got wrong result: %s", diff.Result)
+	}
+
+	if r := performDELETE(t, "8"); r.StatusCode != 204 {
+		t.Fatalf("DELETE 8, got wrong status code: %d", r.StatusCode)
+	}
+
+	if r := performGET(t, "8"); r.StatusCode != 404 {
+		t.Errorf("deleted diff still found, got status: %d", r.StatusCode)
+	}
+
+}
+
+func TestListDiffs(t *testing.T) {
+
+	upload(t, "list-2", "left", "R29sYW5n")
+	upload(t, "list-1", "left", "R29sYW5n")
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:            "GET",
+		Path:                  "/v1/diff",
+		QueryStringParameters: map[string]string{"prefix": "list-"},
+	})
+
+	if res.StatusCode != 200 {
+		t.Fatalf("GET /v1/diff, got wrong status code: %d, body: %v", res.StatusCode, res.Body)
+	}
+	var body struct {
+		Diffs []struct {
+			ID string `json:"id"`
+		} `json:"diffs"`
+	}
+	if err := json.Unmarshal([]byte(res.Body), &body); err != nil {
+		t.Fatal("cannot parse list response body", err)
+	}
+	if len(body.Diffs) != 2 || body.Diffs[0].ID != "list-1" || body.Diffs[1].ID != "list-2" {
+		t.Errorf("got wrong diffs: %v", body.Diffs)
+	}
+
+}
+
+func TestDownloadSide(t *testing.T) {
+
+	upload(t, "9", "left", "R29sYW5n")
+
+	r := performGET(t, "9/left")
+
+	if r.StatusCode != 200 {
+		t.Fatalf("GET 9/left, got wrong status code: %d, body: %v", r.StatusCode, r.Body)
+	}
+	if r.Body != "Golang" {
+		t.Errorf("got wrong side data: %s", r.Body)
+	}
+
+}
+
+func TestSideMetadata(t *testing.T) {
+
+	p, _ := json.Marshal(map[string]interface{}{
+		"data":         "R29sYW5n",
+		"filename":     "golang.txt",
+		"content_type": "text/plain",
+		"labels":       map[string]string{"lang": "go"},
+	})
+	if r := performPOST(t, "10", "left", p); r.StatusCode != 204 {
+		t.Fatalf("POST 10/left, got wrong status code: %d, body: %v", r.StatusCode, r.Body)
+	}
+
+	r := performGET(t, "10/meta")
+
+	if r.StatusCode != 200 {
+		t.Fatalf("GET 10/meta, got wrong status code: %d, body: %v", r.StatusCode, r.Body)
+	}
+	var body struct {
+		Sides map[string]struct {
+			Filename    string            `json:"filename"`
+			ContentType string            `json:"content_type"`
+			Labels      map[string]string `json:"labels"`
+		} `json:"sides"`
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil {
+		t.Fatal("cannot parse metadata response body", err)
+	}
+	left := body.Sides["left"]
+	if left.Filename != "golang.txt" || left.ContentType != "text/plain" || left.Labels["lang"] != "go" {
+		t.Errorf("got wrong side metadata: %v", body.Sides)
+	}
+
+	r = performGET(t, "10/left")
+	if ct := r.MultiValueHeaders["Content-Type"]; len(ct) != 1 || ct[0] != "text/plain" {
+		t.Errorf("got wrong content type: %v", ct)
+	}
+
+}
+
+func TestVersionedDiff(t *testing.T) {
+
+	upload(t, "11", "left", "R29sYW5n")
+	upload(t, "11", "left", "R29waGVy")
+	upload(t, "11", "right", "R29sYW5n")
+
+	r := performGET(t, "11/left/versions")
+
+	if r.StatusCode != 200 {
+		t.Fatalf("GET 11/left/versions, got wrong status code: %d, body: %v", r.StatusCode, r.Body)
+	}
+	var body struct {
+		Versions []struct {
+			Version int `json:"version"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil {
+		t.Fatal("cannot parse versions response body", err)
+	}
+	if len(body.Versions) != 2 || body.Versions[1].Version != 2 {
+		t.Errorf("got wrong versions: %v", body.Versions)
+	}
+
+	if result := diff(t, "11").Result; result != "NOT_EQUAL" {
+		t.Errorf("got wrong result for latest versions: %s", result)
+	}
+	if result := diff(t, "11?left=v1&right=v1").Result; result != "EQUAL" {
+		t.Errorf("got wrong result for first versions: %s", result)
+	}
+
+}
+
+func TestConditionalUpload(t *testing.T) {
+
+	post := func(headers map[string]string) int {
+		res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "POST",
+			Path:       "/v1/diff/12/left",
+			Headers:    headers,
+			Body:       `{"data": "R29sYW5n"}`,
+		})
+		return res.StatusCode
+	}
+
+	if status := post(map[string]string{"If-None-Match": "*"}); status != 204 {
+		t.Fatalf("first upload, got wrong status code: %d", status)
+	}
+	if status := post(map[string]string{"If-None-Match": "*"}); status != 412 {
+		t.Errorf("second create-only upload, got wrong status code: %d", status)
+	}
+
+	etag := performGET(t, "12/left").MultiValueHeaders["Etag"]
+	if len(etag) != 1 {
+		t.Fatalf("got no ETag for uploaded side")
+	}
+	if status := post(map[string]string{"If-Match": etag[0]}); status != 204 {
+		t.Errorf("upload matching the ETag, got wrong status code: %d", status)
+	}
+
+}
+
+func TestLockedSession(t *testing.T) {
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Path:       "/v1/diff",
+		Body:       `{"lock_when_complete": true}`,
+	})
+	if res.StatusCode != 201 {
+		t.Fatalf("POST /v1/diff, got wrong status code: %d, body: %v", res.StatusCode, res.Body)
+	}
+	var session struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(res.Body), &session); err != nil || session.ID == "" {
+		t.Fatalf("cannot parse session response body: %s", res.Body)
+	}
+
+	upload(t, session.ID, "left", "R29sYW5n")
+	upload(t, session.ID, "right", "R29sYW5n")
+
+	p, _ := json.Marshal(map[string]string{"data": "R29waGVy"})
+	if r := performPOST(t, session.ID, "left", p); r.StatusCode != 409 {
+		t.Errorf("upload to locked diff, got wrong status code: %d", r.StatusCode)
+	}
+
+	var report struct {
+		Result  string `json:"result"`
+		Session struct {
+			Locked bool `json:"locked"`
+		} `json:"session"`
+	}
+	r := performGET(t, session.ID)
+	if err := json.Unmarshal([]byte(r.Body), &report); err != nil {
+		t.Fatal("cannot parse diff response body", err)
+	}
+	if report.Result != "EQUAL" || !report.Session.Locked {
+		t.Errorf("got wrong report for locked diff: %s", r.Body)
+	}
+
+}
+
+func TestTenantIsolation(t *testing.T) {
+
+	request := func(method, path, tenant, body string) events.APIGatewayProxyResponse {
+		res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: method,
+			Path:       path,
+			Headers:    map[string]string{"X-Tenant-ID": tenant},
+			Body:       body,
+		})
+		return res
+	}
+
+	if r := request("POST", "/v1/diff/13/left", "acme", `{"data": "R29sYW5n"}`); r.StatusCode != 204 {
+		t.Fatalf("tenant upload, got wrong status code: %d, body: %v", r.StatusCode, r.Body)
+	}
+	if r := request("GET", "/v1/diff/13", "acme", ""); r.StatusCode != 200 {
+		t.Errorf("tenant read, got wrong status code: %d", r.StatusCode)
+	}
+	if r := request("GET", "/v1/diff/13", "other", ""); r.StatusCode != 404 {
+		t.Errorf("read from another tenant, got wrong status code: %d", r.StatusCode)
+	}
+	if r := performGET(t, "13"); r.StatusCode != 404 {
+		t.Errorf("read from default tenant, got wrong status code: %d", r.StatusCode)
+	}
+	request("DELETE", "/v1/diff/13", "other", "")
+	if r := request("GET", "/v1/diff/13", "acme", ""); r.StatusCode != 200 {
+		t.Errorf("read after delete from another tenant, got wrong status code: %d", r.StatusCode)
+	}
+
+}
+
+func TestTenantQuota(t *testing.T) {
+
+	quoted := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{quota: domain.TenantQuota{MaxDiffs: 1}})
+	upload := func(ID, tenant string) int {
+		res, _ := quoted(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "POST",
+			Path:       "/v1/diff/" + ID + "/left",
+			Headers:    map[string]string{"X-Tenant-ID": tenant},
+			Body:       `{"data": "R29sYW5n"}`,
+		})
+		return res.StatusCode
+	}
+
+	if status := upload("1", "acme"); status != 204 {
+		t.Fatalf("first upload, got wrong status code: %d", status)
+	}
+	if status := upload("2", "acme"); status != 403 {
+		t.Errorf("upload over quota, got wrong status code: %d", status)
+	}
+	if status := upload("2", "other"); status != 204 {
+		t.Errorf("upload of another tenant, got wrong status code: %d", status)
+	}
+
+}
+
+func TestAuthentication(t *testing.T) {
+
+	keys := auth.NewAPIKeyAuthenticator(map[string]domain.Identity{
+		auth.HashAPIKey("acme-key"): {Subject: "ci", Tenant: domain.Tenant("acme")},
+	})
+	authenticated := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{authenticator: keys})
+	request := func(method, path, key string) events.APIGatewayProxyResponse {
+		res, _ := authenticated(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: method,
+			Path:       path,
+			Headers:    map[string]string{"X-API-Key": key},
+			Body:       `{"data": "R29sYW5n"}`,
+		})
+		return res
+	}
+
+	if r := request("POST", "/v1/diff/1/left", ""); r.StatusCode != 401 {
+		t.Errorf("upload without key, got wrong status code: %d", r.StatusCode)
+	}
+	if r := request("POST", "/v1/diff/1/left", "guess"); r.StatusCode != 401 {
+		t.Errorf("upload with unknown key, got wrong status code: %d", r.StatusCode)
+	}
+	if r := request("POST", "/v1/diff/1/left", "acme-key"); r.StatusCode != 204 {
+		t.Fatalf("upload with known key, got wrong status code: %d, body: %v", r.StatusCode, r.Body)
+	}
+
+	r := request("GET", "/v1/diff/1/meta", "acme-key")
+	var body struct {
+		Sides map[string]struct {
+			Uploader string `json:"uploader"`
+		} `json:"sides"`
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil || body.Sides["left"].Uploader != "ci" {
+		t.Errorf("metadata with known key, got wrong response: %d, %s", r.StatusCode, r.Body)
+	}
+
+}
+
+func TestAuthorization(t *testing.T) {
+
+	keys := auth.NewAPIKeyAuthenticator(map[string]domain.Identity{
+		auth.HashAPIKey("reader-key"): {Subject: "reader"},
+		auth.HashAPIKey("writer-key"): {Subject: "writer"},
+		auth.HashAPIKey("admin-key"):  {Subject: "admin"},
+	})
+	policy, err := authz.ParsePolicy([]byte(`{"bindings": [
+		{"subject": "reader", "role": "reader"},
+		{"subject": "writer", "role": "writer", "prefixes": ["ci-"]},
+		{"subject": "admin", "role": "admin"}
+	]}`))
+	if err != nil {
+		t.Fatal("cannot parse test policy", err)
+	}
+	authorized := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{authenticator: keys, policy: &policy})
+	request := func(method, path, key string) int {
+		res, _ := authorized(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: method,
+			Path:       path,
+			Headers:    map[string]string{"X-API-Key": key},
+			Body:       `{"data": "R29sYW5n"}`,
+		})
+		return res.StatusCode
+	}
+
+	steps := []struct {
+		method, path, key string
+		status            int
+	}{
+		{"POST", "/v1/diff/ci-1/left", "reader-key", 403},
+		{"POST", "/v1/diff/prod-1/left", "writer-key", 403},
+		{"POST", "/v1/diff/ci-1/left", "writer-key", 204},
+		{"GET", "/v1/diff/ci-1", "reader-key", 200},
+		{"GET", "/v1/diff", "writer-key", 403},
+		{"DELETE", "/v1/diff/ci-1", "writer-key", 403},
+		{"GET", "/v1/diff", "admin-key", 200},
+		{"DELETE", "/v1/diff/ci-1", "admin-key", 204},
+	}
+	for _, s := range steps {
+		if status := request(s.method, s.path, s.key); status != s.status {
+			t.Errorf("%s %s with %s, got wrong status code: %d", s.method, s.path, s.key, status)
+		}
+	}
+
+}
+
+func TestRateLimits(t *testing.T) {
+
+	limited := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{
+		uploadLimiter: ratelimit.NewTokenBucketLimiter(0.01, 1),
+		reportLimiter: ratelimit.NewTokenBucketLimiter(0.01, 2),
+	})
+	request := func(method string) events.APIGatewayProxyResponse {
+		res, _ := limited(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: method,
+			Path:       "/v1/diff/1/left",
+			Body:       `{"data": "R29sYW5n"}`,
+		})
+		return res
+	}
+
+	if r := request("POST"); r.StatusCode != 204 {
+		t.Fatalf("first upload, got wrong status code: %d", r.StatusCode)
+	}
+	r := request("POST")
+	if r.StatusCode != 429 || len(r.MultiValueHeaders["Retry-After"]) != 1 {
+		t.Errorf("upload over limit, got wrong response: %d, %v", r.StatusCode, r.MultiValueHeaders)
+	}
+	for i := 0; i < 2; i++ {
+		if r := request("GET"); r.StatusCode != 200 {
+			t.Errorf("download within separate limit, got wrong status code: %d", r.StatusCode)
+		}
+	}
+	if r := request("GET"); r.StatusCode != 429 {
+		t.Errorf("download over limit, got wrong status code: %d", r.StatusCode)
+	}
+
+}
+
+func TestRateLimitsBySourceIP(t *testing.T) {
+
+	limited := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{
+		uploadLimiter: ratelimit.NewTokenBucketLimiter(0.01, 1),
+	})
+	upload := func(sourceIP string) int {
+		res, _ := limited(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "POST",
+			Path:       "/v1/diff/1/left",
+			Body:       `{"data": "R29sYW5n"}`,
+			// clients may forge forwarding headers, but not the source IP seen by API Gateway
+			Headers:        map[string]string{"X-Forwarded-For": "203.0.113." + sourceIP[len(sourceIP)-1:]},
+			RequestContext: events.APIGatewayProxyRequestContext{Identity: events.APIGatewayRequestIdentity{SourceIP: sourceIP}},
+		})
+		return res.StatusCode
+	}
+
+	if status := upload("192.0.2.1"); status != 204 {
+		t.Fatalf("first upload, got wrong status code: %d", status)
+	}
+	if status := upload("192.0.2.1"); status != 429 {
+		t.Errorf("upload over limit of the source IP, got wrong status code: %d", status)
+	}
+	if status := upload("192.0.2.2"); status != 204 {
+		t.Errorf("upload from another source IP, got wrong status code: %d", status)
+	}
+
+}
+
+func TestSizeLimits(t *testing.T) {
+
+	limited := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{limits: domain.SizeLimits{MaxSideBytes: 6, MaxDiffBytes: 10}})
+	upload := func(side, data string) int {
+		res, _ := limited(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "POST",
+			Path:       "/v1/diff/1/" + side,
+			Body:       `{"data": "` + data + `"}`,
+		})
+		return res.StatusCode
+	}
+
+	// "R29sYW5n" is "Golang", "R28=" is "Go" and "R29sYW5ncw==" is "Golangs"
+	if status := upload("left", "R29sYW5n"); status != 204 {
+		t.Fatalf("upload within limits, got wrong status code: %d", status)
+	}
+	if status := upload("right", "R28="); status != 204 {
+		t.Errorf("upload within diff limit, got wrong status code: %d", status)
+	}
+	if status := upload("right", "R29sYW5n"); status != 413 {
+		t.Errorf("upload over diff limit, got wrong status code: %d", status)
+	}
+	if status := upload("left", "R29sYW5ncw=="); status != 413 {
+		t.Errorf("upload over side limit, got wrong status code: %d", status)
+	}
+	if status := upload("left", strings.Repeat("R29sYW5n", 10<<10)); status != 413 {
+		t.Errorf("upload of oversized body, got wrong status code: %d", status)
+	}
+
+}
+
+func TestOperationalEndpoints(t *testing.T) {
+
+	repo := repository.NewResilientDiffRepository(fake.NewFakeDiffRepository(), repository.DefaultResilienceConfig())
+	config := handlerConfig{healthChecks: map[string]api.HealthCheck{"repository": repo.Health}}
+	lambdaHandler := initLambdaHandler(repo, config)
+	server := httptest.NewServer(initServer(repo, config))
+	defer server.Close()
+
+	for _, path := range []string{"/healthz", "/readyz", "/version"} {
+		res, _ := lambdaHandler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: path})
+		if res.StatusCode != 200 {
+			t.Errorf("GET %s behind the Lambda adapter, got wrong status code: %d", path, res.StatusCode)
+		}
+		direct, err := http.Get(server.URL + path)
+		if err != nil || direct.StatusCode != 200 {
+			t.Errorf("GET %s from the standalone server, got: %v, %v", path, direct, err)
+		}
+		if direct != nil {
+			direct.Body.Close()
+		}
+	}
+
+	res, _ := lambdaHandler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/readyz"})
+	var body api.HealthResponseBody
+	json.Unmarshal([]byte(res.Body), &body)
+	if body.Status != api.HealthUp || body.Checks["repository"].Status != api.HealthUp {
+		t.Errorf("GET /readyz, got wrong body: %s", res.Body)
+	}
+
+}
+
+func TestMetrics(t *testing.T) {
+
+	var logged strings.Builder
+	emf := metrics.NewRegistry(metrics.NewEMFLogger(&logged, metricsNamespace))
+	prometheus := metrics.NewRegistry()
+	lambdaHandler := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{metrics: emf})
+	server := httptest.NewServer(initServer(fake.NewFakeDiffRepository(), handlerConfig{metrics: prometheus}))
+	defer server.Close()
+
+	for _, req := range []events.APIGatewayProxyRequest{
+		{HTTPMethod: "POST", Path: "/v1/diff/1/left", Body: `{"data": "R29sYW5n"}`},
+		{HTTPMethod: "POST", Path: "/v1/diff/1/right", Body: `{"data": "R29sYW5n"}`},
+		{HTTPMethod: "GET", Path: "/v1/diff/1"},
+	} {
+		lambdaHandler(context.Background(), req)
+		direct, _ := http.NewRequest(req.HTTPMethod, server.URL+req.Path, strings.NewReader(req.Body))
+		if res, err := http.DefaultClient.Do(direct); err == nil {
+			res.Body.Close()
+		}
+	}
+
+	for _, metric := range []string{`"godiff_http_request_duration_seconds":`, `"godiff_diff_duration_seconds":`, `"result":"EQUAL"`} {
+		if !strings.Contains(logged.String(), metric) {
+			t.Errorf("missing embedded metric %s, got:\n%s", metric, logged.String())
+		}
+	}
+
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	for _, sample := range []string{
+		`godiff_http_request_duration_seconds_count{method="POST",route="/v1/diff/:id/:side",status="204"} 2`,
+		`godiff_diff_duration_seconds_count{differ="bytewise",result="EQUAL"} 1`,
+	} {
+		if !strings.Contains(string(body), sample) {
+			t.Errorf("missing sample %s, got:\n%s", sample, body)
+		}
+	}
+
+}
+
+func TestTracing(t *testing.T) {
+
+	var exported strings.Builder
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&exported), "go-diff")
+	defer tracer.Shutdown(context.Background())
+	traced := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{tracer: tracer})
+	traceparent := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+
+	traced(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/v1/diff/1/left", Body: `{"data": "R29sYW5n"}`})
+	traced(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/v1/diff/1", Headers: traceparent})
+
+	// spans are exported by the end of each invocation, without waiting for the tracer to shut down
+	names := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(exported.String()), "\n") {
+		var span tracing.SpanLine
+		json.Unmarshal([]byte(line), &span)
+		names[span.Name] = span.TraceID
+	}
+	for _, name := range []string{"GET /v1/diff/:id", "DiffService.GetDiffReport", "Differ.Diff"} {
+		if names[name] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s not exported within the trace of the caller, got: %s", name, exported.String())
+		}
+	}
+	if _, ok := names["DiffService.Save"]; !ok {
+		t.Errorf("upload not traced, got: %s", exported.String())
+	}
+
+}
+
+func TestLogging(t *testing.T) {
+
+	var logs strings.Builder
+	logged := initLambdaHandler(fake.NewFakeDiffRepository(), handlerConfig{logger: logging.New(&logs, logging.LevelInfo)})
+	requestID := map[string]string{"X-Request-ID": "req-1"}
+
+	logged(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/v1/diff/1/left", Body: `{"data": "R29sYW5n"}`})
+	res, _ := logged(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/v1/diff/2", Headers: requestID})
+
+	// the request ID of the client is echoed in the response and in the error body
+	if id := res.MultiValueHeaders["X-Request-Id"]; len(id) != 1 || id[0] != "req-1" {
+		t.Errorf("request ID not echoed, got: %v", res.MultiValueHeaders)
+	}
+	var body api.ErrorResponseBody
+	json.Unmarshal([]byte(res.Body), &body)
+	if body.RequestID != "req-1" {
+		t.Errorf("request ID not in error body, got: %s", res.Body)
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line is not JSON, got: %s", line)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("each request should have been logged, got: %s", logs.String())
+	}
+	if records[0]["diff_id"] != "1" || records[0]["side"] != "left" || records[0]["payload_size"] != 6.0 {
+		t.Errorf("upload logged without its diff fields, got: %s", logs.String())
+	}
+	if records[1]["request_id"] != "req-1" || records[1]["status"] != 404.0 || records[1]["error_code"] != "not_found" {
+		t.Errorf("report logged without its request ID and error, got: %s", logs.String())
+	}
+
 }
 
 func performPOST(t *testing.T, ID, side string, p []byte) events.APIGatewayProxyResponse {
-	res, _ := handler(events.APIGatewayProxyRequest{
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
 		HTTPMethod: "POST",
 		Path:       fmt.Sprintf("/v1/diff/%s/%s", ID, side),
 		PathParameters: map[string]string{
@@ -153,7 +786,7 @@ func upload(t *testing.T, ID string, side string, data string) {
 }
 
 func performGET(t *testing.T, ID string) events.APIGatewayProxyResponse {
-	res, _ := handler(events.APIGatewayProxyRequest{
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
 		HTTPMethod: "GET",
 		Path:       fmt.Sprintf("/v1/diff/%s", ID),
 		PathParameters: map[string]string{
@@ -163,6 +796,14 @@ func performGET(t *testing.T, ID string) events.APIGatewayProxyResponse {
 	return res
 }
 
+func performDELETE(t *testing.T, path string) events.APIGatewayProxyResponse {
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "DELETE",
+		Path:       "/v1/diff/" + path,
+	})
+	return res
+}
+
 func diff(t *testing.T, ID string) (body DiffResponseBody) {
 	r := performGET(t, ID)
 
@@ -175,3 +816,109 @@ func diff(t *testing.T, ID string) (body DiffResponseBody) {
 	}
 	return
 }
+
+// testRepositoryWiring checks that a repository created from the configuration stores and reads diffs,
+// behind a cache tier if configured
+func testRepositoryWiring(t *testing.T, config repositoryConfig) {
+	repo, err := newRepository(config)
+	if err != nil {
+		t.Fatalf("cannot create repository: %v", err)
+	}
+	if _, tiered := repo.(*repository.TieredDiffRepository); tiered != (config.cache != "") {
+		t.Errorf("wrong cache tier, got: %T", repo)
+	}
+	ctx := context.Background()
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("cannot ping repository: %v", err)
+	}
+	if err := repo.SaveDataSide(ctx, "1", "left", []byte("Golang"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("cannot save side: %v", err)
+	}
+	sides, err := repo.GetDataSidesByID(ctx, "1")
+	if err != nil || string(sides["left"]) != "Golang" {
+		t.Errorf("cannot read saved side, got: %q, %v", sides, err)
+	}
+}
+
+func TestRepositoryBackends(t *testing.T) {
+
+	server := miniredis.RunT(t)
+	redisURL := "redis://" + server.Addr() + "/0"
+	cases := []struct {
+		name   string
+		config repositoryConfig
+	}{
+		{"memory", repositoryConfig{backend: "memory"}},
+		{"redis", repositoryConfig{backend: "redis", redisURL: redisURL, ttl: time.Hour}},
+		{"memory cached in redis", repositoryConfig{backend: "memory", cache: "redis", redisURL: redisURL, cacheTTL: time.Minute}},
+		{"redis cached in memory", repositoryConfig{backend: "redis", cache: "memory", redisURL: redisURL, cacheMaxBytes: 1 << 10, cacheTTL: time.Minute}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server.FlushAll()
+			testRepositoryWiring(t, c.config)
+		})
+	}
+
+}
+
+func TestRepositoryMisconfiguration(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		config repositoryConfig
+		err    string
+	}{
+		{"unknown backend", repositoryConfig{backend: "dynamodb"}, `unknown repository backend "dynamodb"`},
+		{"unknown cache", repositoryConfig{backend: "memory", cache: "memcached"}, `unknown cache tier "memcached"`},
+		{"cached in itself", repositoryConfig{backend: "memory", cache: "memory"}, "cannot cache the memory backend in itself"},
+		{"unknown SQL driver", repositoryConfig{backend: "sql", sqlDriver: "oracle"}, `unknown SQL driver "oracle"`},
+		{"invalid Redis URL", repositoryConfig{backend: "redis", redisURL: "localhost:6379"}, "invalid Redis URL"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := newRepository(c.config)
+			if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+				t.Errorf("should have failed with %q, got: %v", c.err, err)
+			}
+		})
+	}
+
+}
+
+func TestRepositoryConfigFromEnv(t *testing.T) {
+
+	env := map[string]string{
+		"REPOSITORY_BACKEND":   "redis",
+		"REDIS_URL":            "redis://cache:6379/1",
+		"REPOSITORY_TTL":       "24h",
+		"CACHE_TIER":           "memory",
+		"CACHE_MAX_BYTES":      "1024",
+		"REPOSITORY_MAX_BYTES": "2048",
+		"TENANT_MAX_DIFFS":     "10",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	config := getRepositoryConfig()
+
+	expected := repositoryConfig{backend: "redis", cache: "memory", redisURL: "redis://cache:6379/1",
+		maxBytes: 2048, ttl: 24 * time.Hour, cacheMaxBytes: 1024, cacheTTL: defaultCacheTTL, keepUsage: true}
+	if config != expected {
+		t.Errorf("wrong configuration, expected: %+v, got: %+v", expected, config)
+	}
+
+}
+
+func TestRepositoryConfigDefaults(t *testing.T) {
+
+	config := getRepositoryConfig()
+
+	expected := repositoryConfig{backend: "s3", redisURL: "redis://localhost:6379/0", cacheMaxBytes: defaultCacheMaxBytes, cacheTTL: defaultCacheTTL}
+	if config != expected {
+		t.Errorf("wrong configuration, expected: %+v, got: %+v", expected, config)
+	}
+
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// emfUnits maps units to the units of CloudWatch metrics
+var emfUnits = map[Unit]string{
+	Count:   "Count",
+	Seconds: "Seconds",
+	Bytes:   "Bytes",
+}
+
+// EMFLogger is an Observer writing each observation as a log line in the CloudWatch embedded metric format,
+// from which CloudWatch Logs extracts a metric with the labels of the observation as dimensions.
+// Lambda functions ship the lines written to stdout to CloudWatch Logs, so no agent is required.
+type EMFLogger struct {
+	mu        sync.Mutex
+	w         io.Writer
+	namespace string
+	now       func() time.Time
+}
+
+// NewEMFLogger creates a new EMFLogger writing metrics of the namespace to w
+func NewEMFLogger(w io.Writer, namespace string) *EMFLogger {
+	return &EMFLogger{w: w, namespace: namespace, now: time.Now}
+}
+
+// Observe writes the observation as a single line, failures to write being ignored
+func (l *EMFLogger) Observe(name string, unit Unit, value float64, labels []Label) {
+	dimensions := make([]string, len(labels))
+	line := make(map[string]interface{}, len(labels)+2)
+	for i, label := range labels {
+		dimensions[i] = label.Name
+		line[label.Name] = label.Value
+	}
+	line[name] = value
+	line["_aws"] = emfMetadata{
+		Timestamp: l.now().UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  l.namespace,
+			Dimensions: [][]string{dimensions},
+			Metrics:    []emfMetric{{Name: name, Unit: emfUnits[unit]}},
+		}},
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
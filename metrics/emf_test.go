@@ -0,0 +1,50 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/metrics"
+)
+
+func TestEMFLoggerWritesEmbeddedMetrics(t *testing.T) {
+
+	// given
+	var b strings.Builder
+	registry := metrics.NewRegistry(metrics.NewEMFLogger(&b, "GoDiff"))
+
+	// when
+	registry.Histogram("latency_seconds", "Latency.", metrics.Seconds, metrics.DefBuckets, "route", "status").Observe(0.25, "/v1/diff/:id", "200")
+
+	// then
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("should have written one line, got: %q", b.String())
+	}
+	var line struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		Route   string  `json:"route"`
+		Status  string  `json:"status"`
+		Latency float64 `json:"latency_seconds"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if line.Route != "/v1/diff/:id" || line.Status != "200" || line.Latency != 0.25 || line.AWS.Timestamp == 0 {
+		t.Errorf("wrong values, got: %s", lines[0])
+	}
+	directives := line.AWS.CloudWatchMetrics
+	if len(directives) != 1 || directives[0].Namespace != "GoDiff" ||
+		strings.Join(directives[0].Dimensions[0], ",") != "route,status" ||
+		directives[0].Metrics[0].Name != "latency_seconds" || directives[0].Metrics[0].Unit != "Seconds" {
+		t.Errorf("wrong metric directive, got: %s", lines[0])
+	}
+}
@@ -0,0 +1,148 @@
+// Package metrics provides the counters, histograms and gauges of the application.
+// A Registry collects them with the Prometheus client library for Prometheus to scrape,
+// and passes every observation on to its observers, like the CloudWatch EMFLogger.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Unit is the unit of the values of a metric
+type Unit string
+
+// Units of metrics, named like the suffixes of Prometheus metric names
+const (
+	Count   Unit = "total"
+	Seconds Unit = "seconds"
+	Bytes   Unit = "bytes"
+)
+
+// DefBuckets are the default buckets of latency histograms, in seconds
+var DefBuckets = prometheus.DefBuckets
+
+// ExponentialBuckets returns count buckets, the first one being start and each following one factor times the previous
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	return prometheus.ExponentialBuckets(start, factor, count)
+}
+
+// Label is a dimension of an observation
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Observer receives every observation made through a Registry
+type Observer interface {
+	Observe(name string, unit Unit, value float64, labels []Label)
+}
+
+// Registry collects the metrics of the application. It is safe for concurrent use.
+type Registry struct {
+	prometheus *prometheus.Registry
+	handler    http.Handler
+	observers  []Observer
+}
+
+// NewRegistry creates a new Registry passing observations on to the observers
+func NewRegistry(observers ...Observer) *Registry {
+	registry := prometheus.NewRegistry()
+	return &Registry{
+		prometheus: registry,
+		handler:    promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		observers:  observers,
+	}
+}
+
+// Counter is a monotonically increasing metric, partitioned by the values of its labels
+type Counter struct {
+	registry *Registry
+	name     string
+	labels   []string
+	vec      *prometheus.CounterVec
+}
+
+// Histogram counts values in buckets, partitioned by the values of its labels
+type Histogram struct {
+	registry *Registry
+	name     string
+	unit     Unit
+	labels   []string
+	vec      *prometheus.HistogramVec
+}
+
+// Counter returns the counter with the name, registering it if it is not yet.
+// Getting a metric registered with different labels or of another kind panics.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	vec, ok := r.register(prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)).(*prometheus.CounterVec)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s already registered as another kind", name))
+	}
+	return &Counter{r, name, append([]string(nil), labels...), vec}
+}
+
+// Histogram returns the histogram with the name, registering it if it is not yet.
+// Getting a metric registered with different labels or of another kind panics.
+func (r *Registry) Histogram(name, help string, unit Unit, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	opts := prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}
+	vec, ok := r.register(prometheus.NewHistogramVec(opts, labels)).(*prometheus.HistogramVec)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s already registered as another kind", name))
+	}
+	return &Histogram{r, name, unit, append([]string(nil), labels...), vec}
+}
+
+// GaugeFunc registers a gauge whose value is read from f whenever metrics are collected.
+// Since gauges are not observed, observers never receive their values.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, f))
+}
+
+// register registers the collector, returning instead the one registered before with the same name and labels, if any
+func (r *Registry) register(c prometheus.Collector) prometheus.Collector {
+	err := r.prometheus.Register(c)
+	if registered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return registered.ExistingCollector
+	}
+	if err != nil {
+		panic(fmt.Sprintf("metrics: %v", err))
+	}
+	return c
+}
+
+// Inc adds one to the counter of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds a non-negative value to the counter of the label values
+func (c *Counter) Add(v float64, values ...string) {
+	c.vec.WithLabelValues(values...).Add(v)
+	c.registry.notify(c.name, Count, v, c.labels, values)
+}
+
+// Observe adds a value to the histogram of the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.vec.WithLabelValues(values...).Observe(v)
+	h.registry.notify(h.name, h.unit, v, h.labels, values)
+}
+
+// notify passes an observation on to the observers
+func (r *Registry) notify(name string, unit Unit, v float64, names, values []string) {
+	if len(r.observers) == 0 {
+		return
+	}
+	labels := make([]Label, len(values))
+	for i, value := range values {
+		labels[i] = Label{names[i], value}
+	}
+	for _, o := range r.observers {
+		o.Observe(name, unit, v, labels)
+	}
+}
@@ -0,0 +1,158 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/metrics"
+)
+
+type observation struct {
+	name   string
+	unit   metrics.Unit
+	value  float64
+	labels []metrics.Label
+}
+
+type recorder []observation
+
+func (r *recorder) Observe(name string, unit metrics.Unit, value float64, labels []metrics.Label) {
+	*r = append(*r, observation{name, unit, value, labels})
+}
+
+func TestWriteTextExposition(t *testing.T) {
+
+	// given
+	registry := metrics.NewRegistry()
+	requests := registry.Counter("requests_total", "Requests by route.", "route")
+	latency := registry.Histogram("latency_seconds", "Latency of\nrequests.", metrics.Seconds, []float64{1, 0.1}, "route")
+	registry.GaugeFunc("up", "Whether it is up.", func() float64 { return 1 })
+
+	requests.Inc("/b")
+	requests.Add(2, `/a"`)
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(5, "/a")
+
+	// when
+	var b strings.Builder
+	err := registry.WriteText(&b)
+
+	// then
+	expected := `# HELP latency_seconds Latency of\nrequests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/a\""} 2
+requests_total{route="/b"} 1
+# HELP up Whether it is up.
+# TYPE up gauge
+up 1
+`
+	if err != nil || b.String() != expected {
+		t.Errorf("wrong exposition, expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestServeHTTPSetsContentType(t *testing.T) {
+
+	// given
+	registry := metrics.NewRegistry()
+	registry.Counter("requests_total", "Requests.").Inc()
+	w := httptest.NewRecorder()
+
+	// when
+	registry.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	// then
+	if w.Header().Get("Content-Type") != metrics.TextContentType {
+		t.Errorf("wrong content type, got: %s", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "requests_total 1\n") {
+		t.Errorf("wrong body, got: %s", w.Body)
+	}
+}
+
+func TestRegistryPassesObservationsOn(t *testing.T) {
+
+	// given
+	var observed recorder
+	registry := metrics.NewRegistry(&observed)
+
+	// when
+	registry.Histogram("size_bytes", "Sizes.", metrics.Bytes, nil, "side").Observe(42, "left")
+	registry.Counter("errors_total", "Errors.").Inc()
+
+	// then
+	expected := recorder{
+		{"size_bytes", metrics.Bytes, 42, []metrics.Label{{"side", "left"}}},
+		{"errors_total", metrics.Count, 1, []metrics.Label{}},
+	}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Errorf("wrong observations, expected: %v, got: %v", expected, observed)
+	}
+}
+
+func TestRegistryReturnsRegisteredMetrics(t *testing.T) {
+
+	// given
+	registry := metrics.NewRegistry()
+	registry.Counter("requests_total", "Requests.", "route").Inc("/a")
+
+	// when
+	registry.Counter("requests_total", "Requests.", "route").Inc("/a")
+
+	// then
+	var b strings.Builder
+	registry.WriteText(&b)
+	if !strings.Contains(b.String(), `requests_total{route="/a"} 2`) {
+		t.Errorf("counter not shared, got: %s", b.String())
+	}
+}
+
+func TestRegistryRejectsMisuse(t *testing.T) {
+
+	cases := []struct {
+		name string
+		use  func(*metrics.Registry)
+	}{
+		{name: "other labels", use: func(r *metrics.Registry) {
+			r.Counter("requests_total", "Requests.", "route")
+			r.Counter("requests_total", "Requests.", "status")
+		}},
+		{name: "other kind", use: func(r *metrics.Registry) {
+			r.Counter("requests_total", "Requests.")
+			r.Histogram("requests_total", "Requests.", metrics.Seconds, nil)
+		}},
+		{name: "missing label values", use: func(r *metrics.Registry) {
+			r.Counter("requests_total", "Requests.", "route").Inc()
+		}},
+		{name: "decreasing counter", use: func(r *metrics.Registry) {
+			r.Counter("requests_total", "Requests.").Add(-1)
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("should have panicked but it did not")
+				}
+			}()
+			c.use(metrics.NewRegistry())
+		})
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	if buckets := metrics.ExponentialBuckets(64, 4, 3); !reflect.DeepEqual(buckets, []float64{64, 256, 1024}) {
+		t.Errorf("wrong buckets, got: %v", buckets)
+	}
+}
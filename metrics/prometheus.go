@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// TextContentType is the media type of the Prometheus text exposition format
+const TextContentType = string(expfmt.FmtText)
+
+// ServeHTTP responds with every metric of the registry in the exposition format negotiated with the scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// WriteText writes every metric of the registry in the Prometheus text exposition format,
+// sorted by name and label values so that the output is stable
+func (r *Registry) WriteText(w io.Writer) error {
+	families, err := r.prometheus.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
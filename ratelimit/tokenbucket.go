@@ -0,0 +1,88 @@
+// Package ratelimit provides the rate limiters of API clients
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucketLimiter is an in-memory rate limiter with a token bucket per key.
+// Buckets hold up to burst tokens and refill at rate tokens per second, each request taking one.
+// It is safe for concurrent use, and drops the buckets of idle keys once they are full again.
+// Limits are not shared between instances, so each one allows the full rate.
+type TokenBucketLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter creates a new TokenBucketLimiter allowing rate requests per second with bursts of up to burst requests.
+// Bursts below one request allow a single one.
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucketLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the key if there is any.
+// Otherwise, it returns how long until the next token is available.
+func (l *TokenBucketLimiter) Allow(key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second))), nil
+}
+
+// Len returns the number of keys with a bucket
+func (l *TokenBucketLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *TokenBucketLimiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// sweep drops full buckets, which behave like missing ones, once per time to fill a bucket
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep).Seconds()*l.rate < l.burst {
+		return
+	}
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,82 @@
+package ratelimit_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/ratelimit"
+)
+
+func TestTokenBucketAllowsBurstThenLimits(t *testing.T) {
+	limiter := ratelimit.NewTokenBucketLimiter(10, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := limiter.Allow("ci"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+
+	ok, retryAfter, err := limiter.Allow("ci")
+	if err != nil || ok {
+		t.Fatalf("request over burst was allowed, got: %v, %v", ok, err)
+	}
+	if retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("wrong retry delay, got: %v", retryAfter)
+	}
+
+	if ok, _, _ := limiter.Allow("other"); !ok {
+		t.Error("request of another key was limited")
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	limiter := ratelimit.NewTokenBucketLimiter(20, 1)
+
+	limiter.Allow("ci")
+	if ok, _, _ := limiter.Allow("ci"); ok {
+		t.Fatal("request over burst was allowed")
+	}
+
+	time.Sleep(75 * time.Millisecond)
+
+	if ok, _, _ := limiter.Allow("ci"); !ok {
+		t.Error("request after refill was limited")
+	}
+}
+
+func TestTokenBucketDropsIdleKeys(t *testing.T) {
+	limiter := ratelimit.NewTokenBucketLimiter(100, 1)
+
+	limiter.Allow("ci")
+	time.Sleep(50 * time.Millisecond)
+	limiter.Allow("other")
+
+	if limiter.Len() != 1 {
+		t.Errorf("wrong number of buckets, expected: 1, got: %d", limiter.Len())
+	}
+}
+
+func TestTokenBucketConcurrentAccess(t *testing.T) {
+	limiter := ratelimit.NewTokenBucketLimiter(0.001, 10)
+
+	var mu sync.Mutex
+	allowed := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _, _ := limiter.Allow("ci"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("wrong number of allowed requests, expected: 10, got: %d", allowed)
+	}
+}
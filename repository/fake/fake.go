@@ -1,27 +1,153 @@
 package fake
 
-type diff map[string][]byte
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+type version struct {
+	data []byte
+	meta domain.SideMetadata
+}
+
+type diff map[string][]version
 
 type FakeDiffRepository struct {
-	diffs map[string]diff
+	diffs    map[string]diff
+	sessions map[string]domain.DiffSession
 }
 
 func NewFakeDiffRepository() *FakeDiffRepository {
 	return &FakeDiffRepository{
-		diffs: make(map[string]diff),
+		diffs:    make(map[string]diff),
+		sessions: make(map[string]domain.DiffSession),
 	}
 }
 
-func (r *FakeDiffRepository) SaveDataSide(ID string, side string, data []byte) error {
+func (r *FakeDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	return r.SaveDataSideIf(ctx, ID, side, data, meta, domain.SidePrecondition{})
+}
+
+func (r *FakeDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	var digest string
+	if versions := r.diffs[ID][side]; len(versions) > 0 {
+		digest = domain.Digest(versions[len(versions)-1].data)
+	}
+	if !cond.Allows(digest) {
+		return domain.PreconditionFailedError{ID: ID, Side: side}
+	}
 	d := r.diffs[ID]
 	if d == nil {
-		r.diffs[ID] = make(map[string][]byte, 2)
+		r.diffs[ID] = make(diff, 2)
 		d = r.diffs[ID]
 	}
-	d[side] = data
+	d[side] = append(d[side], version{data, meta})
+	return nil
+}
+
+func (r *FakeDiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	m := make(map[string]domain.SideMetadata)
+	for side, versions := range r.diffs[ID] {
+		m[side] = versions[len(versions)-1].meta
+	}
+	return m, nil
+}
+
+func (r *FakeDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	for side, versions := range r.diffs[ID] {
+		m[side] = versions[len(versions)-1].data
+	}
+	return m, nil
+}
+
+func (r *FakeDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	for side, n := range versions {
+		stored := r.diffs[ID][side]
+		if n == domain.LatestVersion {
+			n = len(stored)
+		}
+		if n > 0 && n <= len(stored) {
+			m[side] = stored[n-1].data
+		}
+	}
+	return m, nil
+}
+
+func (r *FakeDiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	var versions []domain.SideVersion
+	for i, v := range r.diffs[ID][side] {
+		versions = append(versions, domain.SideVersion{
+			Version:    i + 1,
+			Size:       int64(len(v.data)),
+			UploadedAt: v.meta.UploadedAt,
+		})
+	}
+	return versions, nil
+}
+
+func (r *FakeDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	delete(r.diffs[ID], side)
+	return nil
+}
+
+func (r *FakeDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	delete(r.diffs, ID)
+	delete(r.sessions, ID)
+	return nil
+}
+
+func (r *FakeDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *FakeDiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	session, ok := r.sessions[ID]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (r *FakeDiffRepository) Ping(ctx context.Context) error {
 	return nil
 }
 
-func (r *FakeDiffRepository) GetDataSidesByID(ID string) (map[string][]byte, error) {
-	return r.diffs[ID], nil
+func (r *FakeDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	var diffs []domain.DiffSummary
+	for ID, d := range r.diffs {
+		if strings.HasPrefix(ID, prefix) && (after == "" || domain.LessID(after, ID)) {
+			var size int64
+			for _, versions := range d {
+				size += int64(len(versions[len(versions)-1].data))
+			}
+			diffs = append(diffs, domain.DiffSummary{ID: ID, Size: size})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return domain.LessID(diffs[i].ID, diffs[j].ID) })
+	if limit > 0 && len(diffs) > limit {
+		diffs = diffs[:limit]
+	}
+	return diffs, nil
+}
+
+func (r *FakeDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	var usage domain.Usage
+	for ID, d := range r.diffs {
+		if len(d) == 0 || domain.TenantOf(ID) != tenant {
+			continue
+		}
+		usage.Diffs++
+		for _, versions := range d {
+			for _, v := range versions {
+				usage.Bytes += int64(len(v.data))
+			}
+		}
+	}
+	return usage, nil
 }
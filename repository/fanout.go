@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ehpalumbo/go-diff/tracing"
+)
+
+// SideErrors aggregates the failures of the sides of a diff accessed in parallel, by side
+type SideErrors map[string]error
+
+func (e SideErrors) Error() string {
+	var b strings.Builder
+	for i, side := range e.sides() {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString("side " + side + ": " + e[side].Error())
+	}
+	return b.String()
+}
+
+// Is tells whether the failure of any side is the target
+func (e SideErrors) Is(target error) bool {
+	for _, side := range e.sides() {
+		if errors.Is(e[side], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first failure, in side order, that matches the target
+func (e SideErrors) As(target interface{}) bool {
+	for _, side := range e.sides() {
+		if errors.As(e[side], target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e SideErrors) sides() []string {
+	sides := make([]string, 0, len(e))
+	for side := range e {
+		sides = append(sides, side)
+	}
+	sort.Strings(sides)
+	return sides
+}
+
+// fanOut runs a task for each side, at most limit at a time or all at once if limit is not positive,
+// each one within a span named after the operation.
+// Once a task fails, the context of the others is cancelled and the failures are returned as SideErrors,
+// leaving out the ones caused by that cancellation.
+func fanOut(ctx context.Context, op string, sides []string, limit int, task func(ctx context.Context, side string) error) error {
+	group, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if limit <= 0 || limit > len(sides) {
+		limit = len(sides)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := make(SideErrors)
+	slots := make(chan struct{}, limit)
+	for _, side := range sides {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(side string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			traced, span := tracing.Start(group, op, tracing.String("diff.side", side))
+			defer span.End()
+			err := task(traced, side)
+			span.SetError(err)
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, context.Canceled) && group.Err() != nil && ctx.Err() == nil {
+				return
+			}
+			failures[side] = err
+			cancel()
+		}(side)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
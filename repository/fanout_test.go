@@ -0,0 +1,158 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ehpalumbo/go-diff/repository"
+	"github.com/ehpalumbo/go-diff/tracing"
+	"github.com/golang/mock/gomock"
+)
+
+func TestGetOperationAggregatesSideFailures(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/left"}).Return(nil, errors.New("access denied"))
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/right"}).Return(nil, errors.New("slow down"))
+
+	// when
+	_, err := repo.GetDataSidesByID(context.Background(), "1")
+
+	// then
+	var failures repository.SideErrors
+	if !errors.As(err, &failures) || len(failures) != 2 {
+		t.Fatalf("failures of both sides not reported, got: %v", err)
+	}
+	if err.Error() != "side left: access denied; side right: slow down" {
+		t.Errorf("wrong error message, got: %v", err)
+	}
+}
+
+func TestGetOperationCancelsPendingSidesOnFailure(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/left"}).Return(nil, errors.New("oops"))
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/right"}).DoAndReturn(
+		func(ctx context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+	// when
+	_, err := repo.GetDataSidesByID(context.Background(), "1")
+
+	// then
+	var failures repository.SideErrors
+	if !errors.As(err, &failures) || len(failures) != 1 || failures["left"] == nil {
+		t.Errorf("wrong failures, got: %v", err)
+	}
+}
+
+func TestGetOperationReportsExceededDeadline(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}).Times(2)
+
+	// when
+	_, err := repo.GetDataSidesByID(ctx, "1")
+
+	// then
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("exceeded deadline not reported, got: %v", err)
+	}
+}
+
+func TestGetOperationBoundsConcurrency(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	var mu sync.Mutex
+	running, max := 0, 0
+	client.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader([]byte("hello")))}, nil
+		}).Times(3)
+
+	// when
+	sides, err := repo.WithConcurrency(1).GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 1, "right": 2, "center": 3})
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if len(sides) != 3 {
+		t.Errorf("wrong sides, got: %v", sides)
+	}
+	if max != 1 {
+		t.Errorf("concurrency not bounded, got %d requests at once", max)
+	}
+}
+
+func TestGetOperationTracesEachSide(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	var b strings.Builder
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&b), "go-diff")
+	ctx, root := tracer.Start(context.Background(), "GET /v1/diff/:id", tracing.KindServer)
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/left"}).Return(nil, errors.New("slow down"))
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/right"}).Return(&s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader([]byte("hello")))}, nil)
+
+	// when
+	repo.GetDataSidesByID(ctx, "1")
+	root.End()
+	tracer.Shutdown(context.Background())
+
+	// then
+	sides := make(map[string]tracing.SpanLine)
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var span tracing.SpanLine
+		json.Unmarshal([]byte(line), &span)
+		if span.Name == "S3.GetObject" {
+			sides[span.Attributes["diff.side"].(string)] = span
+		}
+	}
+	if len(sides) != 2 || sides["left"].ParentSpanID != root.SpanContext().SpanID().String() {
+		t.Fatalf("wrong side spans, got: %s", b.String())
+	}
+	if sides["left"].Status != tracing.StatusError || sides["right"].Status != tracing.StatusUnset {
+		t.Errorf("wrong side statuses, got: %s", b.String())
+	}
+}
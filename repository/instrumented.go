@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/metrics"
+	"github.com/ehpalumbo/go-diff/service"
+)
+
+// InstrumentedDiffRepository is a DiffRepository decorator that measures the latency and errors of each operation,
+// along with the size of the saved sides
+type InstrumentedDiffRepository struct {
+	backend  service.DiffRepository
+	duration *metrics.Histogram
+	errors   *metrics.Counter
+	sizes    *metrics.Histogram
+}
+
+// NewInstrumentedDiffRepository creates a new instance of the InstrumentedDiffRepository decorator, registering its metrics
+func NewInstrumentedDiffRepository(backend service.DiffRepository, registry *metrics.Registry) *InstrumentedDiffRepository {
+	return &InstrumentedDiffRepository{
+		backend: backend,
+		duration: registry.Histogram("godiff_repository_duration_seconds",
+			"Latency of repository operations.",
+			metrics.Seconds, metrics.DefBuckets, "operation"),
+		errors: registry.Counter("godiff_repository_errors_total",
+			"Failed repository operations by error code.",
+			"operation", "code"),
+		sizes: registry.Histogram("godiff_payload_size_bytes",
+			"Size of the saved sides.",
+			metrics.Bytes, metrics.ExponentialBuckets(64, 4, 10), "side"),
+	}
+}
+
+// SaveDataSide saves data sides to the backend, measuring their size once saved
+func (r *InstrumentedDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) (err error) {
+	defer r.observe("SaveDataSide", time.Now(), &err)
+	if err = r.backend.SaveDataSide(ctx, ID, side, data, meta); err == nil {
+		r.sizes.Observe(float64(len(data)), side)
+	}
+	return err
+}
+
+// SaveDataSideIf saves data sides to the backend if they satisfy the precondition, measuring their size once saved
+func (r *InstrumentedDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) (err error) {
+	defer r.observe("SaveDataSideIf", time.Now(), &err)
+	if err = r.backend.SaveDataSideIf(ctx, ID, side, data, meta, cond); err == nil {
+		r.sizes.Observe(float64(len(data)), side)
+	}
+	return err
+}
+
+// GetDataSidesByID gets the latest data sides from the backend
+func (r *InstrumentedDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (m map[string][]byte, err error) {
+	defer r.observe("GetDataSidesByID", time.Now(), &err)
+	return r.backend.GetDataSidesByID(ctx, ID)
+}
+
+// GetDataSidesByVersion gets the given versions of data sides from the backend
+func (r *InstrumentedDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (m map[string][]byte, err error) {
+	defer r.observe("GetDataSidesByVersion", time.Now(), &err)
+	return r.backend.GetDataSidesByVersion(ctx, ID, versions)
+}
+
+// ListVersions lists the versions of a side from the backend
+func (r *InstrumentedDiffRepository) ListVersions(ctx context.Context, ID string, side string) (versions []domain.SideVersion, err error) {
+	defer r.observe("ListVersions", time.Now(), &err)
+	return r.backend.ListVersions(ctx, ID, side)
+}
+
+// GetMetadataByID gets the metadata of the latest sides from the backend
+func (r *InstrumentedDiffRepository) GetMetadataByID(ctx context.Context, ID string) (m map[string]domain.SideMetadata, err error) {
+	defer r.observe("GetMetadataByID", time.Now(), &err)
+	return r.backend.GetMetadataByID(ctx, ID)
+}
+
+// DeleteDataSide deletes a side from the backend
+func (r *InstrumentedDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) (err error) {
+	defer r.observe("DeleteDataSide", time.Now(), &err)
+	return r.backend.DeleteDataSide(ctx, ID, side)
+}
+
+// DeleteDataSidesByID deletes all the sides of a diff from the backend
+func (r *InstrumentedDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) (err error) {
+	defer r.observe("DeleteDataSidesByID", time.Now(), &err)
+	return r.backend.DeleteDataSidesByID(ctx, ID)
+}
+
+// ListDiffs lists the diffs in the backend
+func (r *InstrumentedDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) (diffs []domain.DiffSummary, err error) {
+	defer r.observe("ListDiffs", time.Now(), &err)
+	return r.backend.ListDiffs(ctx, prefix, after, limit)
+}
+
+// GetUsage gets the usage of a tenant from the backend
+func (r *InstrumentedDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (usage domain.Usage, err error) {
+	defer r.observe("GetUsage", time.Now(), &err)
+	return r.backend.GetUsage(ctx, tenant)
+}
+
+// SaveSession saves sessions to the backend
+func (r *InstrumentedDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) (err error) {
+	defer r.observe("SaveSession", time.Now(), &err)
+	return r.backend.SaveSession(ctx, session)
+}
+
+// GetSession gets sessions from the backend
+func (r *InstrumentedDiffRepository) GetSession(ctx context.Context, ID string) (session *domain.DiffSession, err error) {
+	defer r.observe("GetSession", time.Now(), &err)
+	return r.backend.GetSession(ctx, ID)
+}
+
+// Ping checks that the backend is reachable
+func (r *InstrumentedDiffRepository) Ping(ctx context.Context) (err error) {
+	defer r.observe("Ping", time.Now(), &err)
+	return r.backend.Ping(ctx)
+}
+
+// observe measures an operation started at the given time, counting its error if it failed
+func (r *InstrumentedDiffRepository) observe(operation string, start time.Time, err *error) {
+	r.duration.Observe(time.Since(start).Seconds(), operation)
+	if *err != nil {
+		r.errors.Inc(operation, string(domain.CodeOf(*err)))
+	}
+}
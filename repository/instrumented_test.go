@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/metrics"
+	"github.com/ehpalumbo/go-diff/repository"
+	"github.com/ehpalumbo/go-diff/service/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func setUpInstrumented(t *testing.T) (*repository.InstrumentedDiffRepository, *mocks.MockDiffRepository, *metrics.Registry) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+	backend := mocks.NewMockDiffRepository(ctrl)
+	registry := metrics.NewRegistry()
+	return repository.NewInstrumentedDiffRepository(backend, registry), backend, registry
+}
+
+func TestInstrumentedMeasuresOperations(t *testing.T) {
+
+	// given
+	repo, backend, registry := setUpInstrumented(t)
+	backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(nil)
+	backend.EXPECT().SaveDataSide(gomock.Any(), "1", "right", []byte("hi"), domain.SideMetadata{}).Return(errors.New("slow down"))
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(nil, domain.StorageError{Op: "get", Err: context.DeadlineExceeded})
+
+	// when
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hi"), domain.SideMetadata{})
+	repo.GetDataSidesByID(context.Background(), "1")
+
+	// then
+	var b strings.Builder
+	registry.WriteText(&b)
+	for _, sample := range []string{
+		`godiff_repository_duration_seconds_count{operation="SaveDataSide"} 2`,
+		`godiff_repository_duration_seconds_count{operation="GetDataSidesByID"} 1`,
+		`godiff_repository_errors_total{code="internal",operation="SaveDataSide"} 1`,
+		`godiff_repository_errors_total{code="timeout",operation="GetDataSidesByID"} 1`,
+		`godiff_payload_size_bytes_sum{side="left"} 5`,
+	} {
+		if !strings.Contains(b.String(), sample) {
+			t.Errorf("missing sample %s, got:\n%s", sample, b.String())
+		}
+	}
+	if strings.Contains(b.String(), `side="right"`) {
+		t.Errorf("failed save should not be measured, got:\n%s", b.String())
+	}
+}
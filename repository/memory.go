@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// memoryVersion is a version of a side, numbered after its position in the side history
+type memoryVersion struct {
+	data     []byte
+	metadata domain.SideMetadata
+}
+
+type memoryEntry struct {
+	ID        string
+	sides     map[string][]memoryVersion
+	session   *domain.DiffSession
+	size      int64
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+// latestSize returns the number of bytes of the latest version of every side
+func (e *memoryEntry) latestSize() int64 {
+	var size int64
+	for _, versions := range e.sides {
+		size += int64(len(versions[len(versions)-1].data))
+	}
+	return size
+}
+
+// MemoryDiffRepository is the in-memory implementation of the DiffRepository contract.
+// It is safe for concurrent use, evicts the least recently used diffs once
+// the total stored bytes of all their versions exceed its capacity and expires diffs after a TTL.
+type MemoryDiffRepository struct {
+	mu       sync.RWMutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	size     int64
+	usage    map[domain.Tenant]domain.Usage
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+// NewMemoryDiffRepository creates a new instance of the MemoryDiffRepository implementation.
+// A zero maxBytes means unbounded capacity and a zero ttl disables expiration.
+func NewMemoryDiffRepository(maxBytes int64, ttl time.Duration) *MemoryDiffRepository {
+	return &MemoryDiffRepository{
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		usage:    make(map[domain.Tenant]domain.Usage),
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// SaveDataSide stores a copy of the data side and its metadata as a new version, refreshing the TTL of its diff
+func (r *MemoryDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	return r.SaveDataSideIf(ctx, ID, side, data, meta, domain.SidePrecondition{})
+}
+
+// SaveDataSideIf atomically compares the latest version of the data side against the precondition and saves it
+func (r *MemoryDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	if len(ID) == 0 {
+		return errors.New("cannot save diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot save diff side data without side")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	e := r.lookup(ID, now)
+	if !cond.IsZero() {
+		var digest string
+		if e != nil && len(e.sides[side]) > 0 {
+			versions := e.sides[side]
+			digest = domain.Digest(versions[len(versions)-1].data)
+		}
+		if !cond.Allows(digest) {
+			return domain.PreconditionFailedError{ID: ID, Side: side}
+		}
+	}
+	var current int64
+	if e != nil {
+		current = e.size
+	}
+	if r.maxBytes > 0 && current+int64(len(data)) > r.maxBytes {
+		return errors.New("diff side data exceeds repository capacity")
+	}
+
+	if e == nil {
+		e = &memoryEntry{
+			ID:    ID,
+			sides: make(map[string][]memoryVersion, 2),
+		}
+		r.entries[ID] = r.lru.PushFront(e)
+	} else {
+		r.lru.MoveToFront(r.entries[ID])
+	}
+	diffs := 0
+	if len(e.sides) == 0 {
+		diffs = 1
+	}
+	r.size -= e.size
+	e.sides[side] = append(e.sides[side], memoryVersion{clone(data), cloneMetadata(meta)})
+	e.size = current + int64(len(data))
+	r.size += e.size
+	r.account(ID, diffs, int64(len(data)))
+	e.updatedAt = now
+	if r.ttl > 0 {
+		e.expiresAt = now.Add(r.ttl)
+	}
+
+	r.evict(now)
+	return nil
+}
+
+// GetDataSidesByID gets copies of all the data sides stored for an ID
+func (r *MemoryDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	// reads update recency, so they need the write lock
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := make(map[string][]byte)
+	e := r.lookup(ID, r.now())
+	if e == nil {
+		return m, nil
+	}
+	r.lru.MoveToFront(r.entries[ID])
+	for side, versions := range e.sides {
+		m[side] = clone(versions[len(versions)-1].data)
+	}
+	return m, nil
+}
+
+// GetDataSidesByVersion gets copies of the requested versions of the data sides stored for an ID
+func (r *MemoryDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := make(map[string][]byte)
+	e := r.lookup(ID, r.now())
+	if e == nil {
+		return m, nil
+	}
+	r.lru.MoveToFront(r.entries[ID])
+	for side, version := range versions {
+		stored := e.sides[side]
+		if version == domain.LatestVersion {
+			version = len(stored)
+		}
+		if version > 0 && version <= len(stored) {
+			m[side] = clone(stored[version-1].data)
+		}
+	}
+	return m, nil
+}
+
+// ListVersions lists the versions stored for a side, oldest first
+func (r *MemoryDiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.lookup(ID, r.now())
+	if e == nil {
+		return nil, nil
+	}
+	versions := make([]domain.SideVersion, len(e.sides[side]))
+	for i, v := range e.sides[side] {
+		versions[i] = domain.SideVersion{
+			Version:    i + 1,
+			Size:       int64(len(v.data)),
+			UploadedAt: v.metadata.UploadedAt,
+		}
+	}
+	return versions, nil
+}
+
+// GetMetadataByID gets copies of the metadata of all the data sides stored for an ID
+func (r *MemoryDiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := make(map[string]domain.SideMetadata)
+	e := r.lookup(ID, r.now())
+	if e == nil {
+		return m, nil
+	}
+	for side, versions := range e.sides {
+		m[side] = cloneMetadata(versions[len(versions)-1].metadata)
+	}
+	return m, nil
+}
+
+// SaveSession stores the session of a diff, refreshing its TTL
+func (r *MemoryDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	if len(session.ID) == 0 {
+		return errors.New("cannot save session without ID")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	e := r.lookup(session.ID, now)
+	if e == nil {
+		e = &memoryEntry{
+			ID:        session.ID,
+			sides:     make(map[string][]memoryVersion, 2),
+			updatedAt: now,
+		}
+		r.entries[session.ID] = r.lru.PushFront(e)
+	} else {
+		r.lru.MoveToFront(r.entries[session.ID])
+	}
+	e.session = &session
+	if r.ttl > 0 {
+		e.expiresAt = now.Add(r.ttl)
+	}
+
+	r.evict(now)
+	return nil
+}
+
+// GetSession gets the session of a diff, nil if it has none
+func (r *MemoryDiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.lookup(ID, r.now())
+	if e == nil || e.session == nil {
+		return nil, nil
+	}
+	session := *e.session
+	return &session, nil
+}
+
+// Ping always succeeds, since memory is always reachable
+func (r *MemoryDiffRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// DeleteDataSide deletes every version of a data side, removing its diff when no sides nor session are left
+func (r *MemoryDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	if len(ID) == 0 {
+		return errors.New("cannot delete diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot delete diff side data without side")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	e := r.lookup(ID, now)
+	if e == nil {
+		return nil
+	}
+	if versions, ok := e.sides[side]; ok {
+		var size int64
+		for _, v := range versions {
+			size += int64(len(v.data))
+		}
+		delete(e.sides, side)
+		e.size -= size
+		r.size -= size
+		diffs := 0
+		if len(e.sides) == 0 {
+			diffs = -1
+		}
+		r.account(ID, diffs, -size)
+		e.updatedAt = now
+	}
+	if len(e.sides) == 0 && e.session == nil {
+		r.remove(r.entries[ID])
+	}
+	return nil
+}
+
+// DeleteDataSidesByID deletes all data sides stored for an ID along with its session
+func (r *MemoryDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if el, ok := r.entries[ID]; ok {
+		r.remove(el)
+	}
+	return nil
+}
+
+// ListDiffs lists a page of the live diffs whose ID starts with the prefix, in ID order.
+// Diffs that only hold a session are not listed.
+func (r *MemoryDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	var diffs []domain.DiffSummary
+	for ID, el := range r.entries {
+		e := el.Value.(*memoryEntry)
+		if strings.HasPrefix(ID, prefix) && len(e.sides) > 0 && !r.expired(e, now) {
+			diffs = append(diffs, domain.DiffSummary{ID: ID, LastModified: e.updatedAt, Size: e.latestSize()})
+		}
+	}
+	return pageOf(diffs, after, limit), nil
+}
+
+// pageOf sorts the diffs by ID and returns those after the ID after unless it is empty,
+// at most limit of them unless it is zero
+func pageOf(diffs []domain.DiffSummary, after string, limit int) []domain.DiffSummary {
+	sort.Slice(diffs, func(i, j int) bool { return domain.LessID(diffs[i].ID, diffs[j].ID) })
+	if after != "" {
+		start := sort.Search(len(diffs), func(i int) bool { return domain.LessID(after, diffs[i].ID) })
+		diffs = diffs[start:]
+	}
+	if limit > 0 && len(diffs) > limit {
+		diffs = diffs[:limit]
+	}
+	return diffs
+}
+
+// GetUsage gets the usage of a tenant from counters updated on every change.
+// Diffs expire lazily, so expired diffs are counted until they are evicted.
+func (r *MemoryDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evict(r.now())
+	return r.usage[tenant], nil
+}
+
+// Size returns the total number of bytes currently stored
+func (r *MemoryDiffRepository) Size() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.size
+}
+
+// Len returns the number of diffs currently stored, including expired ones not yet evicted
+func (r *MemoryDiffRepository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.entries)
+}
+
+// lookup returns the live entry for an ID, dropping it if expired
+func (r *MemoryDiffRepository) lookup(ID string, now time.Time) *memoryEntry {
+	el, ok := r.entries[ID]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*memoryEntry)
+	if r.expired(e, now) {
+		r.remove(el)
+		return nil
+	}
+	return e
+}
+
+// evict drops least recently used entries while they are expired or the repository is over capacity.
+// Expired entries elsewhere in the list are dropped lazily on lookup.
+func (r *MemoryDiffRepository) evict(now time.Time) {
+	for el := r.lru.Back(); el != nil; el = r.lru.Back() {
+		overCapacity := r.maxBytes > 0 && r.size > r.maxBytes
+		if !overCapacity && !r.expired(el.Value.(*memoryEntry), now) {
+			return
+		}
+		r.remove(el)
+	}
+}
+
+func (r *MemoryDiffRepository) expired(e *memoryEntry, now time.Time) bool {
+	return r.ttl > 0 && !now.Before(e.expiresAt)
+}
+
+func (r *MemoryDiffRepository) remove(el *list.Element) {
+	e := r.lru.Remove(el).(*memoryEntry)
+	delete(r.entries, e.ID)
+	r.size -= e.size
+	if len(e.sides) > 0 {
+		r.account(e.ID, -1, -e.size)
+	}
+}
+
+// account adds the changes in the number of diffs and bytes of a diff to the usage of its tenant
+func (r *MemoryDiffRepository) account(ID string, diffs int, bytes int64) {
+	tenant := domain.TenantOf(ID)
+	usage := r.usage[tenant]
+	usage.Diffs += diffs
+	usage.Bytes += bytes
+	if usage == (domain.Usage{}) {
+		delete(r.usage, tenant)
+		return
+	}
+	r.usage[tenant] = usage
+}
+
+func clone(data []byte) []byte {
+	c := make([]byte, len(data))
+	copy(c, data)
+	return c
+}
+
+func cloneMetadata(meta domain.SideMetadata) domain.SideMetadata {
+	if meta.Labels != nil {
+		labels := make(map[string]string, len(meta.Labels))
+		for k, v := range meta.Labels {
+			labels[k] = v
+		}
+		meta.Labels = labels
+	}
+	return meta
+}
@@ -0,0 +1,344 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+)
+
+func TestMemorySaveAndGetOperations(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+	if err := repo.SaveDataSide(context.Background(), "1", "right", []byte(""), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	expected := map[string]string{"left": "hello", "right": ""}
+	if len(ds) != len(expected) {
+		t.Errorf("wrong number of results, expected: %v, got: %v", len(expected), len(ds))
+	}
+	for k, v := range ds {
+		if expected[k] != string(v) {
+			t.Errorf("wrong diff side data for side %s, expected: %s, got: %s", k, expected[k], v)
+		}
+	}
+
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "2"); len(ds) != 0 {
+		t.Errorf("expected empty map for absent ID, got: %v", ds)
+	}
+}
+
+func TestMemoryStoresDefensiveCopies(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	data := []byte("hello")
+	repo.SaveDataSide(context.Background(), "1", "left", data, domain.SideMetadata{})
+	data[0] = 'j'
+
+	ds, _ := repo.GetDataSidesByID(context.Background(), "1")
+	if string(ds["left"]) != "hello" {
+		t.Errorf("stored data was modified through the saved slice, got: %s", ds["left"])
+	}
+
+	ds["left"][0] = 'j'
+	ds, _ = repo.GetDataSidesByID(context.Background(), "1")
+	if string(ds["left"]) != "hello" {
+		t.Errorf("stored data was modified through the returned slice, got: %s", ds["left"])
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsedDiffs(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(10, 0)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("1111"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "2", "left", []byte("2222"), domain.SideMetadata{})
+	// reading diff 1 makes diff 2 the least recently used
+	repo.GetDataSidesByID(context.Background(), "1")
+	repo.SaveDataSide(context.Background(), "3", "left", []byte("3333"), domain.SideMetadata{})
+
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "2"); len(ds) != 0 {
+		t.Errorf("least recently used diff was not evicted, got: %v", ds)
+	}
+	for _, ID := range []string{"1", "3"} {
+		if ds, _ := repo.GetDataSidesByID(context.Background(), ID); len(ds) != 1 {
+			t.Errorf("diff %s was evicted", ID)
+		}
+	}
+	if repo.Size() != 8 {
+		t.Errorf("wrong size, expected: 8, got: %d", repo.Size())
+	}
+}
+
+func TestMemoryOverwriteAccountsForPreviousVersions(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(10, 0)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("1111"), domain.SideMetadata{})
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("111111"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+	if repo.Size() != 10 {
+		t.Errorf("wrong size, expected: 10, got: %d", repo.Size())
+	}
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("1"), domain.SideMetadata{}); err == nil {
+		t.Error("accepted version exceeding capacity along with previous versions")
+	}
+}
+
+func TestMemoryRejectsDiffLargerThanCapacity(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(10, 0)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("111111"), domain.SideMetadata{})
+	err := repo.SaveDataSide(context.Background(), "1", "right", []byte("111111"), domain.SideMetadata{})
+
+	if err == nil {
+		t.Fatal("accepted diff larger than capacity")
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 1 {
+		t.Errorf("rejected save modified stored diff, got: %v", ds)
+	}
+}
+
+func TestMemoryDiffsExpireAfterTTL(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 50*time.Millisecond)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 1 {
+		t.Fatalf("diff expired too early, got: %v", ds)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 0 {
+		t.Errorf("diff did not expire, got: %v", ds)
+	}
+	if repo.Len() != 0 || repo.Size() != 0 {
+		t.Errorf("expired diff still accounted, len: %d, size: %d", repo.Len(), repo.Size())
+	}
+}
+
+func TestMemoryDeleteOperations(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "2", "left", []byte("hello"), domain.SideMetadata{})
+
+	if err := repo.DeleteDataSide(context.Background(), "1", "left"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 1 || ds["right"] == nil {
+		t.Errorf("wrong sides after deleting one side, got: %v", ds)
+	}
+	if repo.Size() != 10 {
+		t.Errorf("wrong size, expected: 10, got: %d", repo.Size())
+	}
+
+	repo.DeleteDataSidesByID(context.Background(), "1")
+	repo.DeleteDataSide(context.Background(), "2", "left")
+
+	if repo.Len() != 0 || repo.Size() != 0 {
+		t.Errorf("deleted diffs still accounted, len: %d, size: %d", repo.Len(), repo.Size())
+	}
+}
+
+func TestMemoryListOperation(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	for _, ID := range []string{"ci-2", "ci-1", "other"} {
+		repo.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+	}
+	// diffs that only hold a session are not listed
+	repo.SaveSession(context.Background(), domain.DiffSession{ID: "ci-3"})
+
+	diffs, err := repo.ListDiffs(context.Background(), "ci-", "", 0)
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 2 || diffs[0].ID != "ci-1" || diffs[1].ID != "ci-2" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+	if diffs[1].LastModified.After(diffs[0].LastModified) {
+		t.Error("wrong last modification times")
+	}
+	if diffs[0].Size != 5 {
+		t.Errorf("wrong size, expected: 5, got: %d", diffs[0].Size)
+	}
+
+	if diffs, _ := repo.ListDiffs(context.Background(), "", "", 1); len(diffs) != 1 || diffs[0].ID != "ci-1" {
+		t.Errorf("wrong first page, got: %v", diffs)
+	}
+	if diffs, _ := repo.ListDiffs(context.Background(), "", "ci-1", 1); len(diffs) != 1 || diffs[0].ID != "ci-2" {
+		t.Errorf("wrong page after ci-1, got: %v", diffs)
+	}
+}
+
+func TestMemoryConcurrentAccess(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(1024, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ID := fmt.Sprint(i % 5)
+			repo.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+			repo.GetDataSidesByID(context.Background(), ID)
+		}(i)
+	}
+	wg.Wait()
+
+	if repo.Len() != 5 {
+		t.Errorf("wrong number of diffs, expected: 5, got: %d", repo.Len())
+	}
+}
+
+func TestMemoryRejectedSaveOperation(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	cases := []struct {
+		name     string
+		ID       string
+		side     string
+		expected error
+	}{
+		{
+			name:     "empty ID",
+			side:     "left",
+			expected: errors.New("cannot save diff side data without ID"),
+		},
+		{
+			name:     "empty side",
+			ID:       "1",
+			expected: errors.New("cannot save diff side data without side"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			err := repo.SaveDataSide(context.Background(), c.ID, c.side, []byte("hello"), domain.SideMetadata{})
+
+			if err == nil {
+				t.Fatal("accepted invalid input")
+			}
+			if reflect.TypeOf(err) != reflect.TypeOf(c.expected) {
+				t.Errorf("wrong error type, expected: %T, got: %T", c.expected, err)
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+
+		})
+
+	}
+
+}
+
+func TestMemoryMetadataOperations(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	meta := domain.SideMetadata{Filename: "left.txt", Labels: map[string]string{"pipeline": "ci"}}
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), meta)
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+	meta.Labels["pipeline"] = "cd"
+
+	m, err := repo.GetMetadataByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get metadata operation failed, got: %v", err)
+	}
+	if len(m) != 2 || m["left"].Filename != "left.txt" || m["left"].Labels["pipeline"] != "ci" {
+		t.Errorf("wrong metadata, got: %v", m)
+	}
+
+	repo.DeleteDataSide(context.Background(), "1", "left")
+	if m, _ := repo.GetMetadataByID(context.Background(), "1"); len(m) != 1 {
+		t.Errorf("metadata of deleted side was kept, got: %v", m)
+	}
+}
+
+func TestMemoryVersionOperations(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	for _, data := range []string{"hello", "hallo", "hullo!"} {
+		repo.SaveDataSide(context.Background(), "1", "left", []byte(data), domain.SideMetadata{})
+	}
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("world"), domain.SideMetadata{})
+
+	versions, err := repo.ListVersions(context.Background(), "1", "left")
+	if err != nil {
+		t.Fatalf("list versions operation failed, got: %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 1 || versions[2].Version != 3 || versions[2].Size != 6 {
+		t.Errorf("wrong versions, got: %v", versions)
+	}
+
+	ds, err := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 2, "right": domain.LatestVersion})
+	if err != nil {
+		t.Fatalf("get versions operation failed, got: %v", err)
+	}
+	if string(ds["left"]) != "hallo" || string(ds["right"]) != "world" {
+		t.Errorf("wrong versioned data sides, got: %v", ds)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); string(ds["left"]) != "hullo!" {
+		t.Errorf("latest version not returned, got: %s", ds["left"])
+	}
+	if ds, _ := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 4}); len(ds) != 0 {
+		t.Errorf("expected empty map for absent version, got: %v", ds)
+	}
+
+	repo.DeleteDataSide(context.Background(), "1", "left")
+	if versions, _ := repo.ListVersions(context.Background(), "1", "left"); len(versions) != 0 {
+		t.Errorf("versions of deleted side were kept, got: %v", versions)
+	}
+	if repo.Size() != 5 {
+		t.Errorf("wrong size, expected: 5, got: %d", repo.Size())
+	}
+}
+
+func TestMemoryConditionalSaveOperations(t *testing.T) {
+	testConditionalSaves(t, repository.NewMemoryDiffRepository(0, 0))
+}
+
+func TestMemorySessionOperations(t *testing.T) {
+	testSessions(t, repository.NewMemoryDiffRepository(0, 0))
+}
+
+func TestMemoryUsageOperations(t *testing.T) {
+	testUsage(t, repository.NewMemoryDiffRepository(0, 0))
+}
+
+func TestMemoryEvictionsUpdateUsage(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(10, 0)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "2", "left", []byte("hallo!"), domain.SideMetadata{})
+
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 6})
+}
+
+func TestMemoryKeepsSessionAfterDeletingSides(t *testing.T) {
+	repo := repository.NewMemoryDiffRepository(0, 0)
+
+	repo.SaveSession(context.Background(), domain.DiffSession{ID: "1"})
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.DeleteDataSide(context.Background(), "1", "left")
+
+	if s, _ := repo.GetSession(context.Background(), "1"); s == nil {
+		t.Error("session was removed along with the last side")
+	}
+}
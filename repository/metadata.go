@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// storedMetadata is the serialized form of side metadata in backends without native support for it
+type storedMetadata struct {
+	Filename    string            `json:"filename,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Uploader    string            `json:"uploader,omitempty"`
+	UploadedAt  time.Time         `json:"uploaded_at"`
+}
+
+func encodeMetadata(meta domain.SideMetadata) string {
+	b, _ := json.Marshal(storedMetadata(meta))
+	return string(b)
+}
+
+func decodeMetadata(s string) (domain.SideMetadata, error) {
+	var meta storedMetadata
+	err := json.Unmarshal([]byte(s), &meta)
+	return domain.SideMetadata(meta), err
+}
@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+type conditionalRepository interface {
+	SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error
+	GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error)
+}
+
+// testConditionalSaves runs the same sequence of conditional saves against any repository
+func testConditionalSaves(t *testing.T, repo conditionalRepository) {
+	create := domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}}
+	update := domain.SidePrecondition{IfMatch: []string{domain.Digest([]byte("hello"))}}
+
+	steps := []struct {
+		name   string
+		data   string
+		cond   domain.SidePrecondition
+		failed bool
+	}{
+		{name: "update of missing side", data: "hello", cond: update, failed: true},
+		{name: "creation of missing side", data: "hello", cond: create},
+		{name: "creation of stored side", data: "hallo", cond: create, failed: true},
+		{name: "update of matching side", data: "hallo", cond: update},
+		{name: "update of changed side", data: "hullo", cond: update, failed: true},
+	}
+
+	for _, s := range steps {
+		err := repo.SaveDataSideIf(context.Background(), "1", "left", []byte(s.data), domain.SideMetadata{}, s.cond)
+		if _, ok := err.(domain.PreconditionFailedError); ok != s.failed {
+			t.Errorf("%s: wrong outcome, got: %v", s.name, err)
+		} else if !s.failed && err != nil {
+			t.Errorf("%s: save operation failed, got: %v", s.name, err)
+		}
+	}
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	if string(ds["left"]) != "hallo" {
+		t.Errorf("wrong data side after conditional saves, got: %s", ds["left"])
+	}
+}
@@ -0,0 +1,529 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/go-redis/redis/v8"
+)
+
+// redisUpdatedField is the hash field holding the last modification time of a diff in nanoseconds.
+// Sides are validated upstream, so it cannot clash with a side name.
+const redisUpdatedField = "_updated"
+
+// redisMetadataField is the prefix of the hash fields holding the metadata of each side
+const redisMetadataField = "_meta:"
+
+// redisVersionField is the prefix of the hash fields counting the versions of each side
+const redisVersionField = "_version:"
+
+// redisVersionDataField and redisVersionMetadataField are the prefixes of the hash fields
+// holding every version of each side, followed by "<side>:<version>"
+const (
+	redisVersionDataField     = "_v:"
+	redisVersionMetadataField = "_vmeta:"
+)
+
+// redisSessionField is the hash field holding the session of a diff
+const redisSessionField = "_session"
+
+// redisUsageFunctions are the Lua functions shared by the scripts keeping the usage of each tenant.
+// The usage hash of a tenant holds the bytes of all its diffs in its "bytes" field and those of each diff
+// in a "d:<id>" field, while a sorted set ranks its diffs by expiration time in milliseconds,
+// so that expired diffs can be subtracted from the usage although Redis drops them silently.
+// track recounts a diff from the version fields of its hash, whose prefix is given,
+// and prune subtracts at most limit diffs expired by now, all of them if the limit is negative.
+const redisUsageFunctions = `
+local function track(key, usage, expiry, ID, now, versions)
+	local size, sides = 0, 0
+	for _, field in ipairs(redis.call('HKEYS', key)) do
+		if string.sub(field, 1, #versions) == versions then
+			size = size + redis.call('HSTRLEN', key, field)
+		elseif string.sub(field, 1, 1) ~= '_' then
+			sides = sides + 1
+		end
+	end
+	local old = tonumber(redis.call('HGET', usage, 'd:' .. ID) or '0')
+	if sides == 0 then
+		size = 0
+		redis.call('HDEL', usage, 'd:' .. ID)
+		redis.call('ZREM', expiry, ID)
+	else
+		local expiresAt = '+inf'
+		local ttl = redis.call('PTTL', key)
+		if ttl >= 0 then
+			expiresAt = tonumber(now) + ttl
+		end
+		redis.call('HSET', usage, 'd:' .. ID, size)
+		redis.call('ZADD', expiry, expiresAt, ID)
+	end
+	redis.call('HINCRBY', usage, 'bytes', size - old)
+end
+
+local function prune(usage, expiry, now, limit)
+	local expired = redis.call('ZRANGEBYSCORE', expiry, '-inf', now, 'LIMIT', 0, limit)
+	for _, ID in ipairs(expired) do
+		local old = tonumber(redis.call('HGET', usage, 'd:' .. ID) or '0')
+		redis.call('HDEL', usage, 'd:' .. ID)
+		redis.call('HINCRBY', usage, 'bytes', -old)
+	end
+	if #expired > 0 then
+		redis.call('ZREM', expiry, unpack(expired))
+	end
+end
+`
+
+// redisPruneLimit bounds the expired diffs subtracted from the usage of their tenant by each write
+const redisPruneLimit = 16
+
+// redisSaveSession stores the session of a diff, setting its modification time when new.
+// Its diff is tracked again, since the TTL was refreshed.
+var redisSaveSession = redis.NewScript(redisUsageFunctions + `
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HSETNX', KEYS[1], ARGV[3], ARGV[4])
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+end
+track(KEYS[1], KEYS[2], KEYS[3], ARGV[6], ARGV[7], ARGV[8])
+return 0
+`)
+
+// redisSaveSide stores a side as its latest value and as a new version, refreshing the TTL when positive,
+// and adds it to the usage of the tenant of its diff
+var redisSaveSide = redis.NewScript(redisUsageFunctions + `
+local version = redis.call('HINCRBY', KEYS[1], ARGV[7], 1)
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5], ARGV[6],
+	ARGV[8] .. version, ARGV[2], ARGV[9] .. version, ARGV[4])
+if tonumber(ARGV[10]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[10])
+end
+prune(KEYS[2], KEYS[3], ARGV[12], ARGV[14])
+track(KEYS[1], KEYS[2], KEYS[3], ARGV[11], ARGV[12], ARGV[13])
+return version
+`)
+
+// redisDeleteSide removes a side, its metadata and all its versions,
+// dropping the whole hash when only the timestamp is left, and subtracts them from the usage of its tenant
+var redisDeleteSide = redis.NewScript(redisUsageFunctions + `
+local fields = {ARGV[1], ARGV[3], ARGV[4]}
+for _, field in ipairs(redis.call('HKEYS', KEYS[1])) do
+	if string.sub(field, 1, #ARGV[5]) == ARGV[5] or string.sub(field, 1, #ARGV[6]) == ARGV[6] then
+		table.insert(fields, field)
+	end
+end
+redis.call('HDEL', KEYS[1], unpack(fields))
+if redis.call('HLEN', KEYS[1]) == 1 and redis.call('HEXISTS', KEYS[1], ARGV[2]) == 1 then
+	redis.call('DEL', KEYS[1])
+end
+track(KEYS[1], KEYS[2], KEYS[3], ARGV[7], ARGV[8], ARGV[9])
+return 0
+`)
+
+// redisDeleteDiff removes a diff and subtracts it from the usage of its tenant
+var redisDeleteDiff = redis.NewScript(redisUsageFunctions + `
+redis.call('DEL', KEYS[1])
+track(KEYS[1], KEYS[2], KEYS[3], ARGV[1], ARGV[2], ARGV[3])
+return 0
+`)
+
+// redisTrackDiff counts a diff in the usage of its tenant, replacing what was counted for it before
+var redisTrackDiff = redis.NewScript(redisUsageFunctions + `
+track(KEYS[1], KEYS[2], KEYS[3], ARGV[1], ARGV[2], ARGV[3])
+return 0
+`)
+
+// redisGetUsage subtracts the expired diffs from the usage of a tenant and returns its diffs and bytes
+var redisGetUsage = redis.NewScript(redisUsageFunctions + `
+prune(KEYS[1], KEYS[2], ARGV[1], -1)
+return {redis.call('ZCARD', KEYS[2]), tonumber(redis.call('HGET', KEYS[1], 'bytes') or '0')}
+`)
+
+// redisUsageSeededField marks the usage hash of a tenant whose diffs stored before usage was kept were counted
+const redisUsageSeededField = "seeded"
+
+// redisSummary returns the last modification time of a diff and the size of the latest version of every side,
+// which are the fields without the reserved underscore prefix. It returns nil for missing diffs and diffs without sides.
+var redisSummary = redis.NewScript(`
+local updated = redis.call('HGET', KEYS[1], ARGV[1])
+if not updated then
+	return nil
+end
+local size, sides = 0, 0
+for _, field in ipairs(redis.call('HKEYS', KEYS[1])) do
+	if string.sub(field, 1, 1) ~= '_' then
+		size = size + redis.call('HSTRLEN', KEYS[1], field)
+		sides = sides + 1
+	end
+end
+if sides == 0 then
+	return nil
+end
+return {updated, size}
+`)
+
+type RedisClient interface {
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+	Ping(ctx context.Context) *redis.StatusCmd
+	redis.Scripter
+}
+
+// RedisDiffRepository is the Redis-backed implementation of the DiffRepository contract.
+// Sides are stored in a hash per ID that expires after the configured TTL,
+// along with every version of each side. The usage of each tenant is kept by the scripts changing its diffs.
+type RedisDiffRepository struct {
+	client RedisClient
+	ttl    time.Duration
+}
+
+// NewRedisDiffRepository creates a new instance of the RedisDiffRepository implementation.
+// Every write refreshes the TTL of the whole diff; a zero TTL disables expiration.
+func NewRedisDiffRepository(client RedisClient, ttl time.Duration) *RedisDiffRepository {
+	return &RedisDiffRepository{client, ttl}
+}
+
+// SaveDataSide saves data sides and their metadata to Redis as a new version
+func (r *RedisDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	if len(ID) == 0 {
+		return errors.New("cannot save diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot save diff side data without side")
+	}
+	return redisSaveSide.Run(ctx, r.client, redisKeysOf(ID), r.saveArgs(ID, side, data, meta)...).Err()
+}
+
+// SaveDataSideIf saves data sides like SaveDataSide if the stored side satisfies the precondition.
+// The diff is watched while checking the precondition, so concurrent changes to it fail the save.
+func (r *RedisDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	if len(ID) == 0 {
+		return errors.New("cannot save diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot save diff side data without side")
+	}
+	key := redisKeyOf(ID)
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		var digest string
+		current, err := tx.HGet(ctx, key, side).Bytes()
+		if err == nil {
+			digest = domain.Digest(current)
+		} else if err != redis.Nil {
+			return err
+		}
+		if !cond.Allows(digest) {
+			return domain.PreconditionFailedError{ID: ID, Side: side}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// EVALSHA fallbacks do not work within transactions
+			return redisSaveSide.Eval(ctx, pipe, redisKeysOf(ID), r.saveArgs(ID, side, data, meta)...).Err()
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return domain.PreconditionFailedError{ID: ID, Side: side}
+	}
+	return err
+}
+
+func (r *RedisDiffRepository) saveArgs(ID, side string, data []byte, meta domain.SideMetadata) []interface{} {
+	now := time.Now()
+	return []interface{}{
+		side, data,
+		redisMetadataField + side, encodeMetadata(meta),
+		redisUpdatedField, now.UnixNano(),
+		redisVersionField + side,
+		redisVersionDataField + side + ":", redisVersionMetadataField + side + ":",
+		r.ttl.Milliseconds(),
+		ID, millis(now), redisVersionDataField,
+		redisPruneLimit,
+	}
+}
+
+// GetDataSidesByID gets all the data sides stored for an ID from Redis
+func (r *RedisDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	hash, err := r.client.HGetAll(ctx, redisKeyOf(ID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]byte, len(hash))
+	for field, data := range hash {
+		if !strings.HasPrefix(field, "_") {
+			m[field] = []byte(data)
+		}
+	}
+	return m, nil
+}
+
+// GetDataSidesByVersion gets the requested versions of the data sides stored for an ID from Redis
+func (r *RedisDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	for side, version := range versions {
+		field := side
+		if version != domain.LatestVersion {
+			field = fmt.Sprintf("%s%s:%d", redisVersionDataField, side, version)
+		}
+		data, err := r.client.HGet(ctx, redisKeyOf(ID), field).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[side] = data
+	}
+	return m, nil
+}
+
+// ListVersions lists the versions stored for a side in Redis, oldest first
+func (r *RedisDiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	hash, err := r.client.HGetAll(ctx, redisKeyOf(ID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	prefix := redisVersionMetadataField + side + ":"
+	var versions []domain.SideVersion
+	for field, data := range hash {
+		if !strings.HasPrefix(field, prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(field, prefix))
+		if err != nil {
+			continue
+		}
+		meta, err := decodeMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, domain.SideVersion{
+			Version:    n,
+			Size:       int64(len(hash[fmt.Sprintf("%s%s:%d", redisVersionDataField, side, n)])),
+			UploadedAt: meta.UploadedAt,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// GetMetadataByID gets the metadata of all the data sides stored for an ID from Redis
+func (r *RedisDiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	hash, err := r.client.HGetAll(ctx, redisKeyOf(ID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]domain.SideMetadata)
+	for field, data := range hash {
+		if side := strings.TrimPrefix(field, redisMetadataField); side != field {
+			if m[side], err = decodeMetadata(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// DeleteDataSide deletes a data side and all its versions from Redis
+func (r *RedisDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	if len(ID) == 0 {
+		return errors.New("cannot delete diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot delete diff side data without side")
+	}
+	return redisDeleteSide.Run(ctx, r.client, redisKeysOf(ID),
+		side, redisUpdatedField, redisMetadataField+side, redisVersionField+side,
+		redisVersionDataField+side+":", redisVersionMetadataField+side+":",
+		ID, millis(time.Now()), redisVersionDataField).Err()
+}
+
+// SaveSession saves the session of a diff to Redis, refreshing the TTL of the diff
+func (r *RedisDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	if len(session.ID) == 0 {
+		return errors.New("cannot save session without ID")
+	}
+	now := time.Now()
+	return redisSaveSession.Run(ctx, r.client, redisKeysOf(session.ID),
+		redisSessionField, encodeSession(session),
+		redisUpdatedField, now.UnixNano(),
+		r.ttl.Milliseconds(),
+		session.ID, millis(now), redisVersionDataField).Err()
+}
+
+// GetSession gets the session of a diff from Redis, nil if it has none
+func (r *RedisDiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	b, err := r.client.HGet(ctx, redisKeyOf(ID), redisSessionField).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSession(b)
+}
+
+// Ping checks that Redis is reachable
+func (r *RedisDiffRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// DeleteDataSidesByID deletes all data sides of an ID from Redis, along with its session
+func (r *RedisDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	return redisDeleteDiff.Run(ctx, r.client, redisKeysOf(ID), ID, millis(time.Now()), redisVersionDataField).Err()
+}
+
+// ListDiffs lists a page of the diffs whose ID starts with the prefix, in ID order.
+// Redis scans keys in no particular order, so the whole key space is scanned for every page,
+// but only the diffs of the page are read. Diffs that only hold a session are not listed.
+func (r *RedisDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	var IDs []string
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, redisKeyPatternOf(prefix), 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if ID := redisIDOf(key); strings.HasPrefix(ID, prefix) && (after == "" || domain.LessID(after, ID)) {
+				IDs = append(IDs, ID)
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	sort.Slice(IDs, func(i, j int) bool { return domain.LessID(IDs[i], IDs[j]) })
+
+	var diffs []domain.DiffSummary
+	for _, ID := range IDs {
+		if limit > 0 && len(diffs) == limit {
+			break
+		}
+		summary, err := redisSummary.Run(ctx, r.client, []string{redisKeyOf(ID)}, redisUpdatedField).Result()
+		if err == redis.Nil {
+			// expired or deleted since the scan, or holding a session only
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values := summary.([]interface{})
+		nanos, _ := strconv.ParseInt(values[0].(string), 10, 64)
+		diffs = append(diffs, domain.DiffSummary{
+			ID:           ID,
+			LastModified: time.Unix(0, nanos),
+			Size:         values[1].(int64),
+		})
+	}
+	return diffs, nil
+}
+
+// GetUsage gets the usage of a tenant from Redis, subtracting the diffs expired since it was last read.
+// Diffs stored before usage was kept are counted the first time the usage of their tenant is read.
+func (r *RedisDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	usage, expiry := redisUsageKeysOf(tenant)
+	if err := r.seedUsage(ctx, tenant); err != nil {
+		return domain.Usage{}, err
+	}
+	result, err := redisGetUsage.Run(ctx, r.client, []string{usage, expiry}, millis(time.Now())).Result()
+	if err != nil {
+		return domain.Usage{}, err
+	}
+	values := result.([]interface{})
+	return domain.Usage{Diffs: int(values[0].(int64)), Bytes: values[1].(int64)}, nil
+}
+
+// seedUsage counts the diffs of a tenant in its usage, scanning the key space once per tenant.
+// Counting a diff replaces what was counted for it, so concurrent writes and seeds are not counted twice.
+func (r *RedisDiffRepository) seedUsage(ctx context.Context, tenant domain.Tenant) error {
+	usage, _ := redisUsageKeysOf(tenant)
+	err := r.client.HGet(ctx, usage, redisUsageSeededField).Err()
+	if err != redis.Nil {
+		return err
+	}
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, redisKeyPrefix+escapeGlob(redisTagOf(tenant))+"*", 100).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			ID := redisIDOf(key)
+			err := redisTrackDiff.Run(ctx, r.client, redisKeysOf(ID), ID, millis(time.Now()), redisVersionDataField).Err()
+			if err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return r.client.HSet(ctx, usage, redisUsageSeededField, 1).Err()
+		}
+		cursor = next
+	}
+}
+
+const redisKeyPrefix = "diff:"
+
+// redisKeyOf returns the key of a diff, tagged with its tenant so that Redis Cluster
+// puts it in the same slot as the usage keys the scripts changing it update
+func redisKeyOf(ID string) string {
+	return redisKeyPrefix + redisTagOf(domain.TenantOf(ID)) + ID
+}
+
+// redisIDOf returns the ID of a diff from its key. Tenants hold no braces, so the tag ends at the first one.
+func redisIDOf(key string) string {
+	return key[strings.Index(key, "}")+1:]
+}
+
+// redisTagOf returns the hash tag of the keys of a tenant, which is never empty as Redis would ignore it
+func redisTagOf(tenant domain.Tenant) string {
+	return "{tenant:" + tenant.String() + "}"
+}
+
+// redisKeyPatternOf returns the MATCH pattern of the keys of the diffs whose ID starts with the prefix.
+// Only a prefix holding a tenant tells the tag of the keys, otherwise keys of every tenant match
+// and some of them may not start with the prefix.
+func redisKeyPatternOf(prefix string) string {
+	tag := escapeGlob("{tenant:") + "*}"
+	if tenant := domain.TenantOf(prefix); tenant != domain.DefaultTenant {
+		tag = escapeGlob(redisTagOf(tenant))
+	}
+	return redisKeyPrefix + tag + escapeGlob(prefix) + "*"
+}
+
+// redisKeysOf returns the key of a diff followed by the usage keys of its tenant, as expected by the scripts changing it
+func redisKeysOf(ID string) []string {
+	usage, expiry := redisUsageKeysOf(domain.TenantOf(ID))
+	return []string{redisKeyOf(ID), usage, expiry}
+}
+
+// redisUsageKeysOf returns the keys of the usage hash of a tenant and of the sorted set of its diffs by expiration time
+func redisUsageKeysOf(tenant domain.Tenant) (string, string) {
+	return "usage:" + redisTagOf(tenant), "usage-expiry:" + redisTagOf(tenant)
+}
+
+// millis returns a time in milliseconds since the epoch, the precision of Redis TTLs
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// escapeGlob escapes the special characters of Redis MATCH patterns
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,376 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+	"github.com/go-redis/redis/v8"
+)
+
+func setUpRedis(t *testing.T, ttl time.Duration) (*repository.RedisDiffRepository, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return repository.NewRedisDiffRepository(client, ttl), server
+}
+
+func TestRedisSaveAndGetOperations(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+	if err := repo.SaveDataSide(context.Background(), "1", "right", []byte(""), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	expected := map[string]string{"left": "hello", "right": ""}
+	if len(ds) != len(expected) {
+		t.Errorf("wrong number of results, expected: %v, got: %v", len(expected), len(ds))
+	}
+	for k, v := range ds {
+		if expected[k] != string(v) {
+			t.Errorf("wrong diff side data for side %s, expected: %s, got: %s", k, expected[k], v)
+		}
+	}
+
+	ds, err = repo.GetDataSidesByID(context.Background(), "2")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	if len(ds) != 0 {
+		t.Errorf("expected empty map for absent ID, got: %v", ds)
+	}
+}
+
+func TestRedisSidesExpireAfterTTL(t *testing.T) {
+	repo, server := setUpRedis(t, time.Minute)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	server.FastForward(30 * time.Second)
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+
+	// the second write refreshed the TTL of the whole diff
+	server.FastForward(45 * time.Second)
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 2 {
+		t.Fatalf("diff expired too early, got: %v", ds)
+	}
+
+	server.FastForward(time.Minute)
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 0 {
+		t.Errorf("diff did not expire, got: %v", ds)
+	}
+}
+
+func TestRedisZeroTTLDisablesExpiration(t *testing.T) {
+	repo, server := setUpRedis(t, 0)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+
+	if ttl := server.TTL("diff:{tenant:}1"); ttl != 0 {
+		t.Errorf("expected no TTL, got: %v", ttl)
+	}
+}
+
+func TestRedisGetOperationPropagatesFailure(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+	server.SetError("Oops!")
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+
+	if err == nil {
+		t.Fatal("should have failed but it did not")
+	}
+	if ds != nil {
+		t.Errorf("failed but returned non-nil map, got: %v", ds)
+	}
+}
+
+func TestRedisDeleteOperations(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+
+	if err := repo.DeleteDataSide(context.Background(), "1", "left"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 1 || ds["right"] == nil {
+		t.Errorf("wrong sides after deleting one side, got: %v", ds)
+	}
+
+	if err := repo.DeleteDataSidesByID(context.Background(), "1"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if server.Exists("diff:{tenant:}1") {
+		t.Error("diff was not deleted")
+	}
+}
+
+func TestRedisListOperation(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+
+	for _, ID := range []string{"ci-2", "ci-1", "ci*3", "other"} {
+		repo.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+	}
+	// deleting the last side leaves no trace of the diff, and diffs that only hold a session are not listed
+	repo.DeleteDataSide(context.Background(), "ci-2", "left")
+	repo.SaveSession(context.Background(), domain.DiffSession{ID: "ci-4"})
+
+	diffs, err := repo.ListDiffs(context.Background(), "ci-", "", 0)
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].ID != "ci-1" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+	if diffs[0].LastModified.IsZero() {
+		t.Error("missing last modification time")
+	}
+	if diffs[0].Size != 5 {
+		t.Errorf("wrong size, expected: 5, got: %d", diffs[0].Size)
+	}
+
+	// glob characters in the prefix are matched literally
+	if diffs, _ := repo.ListDiffs(context.Background(), "ci*", "", 0); len(diffs) != 1 || diffs[0].ID != "ci*3" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+
+	if diffs, _ := repo.ListDiffs(context.Background(), "ci", "ci*3", 1); len(diffs) != 1 || diffs[0].ID != "ci-1" {
+		t.Errorf("wrong page after ci*3, got: %v", diffs)
+	}
+}
+
+func TestRedisKeysShareTheSlotOfTheirTenant(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+
+	for _, ID := range []string{"acme/1", "1"} {
+		repo.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+		repo.GetUsage(context.Background(), domain.TenantOf(ID))
+	}
+
+	// Redis Cluster hashes the tag between the first braces of a key, so scripts can change the usage of its tenant
+	expected := []string{
+		"diff:{tenant:acme}acme/1", "usage:{tenant:acme}", "usage-expiry:{tenant:acme}",
+		"diff:{tenant:}1", "usage:{tenant:}", "usage-expiry:{tenant:}",
+	}
+	if keys := server.Keys(); len(keys) != len(expected) {
+		t.Errorf("wrong keys, got: %v", keys)
+	}
+	for _, key := range expected {
+		if !server.Exists(key) {
+			t.Errorf("missing key: %s", key)
+		}
+	}
+	if diffs, _ := repo.ListDiffs(context.Background(), "acme/", "", 0); len(diffs) != 1 || diffs[0].ID != "acme/1" {
+		t.Errorf("wrong diffs of tenant, got: %v", diffs)
+	}
+	if diffs, _ := repo.ListDiffs(context.Background(), "", "", 0); len(diffs) != 2 || diffs[0].ID != "1" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+}
+
+func TestRedisRejectedSaveOperation(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+
+	cases := []struct {
+		name     string
+		ID       string
+		side     string
+		expected error
+	}{
+		{
+			name:     "empty ID",
+			side:     "left",
+			expected: errors.New("cannot save diff side data without ID"),
+		},
+		{
+			name:     "empty side",
+			ID:       "1",
+			expected: errors.New("cannot save diff side data without side"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			err := repo.SaveDataSide(context.Background(), c.ID, c.side, []byte("hello"), domain.SideMetadata{})
+
+			if err == nil {
+				t.Fatal("accepted invalid input")
+			}
+			if reflect.TypeOf(err) != reflect.TypeOf(c.expected) {
+				t.Errorf("wrong error type, expected: %T, got: %T", c.expected, err)
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRedisMetadataOperations(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+
+	meta := domain.SideMetadata{
+		Filename:    "left.txt",
+		ContentType: "text/plain",
+		Labels:      map[string]string{"pipeline": "ci"},
+		Uploader:    "gopher",
+		UploadedAt:  time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), meta)
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+
+	m, err := repo.GetMetadataByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get metadata operation failed, got: %v", err)
+	}
+	if len(m) != 2 || !reflect.DeepEqual(m["left"], meta) {
+		t.Errorf("wrong metadata, got: %v", m)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 2 {
+		t.Errorf("metadata leaked into data sides, got: %v", ds)
+	}
+
+	repo.DeleteDataSide(context.Background(), "1", "left")
+	if m, _ := repo.GetMetadataByID(context.Background(), "1"); len(m) != 1 {
+		t.Errorf("metadata of deleted side was kept, got: %v", m)
+	}
+}
+
+func TestRedisVersionOperations(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+
+	for _, data := range []string{"hello", "hallo", "hullo!"} {
+		repo.SaveDataSide(context.Background(), "1", "left", []byte(data), domain.SideMetadata{})
+	}
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("world"), domain.SideMetadata{})
+
+	versions, err := repo.ListVersions(context.Background(), "1", "left")
+	if err != nil {
+		t.Fatalf("list versions operation failed, got: %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 1 || versions[2].Version != 3 || versions[2].Size != 6 {
+		t.Errorf("wrong versions, got: %v", versions)
+	}
+
+	ds, err := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 2, "right": domain.LatestVersion})
+	if err != nil {
+		t.Fatalf("get versions operation failed, got: %v", err)
+	}
+	if string(ds["left"]) != "hallo" || string(ds["right"]) != "world" {
+		t.Errorf("wrong versioned data sides, got: %v", ds)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 2 || string(ds["left"]) != "hullo!" {
+		t.Errorf("wrong latest data sides, got: %v", ds)
+	}
+	if ds, _ := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 4}); len(ds) != 0 {
+		t.Errorf("expected empty map for absent version, got: %v", ds)
+	}
+
+	repo.DeleteDataSide(context.Background(), "1", "left")
+	if versions, _ := repo.ListVersions(context.Background(), "1", "left"); len(versions) != 0 {
+		t.Errorf("versions of deleted side were kept, got: %v", versions)
+	}
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("again"), domain.SideMetadata{})
+	if versions, _ := repo.ListVersions(context.Background(), "1", "left"); len(versions) != 1 || versions[0].Version != 1 {
+		t.Errorf("versions did not restart after deletion, got: %v", versions)
+	}
+
+	repo.DeleteDataSide(context.Background(), "1", "left")
+	repo.DeleteDataSide(context.Background(), "1", "right")
+	if server.Exists("diff:{tenant:}1") {
+		t.Error("hash was kept after deleting every side")
+	}
+}
+
+func TestRedisConditionalSaveOperations(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+	testConditionalSaves(t, repo)
+
+	if versions, _ := repo.ListVersions(context.Background(), "1", "left"); len(versions) != 2 {
+		t.Errorf("failed saves created versions, got: %v", versions)
+	}
+}
+
+func TestRedisSessionOperations(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+	testSessions(t, repo)
+}
+
+func TestRedisUsageOperations(t *testing.T) {
+	repo, _ := setUpRedis(t, time.Hour)
+	testUsage(t, repo)
+}
+
+func TestRedisUsageSubtractsExpiredDiffs(t *testing.T) {
+	repo, server := setUpRedis(t, 50*time.Millisecond)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 5})
+
+	time.Sleep(100 * time.Millisecond)
+	server.FastForward(100 * time.Millisecond)
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{})
+
+	// diffs stored again after expiring only count their new versions
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hi"), domain.SideMetadata{})
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 2})
+}
+
+func TestRedisUsageCountsDiffsStoredBeforeIt(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "acme/1", "left", []byte("other tenant"), domain.SideMetadata{})
+	server.Del("usage:{tenant:}")
+	server.Del("usage-expiry:{tenant:}")
+
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 10})
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("abc"), domain.SideMetadata{})
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 13})
+}
+
+func TestRedisKeepsSessionAfterDeletingSides(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+
+	repo.SaveSession(context.Background(), domain.DiffSession{ID: "1"})
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.DeleteDataSide(context.Background(), "1", "left")
+
+	if s, _ := repo.GetSession(context.Background(), "1"); s == nil {
+		t.Error("session was removed along with the last side")
+	}
+	if server.TTL("diff:{tenant:}1") == 0 {
+		t.Error("session hash does not expire")
+	}
+}
+
+func TestRedisPing(t *testing.T) {
+	repo, server := setUpRedis(t, time.Hour)
+
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Errorf("ping failed, got: %v", err)
+	}
+
+	server.Close()
+	if err := repo.Ping(context.Background()); err == nil {
+		t.Error("ping of unreachable server should have failed but it did not")
+	}
+}
@@ -0,0 +1,402 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/service"
+)
+
+// ErrCircuitOpen is returned without calling the backend while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker of a ResilientDiffRepository
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through to the backend
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every call fast until the open timeout elapses
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through, closing the breaker if it succeeds
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// ResilienceConfig configures the retries, timeouts and circuit breaker of a ResilientDiffRepository
+type ResilienceConfig struct {
+	// MaxAttempts is the most times a call is attempted, one or less meaning no retries
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubling up to MaxDelay with full jitter
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RetryRatio is the retries earned by each call, up to RetryBurst retries in the budget.
+	// A zero burst means retries are not budgeted.
+	RetryRatio float64
+	RetryBurst int
+	// Timeout bounds each attempt, zero meaning only the deadline of the caller applies
+	Timeout time.Duration
+	// ScanTimeout bounds each attempt of listings and usage reads instead, since they may go through every diff
+	ScanTimeout time.Duration
+	// FailureThreshold is the consecutive failed calls that open the breaker, zero meaning it never opens
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting a probe through
+	OpenTimeout time.Duration
+}
+
+// DefaultResilienceConfig returns a ResilienceConfig suitable for S3
+func DefaultResilienceConfig() ResilienceConfig {
+	return ResilienceConfig{
+		MaxAttempts:      3,
+		BaseDelay:        50 * time.Millisecond,
+		MaxDelay:         time.Second,
+		RetryRatio:       0.1,
+		RetryBurst:       10,
+		Timeout:          5 * time.Second,
+		ScanTimeout:      time.Minute,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// ResilienceStats are the state of the circuit breaker and the counters of the calls made through it
+type ResilienceStats struct {
+	State      string `json:"state"`
+	Calls      int64  `json:"calls"`
+	Retries    int64  `json:"retries"`
+	Failures   int64  `json:"failures"`
+	Rejections int64  `json:"rejections"`
+}
+
+// ResilientDiffRepository is a DiffRepository decorator that shields callers from transient backend failures.
+// Reads, deletions and sessions are retried with exponential backoff, within a budget so that retries
+// cannot multiply the load of a struggling backend. Uploads are never retried, since a retry could
+// store an extra version or fail its own precondition.
+// Consecutive failures open a circuit breaker that fails calls fast with ErrCircuitOpen until the backend recovers.
+// Only storage failures and timeouts count as failures: domain errors, like missing diffs, are passed through.
+type ResilientDiffRepository struct {
+	backend service.DiffRepository
+	config  ResilienceConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	budget   float64
+	stats    ResilienceStats
+}
+
+// NewResilientDiffRepository creates a new instance of the ResilientDiffRepository decorator
+func NewResilientDiffRepository(backend service.DiffRepository, config ResilienceConfig) *ResilientDiffRepository {
+	return &ResilientDiffRepository{backend: backend, config: config, budget: float64(config.RetryBurst)}
+}
+
+// State returns the current state of the circuit breaker
+func (r *ResilientDiffRepository) State() BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.currentState(time.Now())
+}
+
+// Stats returns the state of the circuit breaker and the counters of the calls made so far
+func (r *ResilientDiffRepository) Stats() ResilienceStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	stats.State = r.currentState(time.Now()).String()
+	return stats
+}
+
+// Health pings the backend and reports the stats of the repository, failing fast while the circuit breaker is open
+func (r *ResilientDiffRepository) Health(ctx context.Context) (interface{}, error) {
+	err := r.Ping(ctx)
+	return r.Stats(), err
+}
+
+// SaveDataSide saves data sides to the backend in a single attempt
+func (r *ResilientDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	return r.call(ctx, false, func(ctx context.Context) error {
+		return r.backend.SaveDataSide(ctx, ID, side, data, meta)
+	})
+}
+
+// SaveDataSideIf saves data sides to the backend in a single attempt, if they satisfy the precondition
+func (r *ResilientDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	return r.call(ctx, false, func(ctx context.Context) error {
+		return r.backend.SaveDataSideIf(ctx, ID, side, data, meta, cond)
+	})
+}
+
+// GetDataSidesByID gets the latest data sides from the backend
+func (r *ResilientDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (m map[string][]byte, err error) {
+	err = r.call(ctx, true, func(ctx context.Context) (err error) {
+		m, err = r.backend.GetDataSidesByID(ctx, ID)
+		return err
+	})
+	return m, err
+}
+
+// GetDataSidesByVersion gets the given versions of data sides from the backend
+func (r *ResilientDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (m map[string][]byte, err error) {
+	err = r.call(ctx, true, func(ctx context.Context) (err error) {
+		m, err = r.backend.GetDataSidesByVersion(ctx, ID, versions)
+		return err
+	})
+	return m, err
+}
+
+// ListVersions lists the versions of a side from the backend
+func (r *ResilientDiffRepository) ListVersions(ctx context.Context, ID string, side string) (versions []domain.SideVersion, err error) {
+	err = r.call(ctx, true, func(ctx context.Context) (err error) {
+		versions, err = r.backend.ListVersions(ctx, ID, side)
+		return err
+	})
+	return versions, err
+}
+
+// GetMetadataByID gets the metadata of the latest sides from the backend
+func (r *ResilientDiffRepository) GetMetadataByID(ctx context.Context, ID string) (m map[string]domain.SideMetadata, err error) {
+	err = r.call(ctx, true, func(ctx context.Context) (err error) {
+		m, err = r.backend.GetMetadataByID(ctx, ID)
+		return err
+	})
+	return m, err
+}
+
+// DeleteDataSide deletes a side from the backend
+func (r *ResilientDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	return r.call(ctx, true, func(ctx context.Context) error {
+		return r.backend.DeleteDataSide(ctx, ID, side)
+	})
+}
+
+// DeleteDataSidesByID deletes all the sides of a diff from the backend
+func (r *ResilientDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	return r.call(ctx, true, func(ctx context.Context) error {
+		return r.backend.DeleteDataSidesByID(ctx, ID)
+	})
+}
+
+// ListDiffs lists the diffs in the backend, bound by the scan timeout
+func (r *ResilientDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) (diffs []domain.DiffSummary, err error) {
+	err = r.callWithin(ctx, true, r.config.ScanTimeout, func(ctx context.Context) (err error) {
+		diffs, err = r.backend.ListDiffs(ctx, prefix, after, limit)
+		return err
+	})
+	return diffs, err
+}
+
+// GetUsage gets the usage of a tenant from the backend, bound by the scan timeout since it may be counted from every diff
+func (r *ResilientDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (usage domain.Usage, err error) {
+	err = r.callWithin(ctx, true, r.config.ScanTimeout, func(ctx context.Context) (err error) {
+		usage, err = r.backend.GetUsage(ctx, tenant)
+		return err
+	})
+	return usage, err
+}
+
+// SaveSession saves sessions to the backend, which overwrites them as a whole so they can be retried
+func (r *ResilientDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	return r.call(ctx, true, func(ctx context.Context) error {
+		return r.backend.SaveSession(ctx, session)
+	})
+}
+
+// GetSession gets sessions from the backend
+func (r *ResilientDiffRepository) GetSession(ctx context.Context, ID string) (session *domain.DiffSession, err error) {
+	err = r.call(ctx, true, func(ctx context.Context) (err error) {
+		session, err = r.backend.GetSession(ctx, ID)
+		return err
+	})
+	return session, err
+}
+
+// Ping checks that the backend is reachable, failing fast while the circuit breaker is open
+func (r *ResilientDiffRepository) Ping(ctx context.Context) error {
+	return r.call(ctx, true, r.backend.Ping)
+}
+
+// call runs an operation through the circuit breaker, retrying transient failures of idempotent operations
+func (r *ResilientDiffRepository) call(ctx context.Context, idempotent bool, op func(context.Context) error) error {
+	return r.callWithin(ctx, idempotent, r.config.Timeout, op)
+}
+
+// callWithin runs an operation like call, bounding each attempt by the timeout
+func (r *ResilientDiffRepository) callWithin(ctx context.Context, idempotent bool, timeout time.Duration, op func(context.Context) error) error {
+	if !r.admit() {
+		return ErrCircuitOpen
+	}
+	for attempt := 1; ; attempt++ {
+		err := r.attempt(ctx, timeout, op)
+		if err == nil || !transient(err) {
+			r.record(true)
+			return err
+		}
+		if ctx.Err() != nil {
+			// failures of the caller, like a cancelled request, say nothing about the backend
+			r.release()
+			return err
+		}
+		if !idempotent || attempt >= r.config.MaxAttempts || !r.withdraw() {
+			r.record(false)
+			return err
+		}
+		if !sleep(ctx, r.backoff(attempt)) {
+			r.record(false)
+			return err
+		}
+	}
+}
+
+// attempt runs an operation once, bound by the timeout unless it is zero
+func (r *ResilientDiffRepository) attempt(ctx context.Context, timeout time.Duration, op func(context.Context) error) error {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return op(ctx)
+}
+
+// admit decides whether a call may go through to the backend, and deposits its share of the retry budget
+func (r *ResilientDiffRepository) admit() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.currentState(time.Now()) {
+	case BreakerOpen:
+		r.stats.Rejections++
+		return false
+	case BreakerHalfOpen:
+		if r.probing {
+			r.stats.Rejections++
+			return false
+		}
+		r.state = BreakerHalfOpen
+		r.probing = true
+	}
+	r.stats.Calls++
+	if burst := float64(r.config.RetryBurst); burst > 0 {
+		r.budget += r.config.RetryRatio
+		if r.budget > burst {
+			r.budget = burst
+		}
+	}
+	return true
+}
+
+// withdraw takes a retry from the budget if there is any
+func (r *ResilientDiffRepository) withdraw() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.config.RetryBurst > 0 {
+		if r.budget < 1 {
+			return false
+		}
+		r.budget--
+	}
+	r.stats.Retries++
+	return true
+}
+
+// record updates the circuit breaker with the outcome of a call
+func (r *ResilientDiffRepository) record(ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.probing = false
+	if ok {
+		r.state = BreakerClosed
+		r.failures = 0
+		return
+	}
+	r.stats.Failures++
+	r.failures++
+	if r.state == BreakerHalfOpen || (r.config.FailureThreshold > 0 && r.failures >= r.config.FailureThreshold) {
+		r.state = BreakerOpen
+		r.openedAt = time.Now()
+	}
+}
+
+// release lets another probe through without recording an outcome
+func (r *ResilientDiffRepository) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.probing = false
+}
+
+// currentState is the state of the breaker at the given time, half-open once the open timeout elapses
+func (r *ResilientDiffRepository) currentState(now time.Time) BreakerState {
+	if r.state == BreakerOpen && now.Sub(r.openedAt) >= r.config.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return r.state
+}
+
+// backoff is a random delay up to the exponential backoff of the attempt
+func (r *ResilientDiffRepository) backoff(attempt int) time.Duration {
+	d := r.config.BaseDelay
+	for i := 1; i < attempt && d < r.config.MaxDelay; i++ {
+		d *= 2
+	}
+	if r.config.MaxDelay > 0 && d > r.config.MaxDelay {
+		d = r.config.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// transient tells whether an error may go away by retrying, as opposed to a domain error of the request
+// or a request rejected by the storage, which proves it reachable
+func transient(err error) bool {
+	if rejected(err) {
+		return false
+	}
+	switch domain.CodeOf(err) {
+	case domain.CodeInternal, domain.CodeStorageUnavailable, domain.CodeTimeout:
+		return true
+	}
+	return false
+}
+
+// rejected tells whether the storage responded to a request with a client error, like an invalid argument.
+// Request timeouts and throttling are client errors too, but they may go away by retrying.
+func rejected(err error) bool {
+	var responseErr *smithyhttp.ResponseError
+	if !errors.As(err, &responseErr) {
+		return false
+	}
+	status := responseErr.HTTPStatusCode()
+	return status >= 400 && status < 500 && status != 408 && status != 429
+}
+
+// sleep waits for the delay unless the context is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,352 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+	"github.com/ehpalumbo/go-diff/service/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func setUpResilient(t *testing.T, config repository.ResilienceConfig) (*repository.ResilientDiffRepository, *mocks.MockDiffRepository) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+	backend := mocks.NewMockDiffRepository(ctrl)
+	return repository.NewResilientDiffRepository(backend, config), backend
+}
+
+func testResilienceConfig() repository.ResilienceConfig {
+	return repository.ResilienceConfig{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         5 * time.Millisecond,
+		FailureThreshold: 2,
+		OpenTimeout:      time.Hour,
+	}
+}
+
+// storageError is an error of the storage responding with the HTTP status, as returned by the AWS SDK
+func storageError(status int, code string) error {
+	return &smithy.OperationError{ServiceID: "S3", OperationName: "PutObject", Err: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      &smithy.GenericAPIError{Code: code},
+	}}
+}
+
+func TestResilientRetriesTransientReadFailures(t *testing.T) {
+
+	// given
+	repo, backend := setUpResilient(t, testResilienceConfig())
+	gomock.InOrder(
+		backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(nil, errors.New("slow down")).Times(2),
+		backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{"left": []byte("hello")}, nil),
+	)
+
+	// when
+	m, err := repo.GetDataSidesByID(context.Background(), "1")
+
+	// then
+	if err != nil || string(m["left"]) != "hello" {
+		t.Errorf("read not retried, got: %v, %v", m, err)
+	}
+	if stats := repo.Stats(); stats.Calls != 1 || stats.Retries != 2 || stats.Failures != 0 {
+		t.Errorf("wrong stats, got: %+v", stats)
+	}
+}
+
+func TestResilientGivesUpAfterMaxAttempts(t *testing.T) {
+
+	// given
+	repo, backend := setUpResilient(t, testResilienceConfig())
+	backend.EXPECT().ListVersions(gomock.Any(), "1", "left").Return(nil, errors.New("slow down")).Times(3)
+
+	// when
+	_, err := repo.ListVersions(context.Background(), "1", "left")
+
+	// then
+	if err == nil || err.Error() != "slow down" {
+		t.Errorf("wrong error, got: %v", err)
+	}
+}
+
+func TestResilientDoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(*repository.ResilientDiffRepository, *mocks.MockDiffRepository) error
+	}{
+		{
+			name: "uploads",
+			call: func(repo *repository.ResilientDiffRepository, backend *mocks.MockDiffRepository) error {
+				backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(errors.New("slow down"))
+				return repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+			},
+		},
+		{
+			name: "conditional uploads",
+			call: func(repo *repository.ResilientDiffRepository, backend *mocks.MockDiffRepository) error {
+				cond := domain.SidePrecondition{IfNoneMatch: []string{"*"}}
+				backend.EXPECT().SaveDataSideIf(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}, cond).Return(errors.New("slow down"))
+				return repo.SaveDataSideIf(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}, cond)
+			},
+		},
+		{
+			name: "rejected requests",
+			call: func(repo *repository.ResilientDiffRepository, backend *mocks.MockDiffRepository) error {
+				backend.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(nil, storageError(400, "InvalidArgument"))
+				_, err := repo.GetMetadataByID(context.Background(), "1")
+				return err
+			},
+		},
+		{
+			name: "domain errors",
+			call: func(repo *repository.ResilientDiffRepository, backend *mocks.MockDiffRepository) error {
+				backend.EXPECT().GetDataSidesByVersion(gomock.Any(), "1", gomock.Any()).Return(nil, domain.DiffNotFoundError{ID: "1"})
+				_, err := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 3})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// given
+			repo, backend := setUpResilient(t, testResilienceConfig())
+
+			// when
+			err := tt.call(repo, backend)
+
+			// then
+			if err == nil {
+				t.Error("should have failed but it did not")
+			}
+			if stats := repo.Stats(); stats.Retries != 0 {
+				t.Errorf("should not have retried, got: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestResilientRetriesThrottledRequests(t *testing.T) {
+
+	// given
+	repo, backend := setUpResilient(t, testResilienceConfig())
+	gomock.InOrder(
+		backend.EXPECT().ListDiffs(gomock.Any(), "", "", 0).Return(nil, storageError(429, "TooManyRequests")),
+		backend.EXPECT().ListDiffs(gomock.Any(), "", "", 0).Return(nil, nil),
+	)
+
+	// when
+	_, err := repo.ListDiffs(context.Background(), "", "", 0)
+
+	// then
+	if err != nil {
+		t.Errorf("throttled request not retried, got: %v", err)
+	}
+}
+
+func TestResilientRejectedRequestsDoNotOpenCircuit(t *testing.T) {
+
+	// given
+	repo, backend := setUpResilient(t, testResilienceConfig())
+	backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", gomock.Any(), gomock.Any()).Return(storageError(400, "MetadataTooLarge")).Times(3)
+
+	// when
+	for i := 0; i < 3; i++ {
+		repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	}
+
+	// then
+	if stats := repo.Stats(); stats.State != "closed" || stats.Failures != 0 || stats.Rejections != 0 {
+		t.Errorf("client errors should not count against the storage, got: %+v", stats)
+	}
+}
+
+func TestResilientRetriesWithinBudget(t *testing.T) {
+
+	// given
+	config := testResilienceConfig()
+	config.RetryRatio = 0.5
+	config.RetryBurst = 1
+	config.FailureThreshold = 0
+	repo, backend := setUpResilient(t, config)
+
+	// the budget starts full with one retry, and the second call only earns half of another
+	backend.EXPECT().GetSession(gomock.Any(), "1").Return(nil, errors.New("slow down")).Times(3)
+
+	// when
+	_, first := repo.GetSession(context.Background(), "1")
+	_, second := repo.GetSession(context.Background(), "1")
+
+	// then
+	if first == nil || second == nil {
+		t.Error("should have failed but it did not")
+	}
+	if stats := repo.Stats(); stats.Calls != 2 || stats.Retries != 1 {
+		t.Errorf("wrong stats, got: %+v", stats)
+	}
+}
+
+func TestResilientTimesOutEachAttempt(t *testing.T) {
+
+	// given
+	config := testResilienceConfig()
+	config.Timeout = 10 * time.Millisecond
+	repo, backend := setUpResilient(t, config)
+
+	gomock.InOrder(
+		backend.EXPECT().DeleteDataSidesByID(gomock.Any(), "1").DoAndReturn(func(ctx context.Context, _ string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		backend.EXPECT().DeleteDataSidesByID(gomock.Any(), "1").Return(nil),
+	)
+
+	// when
+	err := repo.DeleteDataSidesByID(context.Background(), "1")
+
+	// then
+	if err != nil {
+		t.Errorf("attempt timeout not retried, got: %v", err)
+	}
+}
+
+func TestResilientBoundsScansByTheirOwnTimeout(t *testing.T) {
+
+	// given
+	config := testResilienceConfig()
+	config.Timeout = time.Millisecond
+	config.ScanTimeout = time.Hour
+	repo, backend := setUpResilient(t, config)
+
+	var deadlines []time.Duration
+	backend.EXPECT().ListDiffs(gomock.Any(), "", "", 0).DoAndReturn(func(ctx context.Context, _, _ string, _ int) ([]domain.DiffSummary, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines = append(deadlines, time.Until(deadline))
+		return nil, nil
+	})
+	backend.EXPECT().GetUsage(gomock.Any(), domain.DefaultTenant).DoAndReturn(func(ctx context.Context, _ domain.Tenant) (domain.Usage, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines = append(deadlines, time.Until(deadline))
+		return domain.Usage{}, nil
+	})
+
+	// when
+	repo.ListDiffs(context.Background(), "", "", 0)
+	repo.GetUsage(context.Background(), domain.DefaultTenant)
+
+	// then
+	for _, d := range deadlines {
+		if d < time.Minute {
+			t.Errorf("scan bound by the attempt timeout, got: %v", d)
+		}
+	}
+}
+
+func TestResilientStopsRetryingWhenCallerGoesAway(t *testing.T) {
+
+	// given
+	repo, backend := setUpResilient(t, testResilienceConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	backend.EXPECT().DeleteDataSide(gomock.Any(), "1", "left").DoAndReturn(func(context.Context, string, string) error {
+		cancel()
+		return context.Canceled
+	})
+
+	// when
+	err := repo.DeleteDataSide(ctx, "1", "left")
+
+	// then
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error, got: %v", err)
+	}
+	if stats := repo.Stats(); stats.Failures != 0 {
+		t.Errorf("caller cancellation counted as failure, got: %+v", stats)
+	}
+}
+
+func TestResilientOpensCircuitAfterConsecutiveFailures(t *testing.T) {
+
+	// given
+	config := testResilienceConfig()
+	config.MaxAttempts = 1
+	repo, backend := setUpResilient(t, config)
+	backend.EXPECT().ListDiffs(gomock.Any(), "", "", 0).Return(nil, errors.New("service unavailable")).Times(2)
+
+	// when
+	repo.ListDiffs(context.Background(), "", "", 0)
+	repo.ListDiffs(context.Background(), "", "", 0)
+	_, err := repo.ListDiffs(context.Background(), "", "", 0)
+
+	// then
+	if !errors.Is(err, repository.ErrCircuitOpen) {
+		t.Errorf("should have failed fast, got: %v", err)
+	}
+	if repo.State() != repository.BreakerOpen {
+		t.Errorf("wrong state, got: %v", repo.State())
+	}
+	if stats := repo.Stats(); stats.State != "open" || stats.Failures != 2 || stats.Rejections != 1 {
+		t.Errorf("wrong stats, got: %+v", stats)
+	}
+	if _, err := repo.Health(context.Background()); !errors.Is(err, repository.ErrCircuitOpen) {
+		t.Errorf("should be unhealthy, got: %v", err)
+	}
+}
+
+func TestResilientClosesCircuitAfterSuccessfulProbe(t *testing.T) {
+
+	// given
+	config := testResilienceConfig()
+	config.MaxAttempts = 1
+	config.FailureThreshold = 1
+	config.OpenTimeout = 10 * time.Millisecond
+	repo, backend := setUpResilient(t, config)
+	gomock.InOrder(
+		backend.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(nil, errors.New("service unavailable")),
+		backend.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(map[string]domain.SideMetadata{}, nil),
+	)
+	repo.GetMetadataByID(context.Background(), "1")
+
+	// when
+	time.Sleep(20 * time.Millisecond)
+	halfOpen := repo.State()
+	_, err := repo.GetMetadataByID(context.Background(), "1")
+
+	// then
+	if halfOpen != repository.BreakerHalfOpen {
+		t.Errorf("should be half-open, got: %v", halfOpen)
+	}
+	if err != nil || repo.State() != repository.BreakerClosed {
+		t.Errorf("probe should have closed the circuit, got: %v, %v", err, repo.State())
+	}
+}
+
+func TestResilientReopensCircuitAfterFailedProbe(t *testing.T) {
+
+	// given
+	config := testResilienceConfig()
+	config.MaxAttempts = 1
+	config.FailureThreshold = 3
+	config.OpenTimeout = 10 * time.Millisecond
+	repo, backend := setUpResilient(t, config)
+	backend.EXPECT().SaveSession(gomock.Any(), gomock.Any()).Return(errors.New("service unavailable")).Times(4)
+	for i := 0; i < 3; i++ {
+		repo.SaveSession(context.Background(), domain.DiffSession{ID: "1"})
+	}
+
+	// when
+	time.Sleep(20 * time.Millisecond)
+	repo.SaveSession(context.Background(), domain.DiffSession{ID: "1"})
+
+	// then
+	if repo.State() != repository.BreakerOpen {
+		t.Errorf("failed probe should have reopened the circuit, got: %v", repo.State())
+	}
+}
@@ -3,105 +3,728 @@ package repository
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/ehpalumbo/go-diff/domain"
 )
 
 type S3Client interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
 }
 
-// S3DiffRepository is the AWS S3-backed implementation of the DiffRepository contract
+// S3DiffRepository is the AWS S3-backed implementation of the DiffRepository contract.
+// The latest version of each side is stored at diff/{id}/{side} and every version
+// at history/{id}/{side}/{version}, so the bucket does not need object versioning.
+// The usage of each tenant is stored at usage/{tenant} and updated after every write when it is kept.
 type S3DiffRepository struct {
 	client     S3Client
 	bucketName string
+	// concurrency bounds the sides requested in parallel, no bound if not positive
+	concurrency int
+	// usage tells whether the usage of each tenant is kept up to date on every write
+	keepUsage bool
 }
 
 // NewS3DiffRepository creates a new instance of the S3DiffRepository implementation
 func NewS3DiffRepository(client S3Client, bucketName string) *S3DiffRepository {
-	return &S3DiffRepository{client, bucketName}
+	return &S3DiffRepository{client: client, bucketName: bucketName}
 }
 
-// SaveDataSide saves data sides to S3
-func (r *S3DiffRepository) SaveDataSide(ID string, side string, data []byte) error {
+// WithConcurrency returns a copy of the repository that requests at most n sides in parallel
+func (r *S3DiffRepository) WithConcurrency(n int) *S3DiffRepository {
+	c := *r
+	c.concurrency = n
+	return &c
+}
+
+// WithUsage returns a copy of the repository that keeps the usage of each tenant up to date on every write,
+// at the cost of reading and writing its usage object, as quotas need. Otherwise usage is counted when read.
+// Writes made without keeping usage leave it stale, so usage objects must be deleted before keeping it again.
+func (r *S3DiffRepository) WithUsage() *S3DiffRepository {
+	c := *r
+	c.keepUsage = true
+	return &c
+}
+
+// SaveDataSide saves data sides to S3 as a new version, along with their metadata as object metadata.
+// The version is written before the latest object, so a failed save never exposes an unversioned side.
+// Versions are only written if absent, so concurrent saves of the same side take the next free number
+// rather than overwriting each other's version.
+func (r *S3DiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	return r.SaveDataSideIf(ctx, ID, side, data, meta, domain.SidePrecondition{})
+}
+
+// SaveDataSideIf saves data sides like SaveDataSide if the stored side satisfies the precondition.
+// The latest object is then written with S3 conditional headers on the ETag read while checking,
+// so concurrent changes fail the save, in which case the version written beforehand is removed.
+func (r *S3DiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
 	if len(ID) == 0 {
 		return errors.New("cannot save diff side data without ID")
 	}
 	if len(side) == 0 {
 		return errors.New("cannot save diff side data without side")
 	}
+	var conditional []func(*s3.Options)
+	if !cond.IsZero() {
+		digest, etag, err := r.current(ctx, ID, side)
+		if err != nil {
+			return err
+		}
+		if !cond.Allows(digest) {
+			return domain.PreconditionFailedError{ID: ID, Side: side}
+		}
+		if etag == "" {
+			conditional = append(conditional, withHeader("If-None-Match", "*"))
+		} else {
+			conditional = append(conditional, withHeader("If-Match", etag))
+		}
+	}
+	versions, err := r.ListVersions(ctx, ID, side)
+	if err != nil {
+		return err
+	}
+	next, created := 1, 0
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	} else if r.keepUsage {
+		if stored, err := r.hasSides(ctx, ID); err != nil {
+			return err
+		} else if !stored {
+			created = 1
+		}
+	}
+	next, err = r.putVersion(ctx, ID, side, next, data, meta)
+	if err != nil {
+		return err
+	}
+	err = r.put(ctx, keyOf(ID, side), data, meta, conditional...)
+	if conditionFailed(err) {
+		// best effort, the version would otherwise be listed without ever having been the latest one
+		r.delete(ctx, historyKeyOf(ID, side, next))
+		return domain.PreconditionFailedError{ID: ID, Side: side}
+	}
+	if err != nil {
+		return err
+	}
+	r.updateUsage(ctx, domain.TenantOf(ID), created, int64(len(data)))
+	return nil
+}
+
+// s3VersionAttempts bounds the version numbers tried while concurrent saves of the same side take them first
+const s3VersionAttempts = 5
+
+// putVersion writes a version of a side under the first number from next on that is not taken, and returns it
+func (r *S3DiffRepository) putVersion(ctx context.Context, ID, side string, next int, data []byte, meta domain.SideMetadata) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := r.put(ctx, historyKeyOf(ID, side, next), data, meta, withHeader("If-None-Match", "*"))
+		if !conditionFailed(err) {
+			return next, err
+		}
+		if attempt == s3VersionAttempts {
+			return 0, fmt.Errorf("cannot save version: %v", err)
+		}
+		next++
+	}
+}
+
+// conditionFailed tells whether a request failed the S3 conditional headers it was sent with
+func conditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict")
+}
+
+// hasSides tells whether any side of a diff is stored
+func (r *S3DiffRepository) hasSides(ctx context.Context, ID string) (bool, error) {
+	request := s3.ListObjectsV2Input{
+		Bucket:  aws.String(r.bucketName),
+		Prefix:  aws.String(keyPrefix + ID + "/"),
+		MaxKeys: 1,
+	}
+	response, err := r.client.ListObjectsV2(ctx, &request)
+	if err != nil {
+		return false, err
+	}
+	return len(response.Contents) > 0, nil
+}
+
+// s3DigestMetadata is the object metadata holding the digest of a side, so that preconditions are checked without reading it
+const s3DigestMetadata = "digest"
+
+func (r *S3DiffRepository) put(ctx context.Context, key string, data []byte, meta domain.SideMetadata, optFns ...func(*s3.Options)) error {
 	request := s3.PutObjectInput{
+		Bucket:   aws.String(r.bucketName),
+		Key:      aws.String(key),
+		Body:     bytes.NewReader(data),
+		Metadata: toObjectMetadata(meta),
+	}
+	request.Metadata[s3DigestMetadata] = domain.Digest(data)
+	if meta.ContentType != "" {
+		request.ContentType = aws.String(meta.ContentType)
+	}
+	_, err := r.client.PutObject(ctx, &request, optFns...)
+	return err
+}
+
+// current returns the digest and the S3 ETag of the latest version of a side, both empty when it is not stored.
+// The digest is read from the object metadata, or computed from the data of sides stored without it.
+func (r *S3DiffRepository) current(ctx context.Context, ID, side string) (string, string, error) {
+	request := s3.HeadObjectInput{
 		Bucket: aws.String(r.bucketName),
 		Key:    aws.String(keyOf(ID, side)),
-		Body:   bytes.NewReader(data),
 	}
-	_, err := r.client.PutObject(context.Background(), &request)
-	return err
+	response, err := r.client.HeadObject(ctx, &request)
+	if isHeadNotFound(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	for k, v := range response.Metadata {
+		// S3 returns metadata keys in lower case
+		if strings.ToLower(k) == s3DigestMetadata {
+			return v, aws.ToString(response.ETag), nil
+		}
+	}
+	return r.computeCurrent(ctx, ID, side)
 }
 
-type sideData struct {
-	side string
-	data []byte
+// computeCurrent returns the digest and the S3 ETag of the latest version of a side like current, reading its data
+func (r *S3DiffRepository) computeCurrent(ctx context.Context, ID, side string) (string, string, error) {
+	request := s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(keyOf(ID, side)),
+	}
+	response, err := r.client.GetObject(ctx, &request)
+	var notFound *types.NoSuchKey
+	if errors.As(err, &notFound) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	data, err := read(response.Body)
+	if err != nil {
+		return "", "", err
+	}
+	return domain.Digest(data), aws.ToString(response.ETag), nil
+}
+
+// withHeader adds a header to S3 requests, for those not modeled by this SDK version
+func withHeader(header, value string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.AddHeaderValue(header, value))
+	}
 }
 
 // GetDataSidesByID gets data sides by ID in parallel from S3
-func (r *S3DiffRepository) GetDataSidesByID(ID string) (map[string][]byte, error) {
-	m := make(map[string][]byte)
+func (r *S3DiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	return r.GetDataSidesByVersion(ctx, ID, map[string]int{
+		"left":  domain.LatestVersion,
+		"right": domain.LatestVersion,
+	})
+}
 
-	results := make(chan sideData, 2)
-	errors := make(chan error)
+// GetDataSidesByVersion gets the requested versions of the data sides of an ID in parallel from S3.
+// Failures are reported as SideErrors.
+func (r *S3DiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	sides := make([]string, 0, len(versions))
+	for side := range versions {
+		sides = append(sides, side)
+	}
 
-	retrieve := func(side string) {
-		data, err := r.retrieve(ID, side)
-		if err == nil {
-			results <- sideData{side, data}
-		} else {
-			errors <- err
+	var mu sync.Mutex
+	m := make(map[string][]byte)
+	err := fanOut(ctx, "S3.GetObject", sides, r.concurrency, func(ctx context.Context, side string) error {
+		key := keyOf(ID, side)
+		if version := versions[side]; version != domain.LatestVersion {
+			key = historyKeyOf(ID, side, version)
+		}
+		data, err := r.retrieve(ctx, key)
+		if err != nil || data == nil {
+			return err
 		}
+		mu.Lock()
+		defer mu.Unlock()
+		m[side] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m, nil
+}
 
-	go retrieve("left")
-	go retrieve("right")
+func (r *S3DiffRepository) retrieve(ctx context.Context, key string) ([]byte, error) {
+	request := s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	}
+	response, err := r.client.GetObject(ctx, &request)
+	if err == nil {
+		return read(response.Body)
+	}
+	var notFound *types.NoSuchKey
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	return nil, err
+}
 
-	var err error = nil
-	for latch := 0; latch < 2; latch++ {
-		select {
-		case result := <-results:
-			if result.data != nil {
-				m[result.side] = result.data
-			}
-		case err = <-errors:
+// GetMetadataByID gets the metadata of all data sides by ID in parallel from S3.
+// Failures are reported as SideErrors.
+func (r *S3DiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	var mu sync.Mutex
+	m := make(map[string]domain.SideMetadata)
+	err := fanOut(ctx, "S3.HeadObject", []string{"left", "right"}, r.concurrency, func(ctx context.Context, side string) error {
+		meta, err := r.head(ctx, ID, side)
+		if err != nil || meta == nil {
+			return err
 		}
+		mu.Lock()
+		defer mu.Unlock()
+		m[side] = *meta
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m, nil
+}
 
+func (r *S3DiffRepository) head(ctx context.Context, ID, side string) (*domain.SideMetadata, error) {
+	request := s3.HeadObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(keyOf(ID, side)),
+	}
+	response, err := r.client.HeadObject(ctx, &request)
 	if err == nil {
-		return m, nil
-	} else {
+		meta := fromObjectMetadata(response.Metadata)
+		meta.ContentType = aws.ToString(response.ContentType)
+		return &meta, nil
+	}
+	if isHeadNotFound(err) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// isHeadNotFound tells whether a HeadObject error means that the object does not exist.
+// HEAD responses have no body to decode, so the SDK reports missing objects as generic API errors
+// with a NotFound code, or only with their 404 status, rather than as types.NotFound.
+func isHeadNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+		return true
+	}
+	var responseErr *smithyhttp.ResponseError
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == 404
+}
+
+// DeleteDataSide deletes a data side and then all its versions from S3
+func (r *S3DiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	if len(ID) == 0 {
+		return errors.New("cannot delete diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot delete diff side data without side")
+	}
+	// sides stored before versioning have no versions, so whether the diff is removed is told by its sides
+	var storedBefore bool
+	if r.keepUsage {
+		var err error
+		if storedBefore, err = r.hasSides(ctx, ID); err != nil {
+			return err
+		}
+	}
+	if err := r.delete(ctx, keyOf(ID, side)); err != nil {
+		return err
+	}
+	versions, err := r.ListVersions(ctx, ID, side)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, v := range versions {
+		if err := r.delete(ctx, historyKeyOf(ID, side, v.Version)); err != nil {
+			return err
+		}
+		size += v.Size
+	}
+	if !r.keepUsage {
+		return nil
+	}
+	removed := 0
+	if storedBefore {
+		if storedAfter, err := r.hasSides(ctx, ID); err != nil {
+			return err
+		} else if !storedAfter {
+			removed = 1
+		}
+	}
+	r.updateUsage(ctx, domain.TenantOf(ID), -removed, -size)
+	return nil
+}
+
+func (r *S3DiffRepository) delete(ctx context.Context, key string) error {
+	request := s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(key),
+	}
+	_, err := r.client.DeleteObject(ctx, &request)
+	return err
+}
+
+// DeleteDataSidesByID deletes all data sides of an ID from S3, and then its session
+func (r *S3DiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	for _, side := range []string{"left", "right"} {
+		if err := r.DeleteDataSide(ctx, ID, side); err != nil {
+			return err
+		}
+	}
+	return r.delete(ctx, sessionKeyOf(ID))
+}
+
+// SaveSession saves the session of a diff to S3 as a JSON object
+func (r *S3DiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	if len(session.ID) == 0 {
+		return errors.New("cannot save session without ID")
+	}
+	request := s3.PutObjectInput{
+		Bucket:      aws.String(r.bucketName),
+		Key:         aws.String(sessionKeyOf(session.ID)),
+		Body:        bytes.NewReader(encodeSession(session)),
+		ContentType: aws.String("application/json"),
+	}
+	_, err := r.client.PutObject(ctx, &request)
+	return err
+}
+
+// GetSession gets the session of a diff from S3, nil if it has none
+func (r *S3DiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	data, err := r.retrieve(ctx, sessionKeyOf(ID))
+	if err != nil || data == nil {
 		return nil, err
 	}
+	return decodeSession(data)
 }
 
-func (r *S3DiffRepository) retrieve(ID, side string) ([]byte, error) {
-	request := s3.GetObjectInput{
+// Ping checks that the bucket exists and is accessible
+func (r *S3DiffRepository) Ping(ctx context.Context) error {
+	_, err := r.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(r.bucketName)})
+	return err
+}
+
+// s3MaxKeys is the maximum number of keys S3 returns in a page of results
+const s3MaxKeys = 1000
+
+// ListDiffs lists a page of the diffs whose ID starts with the prefix, in ID order.
+// Keys are listed from the ones following the diff after, and S3 results are read only
+// until the diffs of the page are complete, rather than listing every matching key.
+func (r *S3DiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	listing := s3Listing{index: make(map[string]int)}
+
+	request := s3.ListObjectsV2Input{
 		Bucket: aws.String(r.bucketName),
-		Key:    aws.String(keyOf(ID, side)),
+		Prefix: aws.String(keyPrefix + prefix),
 	}
-	response, err := r.client.GetObject(context.Background(), &request)
-	if err == nil {
-		return read(response.Body)
+	if after != "" {
+		// the keys of every diff after it follow its own keys and those of the diffs under its path
+		request.StartAfter = aws.String(keyPrefix + after + "/")
+	}
+	if limit > 0 && 2*limit+2 < s3MaxKeys {
+		// every diff has up to two sides, and one more diff tells that the page is complete
+		request.MaxKeys = int32(2*limit + 2)
+	}
+	for {
+		response, err := r.client.ListObjectsV2(ctx, &request)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range response.Contents {
+			key := aws.ToString(object.Key)
+			ID, ok := idOf(key)
+			if !ok || !strings.HasPrefix(ID, prefix) || (after != "" && !domain.LessID(after, ID)) {
+				continue
+			}
+			if _, seen := listing.index[ID]; !seen && limit > 0 && len(listing.diffs) == limit {
+				listing.add(ID, object.Size, object.LastModified)
+				if err := r.completeListing(ctx, &listing, key, prefix, after); err != nil {
+					return nil, err
+				}
+				return listing.page(limit), nil
+			}
+			listing.add(ID, object.Size, object.LastModified)
+		}
+		if !response.IsTruncated {
+			return listing.page(limit), nil
+		}
+		request.ContinuationToken = response.NextContinuationToken
+	}
+}
+
+// completeListing completes the diffs of a listing stopped at a key.
+// Keys are sorted with the side names, so the sides of a diff come after the keys of
+// the diffs under its path whose names sort before them, e.g. diff/acme/left follows
+// diff/acme/1/left. Such a diff may only be the one of the key or one above it in its path,
+// and its missing sides are read directly rather than listing all the keys under its path.
+func (r *S3DiffRepository) completeListing(ctx context.Context, listing *s3Listing, key, prefix, after string) error {
+	ID, _ := idOf(key)
+	for i := len(ID); i > 0; i = strings.LastIndex(ID[:i], "/") {
+		parent := ID[:i]
+		if !strings.HasPrefix(parent, prefix) || (after != "" && !domain.LessID(after, parent)) {
+			continue
+		}
+		// other diffs sort after every listed one unless they are listed or have listed diffs under their path
+		_, listed := listing.index[parent]
+		if (parent == ID || !listed) && !listing.hasUnder(parent) {
+			continue
+		}
+		for _, side := range []string{"left", "right"} {
+			sideKey := keyOf(parent, side)
+			if sideKey <= key {
+				continue
+			}
+			response, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(r.bucketName),
+				Key:    aws.String(sideKey),
+			})
+			if isHeadNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			listing.add(parent, response.ContentLength, response.LastModified)
+		}
+	}
+	return nil
+}
+
+// s3Listing aggregates the sizes and modification times of the keys of each listed diff
+type s3Listing struct {
+	diffs []domain.DiffSummary
+	index map[string]int
+}
+
+func (l *s3Listing) add(ID string, size int64, lastModified *time.Time) {
+	i, seen := l.index[ID]
+	if !seen {
+		i = len(l.diffs)
+		l.index[ID] = i
+		l.diffs = append(l.diffs, domain.DiffSummary{ID: ID})
+	}
+	l.diffs[i].Size += size
+	if lastModified != nil && lastModified.After(l.diffs[i].LastModified) {
+		l.diffs[i].LastModified = *lastModified
+	}
+}
+
+// hasUnder tells whether any listed diff is under the path of an ID
+func (l *s3Listing) hasUnder(ID string) bool {
+	for _, d := range l.diffs {
+		if strings.HasPrefix(d.ID, ID+"/") {
+			return true
+		}
 	}
+	return false
+}
+
+func (l *s3Listing) page(limit int) []domain.DiffSummary {
+	return pageOf(l.diffs, "", limit)
+}
+
+// GetUsage gets the usage of a tenant from S3.
+// Usage is counted from the stored objects of the tenant the first time it is read or written,
+// since diffs may have been stored before it was kept, and every time it is read when it is not kept.
+func (r *S3DiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	if !r.keepUsage {
+		return r.countUsage(ctx, tenant)
+	}
+	usage, etag, err := r.usage(ctx, tenant)
+	if err != nil {
+		return domain.Usage{}, err
+	}
+	if etag == "" {
+		// best effort, usage is counted again until it is stored
+		r.putUsage(ctx, tenant, usage, withHeader("If-None-Match", "*"))
+	}
+	return usage, nil
+}
+
+// updateUsage adds the changes in the number of diffs and bytes of a tenant to its usage when it is kept.
+// The changes follow writes that are already committed, so failures are logged rather than failing the writes.
+func (r *S3DiffRepository) updateUsage(ctx context.Context, tenant domain.Tenant, diffs int, bytes int64) {
+	if !r.keepUsage || (diffs == 0 && bytes == 0) {
+		return
+	}
+	if err := r.addUsage(ctx, tenant, diffs, bytes); err != nil {
+		log.Printf("usage of tenant %q is off by %d diffs and %d bytes: %v", tenant, diffs, bytes, err)
+	}
+}
+
+// s3UsageAttempts bounds the attempts to update the usage of a tenant while concurrent writes update it first
+const s3UsageAttempts = 5
+
+// addUsage adds the changes in the number of diffs and bytes of a tenant to its usage,
+// with S3 conditional headers so that concurrent updates are not lost.
+// Usage that was never stored is counted from the stored objects, which already include the changes.
+// Changes are not atomic with the writes they follow, so failures leave the usage off by their size.
+func (r *S3DiffRepository) addUsage(ctx context.Context, tenant domain.Tenant, diffs int, bytes int64) error {
+	for attempt := 1; ; attempt++ {
+		usage, etag, err := r.usage(ctx, tenant)
+		if err != nil {
+			return fmt.Errorf("cannot get usage: %v", err)
+		}
+		condition := withHeader("If-None-Match", "*")
+		if etag != "" {
+			condition = withHeader("If-Match", etag)
+			usage.Diffs += diffs
+			usage.Bytes += bytes
+		}
+		err = r.putUsage(ctx, tenant, usage, condition)
+		if err == nil {
+			return nil
+		}
+		if !conditionFailed(err) || attempt == s3UsageAttempts {
+			return fmt.Errorf("cannot update usage: %v", err)
+		}
+	}
+}
+
+// storedUsage is the serialized form of usage in S3
+type storedUsage struct {
+	Diffs int   `json:"diffs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// usage returns the usage of a tenant along with the ETag of its object,
+// counting it from the stored objects with an empty ETag when it is not stored
+func (r *S3DiffRepository) usage(ctx context.Context, tenant domain.Tenant) (domain.Usage, string, error) {
+	request := s3.GetObjectInput{
+		Bucket: aws.String(r.bucketName),
+		Key:    aws.String(usageKeyOf(tenant)),
+	}
+	response, err := r.client.GetObject(ctx, &request)
 	var notFound *types.NoSuchKey
 	if errors.As(err, &notFound) {
-		return nil, nil
+		usage, err := r.countUsage(ctx, tenant)
+		return usage, "", err
 	}
-	return nil, err
+	if err != nil {
+		return domain.Usage{}, "", err
+	}
+	data, err := read(response.Body)
+	if err != nil {
+		return domain.Usage{}, "", err
+	}
+	var stored storedUsage
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return domain.Usage{}, "", err
+	}
+	return domain.Usage(stored), aws.ToString(response.ETag), nil
+}
+
+func (r *S3DiffRepository) putUsage(ctx context.Context, tenant domain.Tenant, usage domain.Usage, optFns ...func(*s3.Options)) error {
+	data, _ := json.Marshal(storedUsage(usage))
+	request := s3.PutObjectInput{
+		Bucket:      aws.String(r.bucketName),
+		Key:         aws.String(usageKeyOf(tenant)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}
+	_, err := r.client.PutObject(ctx, &request, optFns...)
+	return err
+}
+
+// countUsage counts the diffs of a tenant and the bytes of all their versions, going through every page of S3 results
+func (r *S3DiffRepository) countUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	var usage domain.Usage
+	diffs, err := r.ListDiffs(ctx, tenant.Scope(""), "", 0)
+	if err != nil {
+		return usage, err
+	}
+	for _, d := range diffs {
+		// the default tenant shares the key prefix of all tenants
+		if domain.TenantOf(d.ID) == tenant {
+			usage.Diffs++
+		}
+	}
+
+	request := s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucketName),
+		Prefix: aws.String(historyPrefix + tenant.Scope("")),
+	}
+	for {
+		response, err := r.client.ListObjectsV2(ctx, &request)
+		if err != nil {
+			return usage, err
+		}
+		for _, object := range response.Contents {
+			if ID, ok := historyIDOf(aws.ToString(object.Key)); ok && domain.TenantOf(ID) == tenant {
+				usage.Bytes += object.Size
+			}
+		}
+		if !response.IsTruncated {
+			return usage, nil
+		}
+		request.ContinuationToken = response.NextContinuationToken
+	}
+}
+
+// ListVersions lists the versions stored for a side in S3, oldest first
+func (r *S3DiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	var versions []domain.SideVersion
+
+	prefix := historyPrefixOf(ID, side)
+	request := s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucketName),
+		Prefix: aws.String(prefix),
+	}
+	for {
+		response, err := r.client.ListObjectsV2(ctx, &request)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range response.Contents {
+			n, err := strconv.Atoi(strings.TrimPrefix(aws.ToString(object.Key), prefix))
+			if err != nil {
+				continue
+			}
+			versions = append(versions, domain.SideVersion{
+				Version:    n,
+				Size:       object.Size,
+				UploadedAt: aws.ToTime(object.LastModified),
+			})
+		}
+		if !response.IsTruncated {
+			break
+		}
+		request.ContinuationToken = response.NextContinuationToken
+	}
+	// keys are listed in lexicographical order, so v10 comes before v2
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
 }
 
 func read(body io.ReadCloser) ([]byte, error) {
@@ -112,6 +735,104 @@ func read(body io.ReadCloser) ([]byte, error) {
 	return nil, err
 }
 
+// toObjectMetadata maps side metadata to S3 user-defined metadata.
+// Values are URL-encoded since S3 only accepts US-ASCII in them.
+func toObjectMetadata(meta domain.SideMetadata) map[string]string {
+	m := map[string]string{
+		"uploaded-at": meta.UploadedAt.Format(time.RFC3339Nano),
+	}
+	if meta.Filename != "" {
+		m["filename"] = url.QueryEscape(meta.Filename)
+	}
+	if meta.Uploader != "" {
+		m["uploader"] = url.QueryEscape(meta.Uploader)
+	}
+	if len(meta.Labels) > 0 {
+		labels := url.Values{}
+		for k, v := range meta.Labels {
+			labels.Set(k, v)
+		}
+		m["labels"] = labels.Encode()
+	}
+	return m
+}
+
+func fromObjectMetadata(m map[string]string) domain.SideMetadata {
+	var meta domain.SideMetadata
+	// S3 returns metadata keys in lower case
+	for k, v := range m {
+		switch strings.ToLower(k) {
+		case "uploaded-at":
+			meta.UploadedAt, _ = time.Parse(time.RFC3339Nano, v)
+		case "filename":
+			meta.Filename, _ = url.QueryUnescape(v)
+		case "uploader":
+			meta.Uploader, _ = url.QueryUnescape(v)
+		case "labels":
+			labels, _ := url.ParseQuery(v)
+			meta.Labels = make(map[string]string, len(labels))
+			for label := range labels {
+				meta.Labels[label] = labels.Get(label)
+			}
+		}
+	}
+	return meta
+}
+
+const keyPrefix = "diff/"
+
 func keyOf(ID, side string) string {
-	return fmt.Sprintf("diff/%s/%s", ID, side)
+	return fmt.Sprintf("%s%s/%s", keyPrefix, ID, side)
+}
+
+const sessionPrefix = "session/"
+
+func sessionKeyOf(ID string) string {
+	return sessionPrefix + ID
+}
+
+const historyPrefix = "history/"
+
+func historyPrefixOf(ID, side string) string {
+	return fmt.Sprintf("%s%s/%s/", historyPrefix, ID, side)
+}
+
+func historyKeyOf(ID, side string, version int) string {
+	return historyPrefixOf(ID, side) + strconv.Itoa(version)
+}
+
+// historyIDOf extracts the diff ID out of the key of a version
+func historyIDOf(key string) (string, bool) {
+	if !strings.HasPrefix(key, historyPrefix) {
+		return "", false
+	}
+	rest := key[len(historyPrefix):]
+	i := strings.LastIndex(rest, "/")
+	if i < 0 {
+		return "", false
+	}
+	j := strings.LastIndex(rest[:i], "/")
+	if j <= 0 {
+		return "", false
+	}
+	return rest[:j], true
+}
+
+const usagePrefix = "usage/"
+
+// usageKeyOf returns the key of the usage of a tenant, "_" standing for the default tenant since no tenant name starts with it
+func usageKeyOf(tenant domain.Tenant) string {
+	if tenant == domain.DefaultTenant {
+		return usagePrefix + "_"
+	}
+	return usagePrefix + tenant.String()
+}
+
+// idOf extracts the diff ID out of an object key
+func idOf(key string) (string, bool) {
+	i := strings.LastIndex(key, "/")
+	if !strings.HasPrefix(key, keyPrefix) || i < len(keyPrefix) {
+		return "", false
+	}
+	return key[len(keyPrefix):i], true
 }
@@ -3,15 +3,25 @@ package repository_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/ehpalumbo/go-diff/domain"
 	"github.com/ehpalumbo/go-diff/repository"
 	"github.com/ehpalumbo/go-diff/repository/mocks"
 	"github.com/golang/mock/gomock"
@@ -20,7 +30,7 @@ import (
 func setUp(t *testing.T) (*repository.S3DiffRepository, *mocks.MockS3Client, func()) {
 	ctrl := gomock.NewController(t)
 	s3 := mocks.NewMockS3Client(ctrl)
-	repo := repository.NewS3DiffRepository(s3, "go-diff-bucket")
+	repo := repository.NewS3DiffRepository(s3, "go-diff-bucket").WithUsage()
 	return repo, s3, func() {
 		ctrl.Finish()
 	}
@@ -62,6 +72,18 @@ func (m *GetObjectInputMatcher) String() string {
 	return "GetObjectInput argument matcher"
 }
 
+// expectUsageUpdate expects the usage of the default tenant to be read as stored and written as updated
+func expectUsageUpdate(client *mocks.MockS3Client, stored, updated string) []*gomock.Call {
+	usage := s3.GetObjectOutput{
+		Body: ioutil.NopCloser(strings.NewReader(stored)),
+		ETag: aws.String(`"usage"`),
+	}
+	return []*gomock.Call{
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "usage/_"}).Return(&usage, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "usage/_", updated}, gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+	}
+}
+
 func TestSaveOperation(t *testing.T) {
 
 	cases := []struct {
@@ -91,9 +113,30 @@ func TestSaveOperation(t *testing.T) {
 				body:       c.data,
 			}
 
-			client.EXPECT().PutObject(gomock.Any(), &putObjectInput).Return(&s3.PutObjectOutput{}, nil)
+			versionObjectInput := PutObjectInputMatcher{
+				bucketName: "go-diff-bucket",
+				objectKey:  "history/1/left/3",
+				body:       c.data,
+			}
+
+			listing := s3.ListObjectsV2Output{
+				Contents: []types.Object{
+					{Key: aws.String("history/1/left/1")},
+					{Key: aws.String("history/1/left/2")},
+				},
+			}
+			calls := []*gomock.Call{
+				client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&listing, nil),
+				client.EXPECT().PutObject(gomock.Any(), &versionObjectInput, gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+				client.EXPECT().PutObject(gomock.Any(), &putObjectInput).Return(&s3.PutObjectOutput{}, nil),
+			}
+			// saving no bytes to a stored diff leaves usage as it is
+			if len(c.data) > 0 {
+				calls = append(calls, expectUsageUpdate(client, `{"diffs":1,"bytes":10}`, fmt.Sprintf(`{"diffs":1,"bytes":%d}`, 10+len(c.data)))...)
+			}
+			gomock.InOrder(calls...)
 
-			if err := repo.SaveDataSide("1", "left", []byte(c.data)); err != nil {
+			if err := repo.SaveDataSide(context.Background(), "1", "left", []byte(c.data), domain.SideMetadata{}); err != nil {
 				t.Errorf("save operation failed, got: %v", err)
 			}
 		})
@@ -102,6 +145,95 @@ func TestSaveOperation(t *testing.T) {
 
 }
 
+func TestSaveOperationTakesTheNextFreeVersion(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	listing := s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: aws.String("history/1/left/1")}},
+	}
+	onlyIfAbsent := func(_ context.Context, _ *s3.PutObjectInput, optFns ...func(*s3.Options)) {
+		if v := requestHeaders(t, optFns).Get("If-None-Match"); v != "*" {
+			t.Errorf("versions should only be written if absent, got If-None-Match: %s", v)
+		}
+	}
+	gomock.InOrder(append([]*gomock.Call{
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&listing, nil),
+		// a concurrent save took version 2 after the listing
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/2", "hello"}, gomock.Any()).
+			Do(onlyIfAbsent).Return(nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/3", "hello"}, gomock.Any()).
+			Do(onlyIfAbsent).Return(&s3.PutObjectOutput{}, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "diff/1/left", "hello"}).Return(&s3.PutObjectOutput{}, nil),
+	}, expectUsageUpdate(client, `{"diffs":1,"bytes":10}`, `{"diffs":1,"bytes":15}`)...)...)
+
+	// when
+	err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+
+	// then
+	if err != nil {
+		t.Errorf("save operation failed, got: %v", err)
+	}
+}
+
+func TestSaveOperationWithoutUsage(t *testing.T) {
+
+	// given
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockS3Client(ctrl)
+	repo := repository.NewS3DiffRepository(client, "go-diff-bucket")
+
+	// neither the sides of the diff nor the usage of its tenant are read
+	gomock.InOrder(
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&s3.ListObjectsV2Output{}, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/1", "hello"}, gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "diff/1/left", "hello"}).Return(&s3.PutObjectOutput{}, nil),
+	)
+
+	// when
+	err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+
+	// then
+	if err != nil {
+		t.Errorf("save operation failed, got: %v", err)
+	}
+}
+
+func TestSaveOperationLogsUsageFailures(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	listing := s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: aws.String("history/1/left/1")}},
+	}
+	gomock.InOrder(
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&listing, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/2", "hello"}, gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "diff/1/left", "hello"}).Return(&s3.PutObjectOutput{}, nil),
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "usage/_"}).Return(nil, errors.New("oops")),
+	)
+
+	// when
+	err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+
+	// then
+	if err != nil {
+		t.Errorf("save operation failed after storing the side, got: %v", err)
+	}
+	if !strings.Contains(logs.String(), `usage of tenant "" is off by 0 diffs and 5 bytes`) {
+		t.Errorf("usage failure was not logged, got: %q", logs.String())
+	}
+}
+
 func TestRejectedSaveOperation(t *testing.T) {
 
 	cases := []struct {
@@ -129,7 +261,7 @@ func TestRejectedSaveOperation(t *testing.T) {
 			repo, _, tearDown := setUp(t)
 			defer tearDown()
 
-			err := repo.SaveDataSide(c.ID, c.side, []byte("hello"))
+			err := repo.SaveDataSide(context.Background(), c.ID, c.side, []byte("hello"), domain.SideMetadata{})
 
 			if err == nil {
 				t.Fatal("accepted invalid input")
@@ -202,7 +334,7 @@ func TestGetOperation(t *testing.T) {
 			}
 
 			// when
-			ds, err := repo.GetDataSidesByID(c.ID)
+			ds, err := repo.GetDataSidesByID(context.Background(), c.ID)
 
 			// then
 			if err != nil {
@@ -246,7 +378,7 @@ func TestGetOperationPropagatesFailure(t *testing.T) {
 	client.EXPECT().GetObject(gomock.Any(), &getRightObjectInput).Return(&s3.GetObjectOutput{}, errors.New("Oops!"))
 
 	// when
-	ds, err := repo.GetDataSidesByID("1")
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
 
 	// then
 	if err == nil {
@@ -256,3 +388,787 @@ func TestGetOperationPropagatesFailure(t *testing.T) {
 		t.Errorf("failed but returned non-nil map, got: %v", ds)
 	}
 }
+
+// DeleteObjectInputMatcher
+type DeleteObjectInputMatcher struct {
+	bucketName, objectKey string
+}
+
+func (m *DeleteObjectInputMatcher) Matches(x interface{}) bool {
+	if input, ok := x.(*s3.DeleteObjectInput); ok {
+		return *input.Bucket == m.bucketName && *input.Key == m.objectKey
+	}
+	return false
+}
+
+func (m *DeleteObjectInputMatcher) String() string {
+	return "DeleteObjectInput argument matcher"
+}
+
+func TestDeleteSideOperation(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	deleteObjectInput := DeleteObjectInputMatcher{
+		bucketName: "go-diff-bucket",
+		objectKey:  "diff/1/left",
+	}
+	listing := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("history/1/left/1"), Size: 2},
+			{Key: aws.String("history/1/left/2"), Size: 3},
+		},
+	}
+	sides := s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: aws.String("diff/1/left")}},
+	}
+	gomock.InOrder(append([]*gomock.Call{
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/1/", ""}).Return(&sides, nil),
+		client.EXPECT().DeleteObject(gomock.Any(), &deleteObjectInput).Return(&s3.DeleteObjectOutput{}, nil),
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&listing, nil),
+		client.EXPECT().DeleteObject(gomock.Any(), &DeleteObjectInputMatcher{"go-diff-bucket", "history/1/left/1"}).Return(&s3.DeleteObjectOutput{}, nil),
+		client.EXPECT().DeleteObject(gomock.Any(), &DeleteObjectInputMatcher{"go-diff-bucket", "history/1/left/2"}).Return(&s3.DeleteObjectOutput{}, nil),
+		// the deleted side was the last one of the diff
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/1/", ""}).Return(&s3.ListObjectsV2Output{}, nil),
+	}, expectUsageUpdate(client, `{"diffs":2,"bytes":9}`, `{"diffs":1,"bytes":4}`)...)...)
+
+	// when
+	err := repo.DeleteDataSide(context.Background(), "1", "left")
+
+	// then
+	if err != nil {
+		t.Errorf("delete operation failed, got: %v", err)
+	}
+}
+
+func TestDeleteSideOperationCountsDiffsWithoutVersions(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	// sides stored before versioning have no versions
+	sides := s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: aws.String("diff/1/left")}},
+	}
+	gomock.InOrder(append([]*gomock.Call{
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/1/", ""}).Return(&sides, nil),
+		client.EXPECT().DeleteObject(gomock.Any(), &DeleteObjectInputMatcher{"go-diff-bucket", "diff/1/left"}).Return(&s3.DeleteObjectOutput{}, nil),
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&s3.ListObjectsV2Output{}, nil),
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/1/", ""}).Return(&s3.ListObjectsV2Output{}, nil),
+	}, expectUsageUpdate(client, `{"diffs":2,"bytes":9}`, `{"diffs":1,"bytes":9}`)...)...)
+
+	// when
+	err := repo.DeleteDataSide(context.Background(), "1", "left")
+
+	// then
+	if err != nil {
+		t.Errorf("delete operation failed, got: %v", err)
+	}
+}
+
+func TestDeleteAllSidesOperation(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	for _, side := range []string{"left", "right"} {
+		deleteObjectInput := DeleteObjectInputMatcher{
+			bucketName: "go-diff-bucket",
+			objectKey:  "diff/1/" + side,
+		}
+		client.EXPECT().DeleteObject(gomock.Any(), &deleteObjectInput).Return(&s3.DeleteObjectOutput{}, nil)
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/" + side + "/", ""}).Return(&s3.ListObjectsV2Output{}, nil)
+	}
+	client.EXPECT().DeleteObject(gomock.Any(), &DeleteObjectInputMatcher{bucketName: "go-diff-bucket", objectKey: "session/1"}).Return(&s3.DeleteObjectOutput{}, nil)
+	// no side is stored, so usage is left as it is
+	client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/1/", ""}).Return(&s3.ListObjectsV2Output{}, nil).Times(2)
+
+	// when
+	err := repo.DeleteDataSidesByID(context.Background(), "1")
+
+	// then
+	if err != nil {
+		t.Errorf("delete operation failed, got: %v", err)
+	}
+}
+
+func TestDeleteOperationPropagatesFailure(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil)
+	client.EXPECT().DeleteObject(gomock.Any(), gomock.Any()).Return(nil, errors.New("Oops!"))
+
+	// when
+	err := repo.DeleteDataSidesByID(context.Background(), "1")
+
+	// then
+	if err == nil {
+		t.Fatal("should have failed but it did not")
+	}
+}
+
+func TestRejectedDeleteOperation(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		ID       string
+		side     string
+		expected error
+	}{
+		{
+			name:     "empty ID",
+			side:     "left",
+			expected: errors.New("cannot delete diff side data without ID"),
+		},
+		{
+			name:     "empty side",
+			ID:       "1",
+			expected: errors.New("cannot delete diff side data without side"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			repo, _, tearDown := setUp(t)
+			defer tearDown()
+
+			err := repo.DeleteDataSide(context.Background(), c.ID, c.side)
+
+			if err == nil {
+				t.Fatal("accepted invalid input")
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+
+		})
+
+	}
+
+}
+
+// ListObjectsV2InputMatcher
+type ListObjectsV2InputMatcher struct {
+	bucketName, prefix, token string
+}
+
+func (m *ListObjectsV2InputMatcher) Matches(x interface{}) bool {
+	if input, ok := x.(*s3.ListObjectsV2Input); ok {
+		return *input.Bucket == m.bucketName && *input.Prefix == m.prefix && aws.ToString(input.ContinuationToken) == m.token
+	}
+	return false
+}
+
+func (m *ListObjectsV2InputMatcher) String() string {
+	return "ListObjectsV2Input argument matcher"
+}
+
+func TestListOperationGoesThroughAllPages(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	t1 := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	firstPage := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("diff/ci-1/left"), LastModified: &t1, Size: 5},
+			{Key: aws.String("diff/ci-1/right"), LastModified: &t2, Size: 3},
+		},
+		IsTruncated:           true,
+		NextContinuationToken: aws.String("next"),
+	}
+	secondPage := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("diff/ci-2/left"), LastModified: &t1},
+		},
+	}
+	gomock.InOrder(
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/ci-", ""}).Return(&firstPage, nil),
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/ci-", "next"}).Return(&secondPage, nil),
+	)
+
+	// when
+	diffs, err := repo.ListDiffs(context.Background(), "ci-", "", 0)
+
+	// then
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("wrong number of diffs, expected: 2, got: %v", diffs)
+	}
+	if diffs[0].ID != "ci-1" || !diffs[0].LastModified.Equal(t2) || diffs[0].Size != 8 {
+		t.Errorf("wrong first diff, got: %v", diffs[0])
+	}
+	if diffs[1].ID != "ci-2" || !diffs[1].LastModified.Equal(t1) {
+		t.Errorf("wrong second diff, got: %v", diffs[1])
+	}
+}
+
+func TestListOperationStartsAfterTheCursor(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	page := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("diff/ci-2/left"), Size: 3},
+			{Key: aws.String("diff/ci-2/right"), Size: 5},
+			{Key: aws.String("diff/ci-3/left"), Size: 1},
+			{Key: aws.String("diff/ci-4/left"), Size: 1},
+		},
+		IsTruncated:           true,
+		NextContinuationToken: aws.String("next"),
+	}
+	client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			if aws.ToString(input.Prefix) != "diff/ci-" || aws.ToString(input.StartAfter) != "diff/ci-1/" || input.MaxKeys != 6 {
+				t.Errorf("wrong listing request, got prefix: %q, start after: %q, max keys: %d",
+					aws.ToString(input.Prefix), aws.ToString(input.StartAfter), input.MaxKeys)
+			}
+			return &page, nil
+		})
+
+	// when
+	diffs, err := repo.ListDiffs(context.Background(), "ci-", "ci-1", 2)
+
+	// then
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 2 || diffs[0].ID != "ci-2" || diffs[0].Size != 8 || diffs[1].ID != "ci-3" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+}
+
+func TestListOperationCompletesDiffsAboveTheLastKey(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	// the sides of diff acme follow the keys of diffs under its path, like acme/1
+	page := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("diff/acme/1/left"), Size: 1},
+			{Key: aws.String("diff/acme/2/left"), Size: 1},
+		},
+		IsTruncated:           true,
+		NextContinuationToken: aws.String("next"),
+	}
+	client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&page, nil)
+	client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			if *input.Key == "diff/acme/left" {
+				return &s3.HeadObjectOutput{ContentLength: 3}, nil
+			}
+			return nil, &smithy.GenericAPIError{Code: "NotFound", Message: "Not Found"}
+		}).Times(2)
+
+	// when
+	diffs, err := repo.ListDiffs(context.Background(), "", "", 1)
+
+	// then
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].ID != "acme" || diffs[0].Size != 3 {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+}
+
+func TestListOperationPropagatesFailure(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(nil, errors.New("Oops!"))
+
+	// when
+	diffs, err := repo.ListDiffs(context.Background(), "", "", 0)
+
+	// then
+	if err == nil {
+		t.Fatal("should have failed but it did not")
+	}
+	if diffs != nil {
+		t.Errorf("failed but returned diffs, got: %v", diffs)
+	}
+}
+
+func TestSaveOperationStoresMetadata(t *testing.T) {
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	meta := domain.SideMetadata{
+		Filename:    "left file.txt",
+		ContentType: "text/plain",
+		Labels:      map[string]string{"pipeline": "ci"},
+		Uploader:    "gopher",
+		UploadedAt:  time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	var stored *s3.PutObjectInput
+	expectUsageUpdate(client, `{"diffs":0,"bytes":0}`, `{"diffs":1,"bytes":5}`)
+	client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil).Times(2)
+	client.EXPECT().PutObject(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			stored = input
+			return &s3.PutObjectOutput{}, nil
+		}).Times(2)
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), meta); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+
+	client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			if *input.Key == "diff/1/left" {
+				return &s3.HeadObjectOutput{Metadata: stored.Metadata, ContentType: stored.ContentType}, nil
+			}
+			return nil, &smithy.GenericAPIError{Code: "NotFound", Message: "Not Found"}
+		}).Times(2)
+
+	m, err := repo.GetMetadataByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get metadata operation failed, got: %v", err)
+	}
+	if len(m) != 1 {
+		t.Fatalf("wrong number of results, expected: 1, got: %v", len(m))
+	}
+	if !reflect.DeepEqual(m["left"], meta) {
+		t.Errorf("wrong metadata, expected: %v, got: %v", meta, m["left"])
+	}
+}
+
+func TestGetMetadataOperationPropagatesFailure(t *testing.T) {
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(nil, errors.New("oops")).Times(2)
+
+	if _, err := repo.GetMetadataByID(context.Background(), "1"); err == nil {
+		t.Error("expected error, got none")
+	}
+}
+
+func TestGetMetadataOperationReportsMissingObjectsAsMissingSides(t *testing.T) {
+
+	// HEAD responses have no body, so the SDK cannot decode them into modeled errors
+	notFound := &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: 404}},
+		Err:      errors.New("not found"),
+	}
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{"generic API error", &smithy.GenericAPIError{Code: "NotFound", Message: "Not Found"}},
+		{"operation error with 404 status", &smithy.OperationError{ServiceID: "S3", OperationName: "HeadObject", Err: notFound}},
+		{"modeled error", &types.NotFound{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// given
+			repo, client, tearDown := setUp(t)
+			defer tearDown()
+			client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ interface{}, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					if *input.Key == "diff/1/left" {
+						return &s3.HeadObjectOutput{}, nil
+					}
+					return nil, c.err
+				}).Times(2)
+
+			// when
+			m, err := repo.GetMetadataByID(context.Background(), "1")
+
+			// then
+			if err != nil {
+				t.Fatalf("missing side should not fail, got: %v", err)
+			}
+			if _, ok := m["left"]; !ok || len(m) != 1 {
+				t.Errorf("should have reported the left side only, got: %v", m)
+			}
+		})
+	}
+}
+
+func TestListVersionsOperation(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	t1 := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	listing := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("history/1/left/1"), Size: 5, LastModified: &t1},
+			{Key: aws.String("history/1/left/10"), Size: 7, LastModified: &t1},
+			{Key: aws.String("history/1/left/2"), Size: 6, LastModified: &t1},
+		},
+	}
+	client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/1/left/", ""}).Return(&listing, nil)
+
+	// when
+	versions, err := repo.ListVersions(context.Background(), "1", "left")
+
+	// then
+	if err != nil {
+		t.Fatalf("list versions operation failed, got: %v", err)
+	}
+	expected := []domain.SideVersion{
+		{Version: 1, Size: 5, UploadedAt: t1},
+		{Version: 2, Size: 6, UploadedAt: t1},
+		{Version: 10, Size: 7, UploadedAt: t1},
+	}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("wrong versions, expected: %v, got: %v", expected, versions)
+	}
+}
+
+func TestGetVersionsOperation(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "history/1/left/3"}).
+		Return(&s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader([]byte("hello")))}, nil)
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/right"}).
+		Return(nil, &types.NoSuchKey{})
+
+	// when
+	ds, err := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 3, "right": domain.LatestVersion})
+
+	// then
+	if err != nil {
+		t.Fatalf("get versions operation failed, got: %v", err)
+	}
+	if len(ds) != 1 || string(ds["left"]) != "hello" {
+		t.Errorf("wrong versioned data sides, got: %v", ds)
+	}
+}
+
+// requestHeaders returns the headers that the S3 options add to requests
+func requestHeaders(t *testing.T, optFns []func(*s3.Options)) http.Header {
+	var options s3.Options
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	stack := middleware.NewStack("test", smithyhttp.NewStackRequest)
+	for _, fn := range options.APIOptions {
+		if err := fn(stack); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var headers http.Header
+	handler := middleware.HandlerFunc(func(_ context.Context, in interface{}) (interface{}, middleware.Metadata, error) {
+		headers = in.(*smithyhttp.Request).Header
+		return nil, middleware.Metadata{}, nil
+	})
+	if _, _, err := middleware.DecorateHandler(handler, stack).Handle(context.Background(), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	return headers
+}
+
+func TestConditionalSaveOperation(t *testing.T) {
+
+	etag := `"5d41402abc4b2a76b9719d911017c592"`
+	cases := []struct {
+		name   string
+		cond   domain.SidePrecondition
+		head   *s3.HeadObjectOutput
+		stored *s3.GetObjectOutput
+		header string
+		value  string
+	}{
+		{
+			name:   "update of matching side",
+			cond:   domain.SidePrecondition{IfMatch: []string{domain.Digest([]byte("hello"))}},
+			head:   &s3.HeadObjectOutput{ETag: aws.String(etag), Metadata: map[string]string{"digest": domain.Digest([]byte("hello"))}},
+			header: "If-Match",
+			value:  etag,
+		},
+		{
+			name: "update of matching side stored without digest",
+			cond: domain.SidePrecondition{IfMatch: []string{domain.Digest([]byte("hello"))}},
+			head: &s3.HeadObjectOutput{ETag: aws.String(etag)},
+			stored: &s3.GetObjectOutput{
+				Body: ioutil.NopCloser(bytes.NewReader([]byte("hello"))),
+				ETag: aws.String(etag),
+			},
+			header: "If-Match",
+			value:  etag,
+		},
+		{
+			name:   "creation of missing side",
+			cond:   domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}},
+			header: "If-None-Match",
+			value:  "*",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			repo, client, tearDown := setUp(t)
+			defer tearDown()
+
+			if c.head != nil {
+				client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(c.head, nil)
+			} else {
+				client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "NotFound"})
+			}
+			if c.stored != nil {
+				client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "diff/1/left"}).Return(c.stored, nil)
+			}
+			client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil).Times(2)
+			client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/1", "hallo"}, gomock.Any()).Return(&s3.PutObjectOutput{}, nil)
+			client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "diff/1/left", "hallo"}, gomock.Any()).DoAndReturn(
+				func(_ context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					if v := requestHeaders(t, optFns).Get(c.header); v != c.value {
+						t.Errorf("wrong %s header, expected: %s, got: %s", c.header, c.value, v)
+					}
+					if v := input.Metadata["digest"]; v != domain.Digest([]byte("hallo")) {
+						t.Errorf("wrong digest metadata, got: %s", v)
+					}
+					return &s3.PutObjectOutput{}, nil
+				})
+			expectUsageUpdate(client, `{"diffs":1,"bytes":5}`, `{"diffs":2,"bytes":10}`)
+
+			if err := repo.SaveDataSideIf(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{}, c.cond); err != nil {
+				t.Errorf("save operation failed, got: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestConditionalSaveOperationFailsPrecondition(t *testing.T) {
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "NotFound"})
+
+	err := repo.SaveDataSideIf(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{},
+		domain.SidePrecondition{IfMatch: []string{domain.AnyTag}})
+
+	if _, ok := err.(domain.PreconditionFailedError); !ok {
+		t.Errorf("expected precondition failure, got: %v", err)
+	}
+}
+
+func TestConditionalSaveOperationLosesRace(t *testing.T) {
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "NotFound"})
+	client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil).Times(2)
+	client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/1", "hallo"}, gomock.Any()).Return(&s3.PutObjectOutput{}, nil)
+	client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "diff/1/left", "hallo"}, gomock.Any()).
+		Return(nil, &smithy.GenericAPIError{Code: "PreconditionFailed"})
+	client.EXPECT().DeleteObject(gomock.Any(), &DeleteObjectInputMatcher{"go-diff-bucket", "history/1/left/1"}).Return(&s3.DeleteObjectOutput{}, nil)
+
+	err := repo.SaveDataSideIf(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{},
+		domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}})
+
+	if _, ok := err.(domain.PreconditionFailedError); !ok {
+		t.Errorf("expected precondition failure, got: %v", err)
+	}
+}
+
+func TestSessionOperations(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	var stored []byte
+	client.EXPECT().PutObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			if aws.ToString(input.Key) != "session/1" {
+				t.Errorf("wrong session key, got: %s", aws.ToString(input.Key))
+			}
+			stored, _ = ioutil.ReadAll(input.Body)
+			return &s3.PutObjectOutput{}, nil
+		})
+	gomock.InOrder(
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "session/1"}).DoAndReturn(
+			func(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(stored))}, nil
+			}),
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "session/2"}).Return(nil, &types.NoSuchKey{}),
+	)
+
+	created := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	// when
+	err := repo.SaveSession(context.Background(), domain.DiffSession{ID: "1", CreatedAt: created, LockWhenComplete: true})
+	if err != nil {
+		t.Fatalf("save session operation failed, got: %v", err)
+	}
+	s, err := repo.GetSession(context.Background(), "1")
+	absent, _ := repo.GetSession(context.Background(), "2")
+
+	// then
+	if err != nil || s == nil || !s.CreatedAt.Equal(created) || !s.LockWhenComplete || s.Locked() {
+		t.Errorf("wrong session, got: %+v, %v", s, err)
+	}
+	if absent != nil {
+		t.Errorf("expected no session for absent ID, got: %+v", absent)
+	}
+}
+
+func TestPingOperation(t *testing.T) {
+
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{name: "reachable"},
+		{name: "unreachable", err: errors.New("access denied")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// given
+			repo, client, tearDown := setUp(t)
+			defer tearDown()
+			client.EXPECT().HeadBucket(gomock.Any(), &s3.HeadBucketInput{Bucket: aws.String("go-diff-bucket")}).Return(&s3.HeadBucketOutput{}, c.err)
+
+			// when
+			err := repo.Ping(context.Background())
+
+			// then
+			if err != c.err {
+				t.Errorf("wrong ping result, expected: %v, got: %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestGetUsageOperation(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	stored := s3.GetObjectOutput{
+		Body: ioutil.NopCloser(strings.NewReader(`{"diffs":2,"bytes":9}`)),
+		ETag: aws.String(`"usage"`),
+	}
+	client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "usage/acme"}).Return(&stored, nil)
+
+	// when
+	usage, err := repo.GetUsage(context.Background(), domain.Tenant("acme"))
+
+	// then
+	if err != nil {
+		t.Fatalf("get usage operation failed, got: %v", err)
+	}
+	if usage != (domain.Usage{Diffs: 2, Bytes: 9}) {
+		t.Errorf("wrong usage, got: %+v", usage)
+	}
+}
+
+func TestGetUsageOperationCountsUsageNotStoredYet(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	// diffs of other tenants share the key prefix of the default tenant
+	latest := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("diff/1/left")},
+			{Key: aws.String("diff/1/right")},
+			{Key: aws.String("diff/acme/2/left")},
+		},
+	}
+	versions := s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("history/1/left/1"), Size: 2},
+			{Key: aws.String("history/1/left/2"), Size: 3},
+			{Key: aws.String("history/1/right/1"), Size: 4},
+			{Key: aws.String("history/acme/2/left/1"), Size: 100},
+		},
+	}
+	gomock.InOrder(
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "usage/_"}).Return(nil, &types.NoSuchKey{}),
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "diff/", ""}).Return(&latest, nil),
+		client.EXPECT().ListObjectsV2(gomock.Any(), &ListObjectsV2InputMatcher{"go-diff-bucket", "history/", ""}).Return(&versions, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "usage/_", `{"diffs":1,"bytes":9}`}, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				if v := requestHeaders(t, optFns).Get("If-None-Match"); v != "*" {
+					t.Errorf("counted usage should only be stored if missing, got If-None-Match: %s", v)
+				}
+				return &s3.PutObjectOutput{}, nil
+			}),
+	)
+
+	// when
+	usage, err := repo.GetUsage(context.Background(), domain.DefaultTenant)
+
+	// then
+	if err != nil {
+		t.Fatalf("get usage operation failed, got: %v", err)
+	}
+	if usage != (domain.Usage{Diffs: 1, Bytes: 9}) {
+		t.Errorf("wrong usage, got: %+v", usage)
+	}
+}
+
+func TestSaveOperationRetriesConcurrentUsageUpdates(t *testing.T) {
+
+	// given
+	repo, client, tearDown := setUp(t)
+	defer tearDown()
+
+	listing := s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: aws.String("history/1/left/1")}},
+	}
+	first := s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(`{"diffs":1,"bytes":5}`)), ETag: aws.String(`"first"`)}
+	second := s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(`{"diffs":2,"bytes":8}`)), ETag: aws.String(`"second"`)}
+	gomock.InOrder(
+		client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&listing, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "history/1/left/2", "hallo"}, gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "diff/1/left", "hallo"}).Return(&s3.PutObjectOutput{}, nil),
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "usage/_"}).Return(&first, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "usage/_", `{"diffs":1,"bytes":10}`}, gomock.Any()).
+			Return(nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}),
+		client.EXPECT().GetObject(gomock.Any(), &GetObjectInputMatcher{"go-diff-bucket", "usage/_"}).Return(&second, nil),
+		client.EXPECT().PutObject(gomock.Any(), &PutObjectInputMatcher{"go-diff-bucket", "usage/_", `{"diffs":2,"bytes":13}`}, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				if v := requestHeaders(t, optFns).Get("If-Match"); v != `"second"` {
+					t.Errorf("usage should be updated if unchanged since read, got If-Match: %s", v)
+				}
+				return &s3.PutObjectOutput{}, nil
+			}),
+	)
+
+	// when
+	err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{})
+
+	// then
+	if err != nil {
+		t.Errorf("save operation failed, got: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// storedSession is the serialized form of sessions in backends without a schema for them
+type storedSession struct {
+	ID               string    `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	LockWhenComplete bool      `json:"lock_when_complete,omitempty"`
+	LockedAt         time.Time `json:"locked_at"`
+}
+
+func encodeSession(s domain.DiffSession) []byte {
+	b, _ := json.Marshal(storedSession(s))
+	return b
+}
+
+func decodeSession(b []byte) (*domain.DiffSession, error) {
+	var s storedSession
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	session := domain.DiffSession(s)
+	return &session, nil
+}
@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+type sessionRepository interface {
+	SaveSession(ctx context.Context, session domain.DiffSession) error
+	GetSession(ctx context.Context, ID string) (*domain.DiffSession, error)
+	SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error
+	DeleteDataSidesByID(ctx context.Context, ID string) error
+}
+
+// testSessions runs the same sequence of session operations against any repository
+func testSessions(t *testing.T, repo sessionRepository) {
+	if s, err := repo.GetSession(context.Background(), "1"); err != nil || s != nil {
+		t.Fatalf("expected no session for absent ID, got: %v, %v", s, err)
+	}
+
+	created := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	session := domain.DiffSession{ID: "1", CreatedAt: created, LockWhenComplete: true}
+	if err := repo.SaveSession(context.Background(), session); err != nil {
+		t.Fatalf("save session operation failed, got: %v", err)
+	}
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+
+	session.LockedAt = created.Add(time.Minute)
+	if err := repo.SaveSession(context.Background(), session); err != nil {
+		t.Fatalf("save session operation failed, got: %v", err)
+	}
+	s, err := repo.GetSession(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get session operation failed, got: %v", err)
+	}
+	if s == nil || s.ID != "1" || !s.CreatedAt.Equal(created) || !s.LockWhenComplete || !s.LockedAt.Equal(session.LockedAt) {
+		t.Errorf("wrong session, got: %+v", s)
+	}
+
+	if err := repo.DeleteDataSidesByID(context.Background(), "1"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if s, _ := repo.GetSession(context.Background(), "1"); s != nil {
+		t.Errorf("session of deleted diff was kept, got: %+v", s)
+	}
+}
@@ -0,0 +1,549 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// SQLDialect describes the differences between the SQL engines supported by SQLDiffRepository
+type SQLDialect struct {
+	// Name identifies the dialect
+	Name string
+	// BlobType is the column type used to store side data
+	BlobType string
+	// TimestampType is the column type used to store timestamps
+	TimestampType string
+	// Placeholder returns the bind parameter for the n-th (1-based) argument of a statement
+	Placeholder func(n int) string
+	// RowLock is appended to queries reading rows that are updated later in the same transaction
+	RowLock string
+	// BinaryCollation is appended to expressions that must compare byte by byte, like IDs in listings
+	BinaryCollation string
+}
+
+// SQLite is the dialect for SQLite databases
+var SQLite = SQLDialect{
+	Name:          "sqlite",
+	BlobType:      "BLOB",
+	TimestampType: "TIMESTAMP",
+	Placeholder:   func(int) string { return "?" },
+	// SQLite locks the whole database on writes, so there are no row locks
+	RowLock: "",
+	// SQLite compares text byte by byte unless told otherwise
+	BinaryCollation: "",
+}
+
+// PostgreSQL is the dialect for PostgreSQL databases
+var PostgreSQL = SQLDialect{
+	Name:            "postgres",
+	BlobType:        "BYTEA",
+	TimestampType:   "TIMESTAMP WITH TIME ZONE",
+	Placeholder:     func(n int) string { return fmt.Sprintf("$%d", n) },
+	RowLock:         " FOR UPDATE",
+	BinaryCollation: ` COLLATE "C"`,
+}
+
+// sqlMigrations are applied in order, each one exactly once.
+// New migrations must only be appended to this list.
+var sqlMigrations = []func(d SQLDialect) string{
+	func(d SQLDialect) string {
+		return `CREATE TABLE diffs (
+			id VARCHAR(255) PRIMARY KEY,
+			created_at ` + d.TimestampType + ` NOT NULL,
+			updated_at ` + d.TimestampType + ` NOT NULL
+		)`
+	},
+	func(d SQLDialect) string {
+		return `CREATE TABLE diff_sides (
+			diff_id VARCHAR(255) NOT NULL REFERENCES diffs (id),
+			side VARCHAR(16) NOT NULL,
+			data ` + d.BlobType + ` NOT NULL,
+			size BIGINT NOT NULL,
+			digest CHAR(64) NOT NULL,
+			created_at ` + d.TimestampType + ` NOT NULL,
+			updated_at ` + d.TimestampType + ` NOT NULL,
+			PRIMARY KEY (diff_id, side)
+		)`
+	},
+	func(d SQLDialect) string {
+		return `ALTER TABLE diff_sides ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}'`
+	},
+	func(d SQLDialect) string {
+		return `CREATE TABLE diff_side_versions (
+			diff_id VARCHAR(255) NOT NULL REFERENCES diffs (id),
+			side VARCHAR(16) NOT NULL,
+			version INTEGER NOT NULL,
+			data ` + d.BlobType + ` NOT NULL,
+			size BIGINT NOT NULL,
+			digest CHAR(64) NOT NULL,
+			metadata TEXT NOT NULL,
+			created_at ` + d.TimestampType + ` NOT NULL,
+			PRIMARY KEY (diff_id, side, version)
+		)`
+	},
+	func(d SQLDialect) string {
+		// sides stored before versioning become their first version
+		return `INSERT INTO diff_side_versions (diff_id, side, version, data, size, digest, metadata, created_at)
+			SELECT diff_id, side, 1, data, size, digest, metadata, updated_at FROM diff_sides`
+	},
+	func(d SQLDialect) string {
+		// sessions are created before their diff has any side, so they do not reference diffs
+		return `CREATE TABLE diff_sessions (
+			id VARCHAR(255) PRIMARY KEY,
+			created_at ` + d.TimestampType + ` NOT NULL,
+			lock_when_complete BOOLEAN NOT NULL,
+			locked_at ` + d.TimestampType + `
+		)`
+	},
+	func(d SQLDialect) string {
+		// the usage of each tenant is counted from its stored diffs the first time it is needed
+		return `CREATE TABLE diff_usage (
+			tenant VARCHAR(64) PRIMARY KEY,
+			diffs BIGINT NOT NULL,
+			bytes BIGINT NOT NULL
+		)`
+	},
+}
+
+// SQLDiffRepository is the database/sql-backed implementation of the DiffRepository contract.
+// Sides are stored as BLOBs along with their size, SHA-256 digest and timestamps.
+// The latest version of each side lives in diff_sides and every version in diff_side_versions.
+// The usage of each tenant is kept in diff_usage, updated by the same transactions that change its diffs.
+type SQLDiffRepository struct {
+	db      *sql.DB
+	dialect SQLDialect
+	now     func() time.Time
+}
+
+// NewSQLDiffRepository creates a new instance of the SQLDiffRepository implementation.
+// Migrate must be called before the repository is used.
+func NewSQLDiffRepository(db *sql.DB, dialect SQLDialect) *SQLDiffRepository {
+	return &SQLDiffRepository{db, dialect, time.Now}
+}
+
+// Migrate brings the database schema up to date
+func (r *SQLDiffRepository) Migrate() error {
+	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("cannot create migrations table: %v", err)
+	}
+	var current int
+	err = r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("cannot read schema version: %v", err)
+	}
+	for i := current; i < len(sqlMigrations); i++ {
+		version := i + 1
+		err = r.inTx(context.Background(), func(tx *sql.Tx) error {
+			if _, err := tx.Exec(sqlMigrations[i](r.dialect)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(r.bind(`INSERT INTO schema_migrations (version) VALUES (?)`), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("cannot apply migration %d: %v", version, err)
+		}
+	}
+	return nil
+}
+
+// SaveDataSide saves a data side with its metadata as a new version and updates its diff within a single transaction.
+// The row of the side is written before its version is numbered, so concurrent saves of the same side wait
+// for the lock of the row and each one numbers its version after the previous one is committed.
+func (r *SQLDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	return r.SaveDataSideIf(ctx, ID, side, data, meta, domain.SidePrecondition{})
+}
+
+// SaveDataSideIf saves a data side like SaveDataSide if the digest of its stored row satisfies the precondition.
+// The row is locked until the transaction ends when the dialect supports it.
+func (r *SQLDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	if len(ID) == 0 {
+		return errors.New("cannot save diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot save diff side data without side")
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	now := r.now().UTC()
+	digest := domain.Digest(data)
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if !cond.IsZero() {
+			var current string
+			err := tx.QueryRowContext(ctx, r.bind(`SELECT digest FROM diff_sides WHERE diff_id = ? AND side = ?`+r.dialect.RowLock),
+				ID, side).Scan(&current)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if !cond.Allows(current) {
+				return domain.PreconditionFailedError{ID: ID, Side: side}
+			}
+		}
+		if err := r.seedUsage(ctx, tx, domain.TenantOf(ID)); err != nil {
+			return err
+		}
+		var stored int
+		err := tx.QueryRowContext(ctx, r.bind(`SELECT COUNT(*) FROM diffs WHERE id = ?`), ID).Scan(&stored)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`
+			INSERT INTO diffs (id, created_at, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at`),
+			ID, now, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`
+			INSERT INTO diff_sides (diff_id, side, data, size, digest, metadata, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (diff_id, side) DO UPDATE SET
+				data = excluded.data,
+				size = excluded.size,
+				digest = excluded.digest,
+				metadata = excluded.metadata,
+				updated_at = excluded.updated_at`),
+			ID, side, data, len(data), digest, encodeMetadata(meta), now, now)
+		if err != nil {
+			return err
+		}
+		// parameters go in VALUES rather than in a SELECT list, where PostgreSQL would type them as text
+		_, err = tx.ExecContext(ctx, r.bind(`
+			INSERT INTO diff_side_versions (diff_id, side, version, data, size, digest, metadata, created_at)
+			VALUES (?, ?, (SELECT COALESCE(MAX(version), 0) + 1 FROM diff_side_versions WHERE diff_id = ? AND side = ?),
+				?, ?, ?, ?, ?)`),
+			ID, side, ID, side, data, len(data), digest, encodeMetadata(meta), now)
+		if err != nil {
+			return err
+		}
+		return r.addUsage(ctx, tx, domain.TenantOf(ID), 1-stored, int64(len(data)))
+	})
+}
+
+// GetDataSidesByID gets all the data sides stored for an ID
+func (r *SQLDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	rows, err := r.db.QueryContext(ctx, r.bind(`SELECT side, data FROM diff_sides WHERE diff_id = ?`), ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string][]byte)
+	for rows.Next() {
+		var side string
+		var data []byte
+		if err := rows.Scan(&side, &data); err != nil {
+			return nil, err
+		}
+		m[side] = data
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetDataSidesByVersion gets the requested versions of the data sides stored for an ID
+func (r *SQLDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	for side, version := range versions {
+		var row *sql.Row
+		if version == domain.LatestVersion {
+			row = r.db.QueryRowContext(ctx, r.bind(`SELECT data FROM diff_sides WHERE diff_id = ? AND side = ?`), ID, side)
+		} else {
+			row = r.db.QueryRowContext(ctx, r.bind(`
+				SELECT data FROM diff_side_versions WHERE diff_id = ? AND side = ? AND version = ?`),
+				ID, side, version)
+		}
+		var data []byte
+		err := row.Scan(&data)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[side] = data
+	}
+	return m, nil
+}
+
+// ListVersions lists the versions stored for a side, oldest first
+func (r *SQLDiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	rows, err := r.db.QueryContext(ctx, r.bind(`
+		SELECT version, size, created_at FROM diff_side_versions
+		WHERE diff_id = ? AND side = ? ORDER BY version`), ID, side)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []domain.SideVersion
+	for rows.Next() {
+		var v domain.SideVersion
+		if err := rows.Scan(&v.Version, &v.Size, &v.UploadedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetMetadataByID gets the metadata of all the data sides stored for an ID
+func (r *SQLDiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	rows, err := r.db.QueryContext(ctx, r.bind(`SELECT side, metadata FROM diff_sides WHERE diff_id = ?`), ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string]domain.SideMetadata)
+	for rows.Next() {
+		var side, metadata string
+		if err := rows.Scan(&side, &metadata); err != nil {
+			return nil, err
+		}
+		if m[side], err = decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DeleteDataSide deletes every version of a data side, removing its diff when no sides are left
+func (r *SQLDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	if len(ID) == 0 {
+		return errors.New("cannot delete diff side data without ID")
+	}
+	if len(side) == 0 {
+		return errors.New("cannot delete diff side data without side")
+	}
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := r.seedUsage(ctx, tx, domain.TenantOf(ID)); err != nil {
+			return err
+		}
+		var size int64
+		err := tx.QueryRowContext(ctx, r.bind(`
+			SELECT COALESCE(SUM(size), 0) FROM diff_side_versions WHERE diff_id = ? AND side = ?`), ID, side).Scan(&size)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`DELETE FROM diff_side_versions WHERE diff_id = ? AND side = ?`), ID, side)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`DELETE FROM diff_sides WHERE diff_id = ? AND side = ?`), ID, side)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, r.bind(`
+			DELETE FROM diffs WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM diff_sides WHERE diff_id = ?)`), ID, ID)
+		if err != nil {
+			return err
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		return r.addUsage(ctx, tx, domain.TenantOf(ID), -int(removed), -size)
+	})
+}
+
+// DeleteDataSidesByID deletes a diff along with all its data sides, their versions and its session
+func (r *SQLDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := r.seedUsage(ctx, tx, domain.TenantOf(ID)); err != nil {
+			return err
+		}
+		var size int64
+		err := tx.QueryRowContext(ctx, r.bind(`SELECT COALESCE(SUM(size), 0) FROM diff_side_versions WHERE diff_id = ?`), ID).Scan(&size)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`DELETE FROM diff_sessions WHERE id = ?`), ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`DELETE FROM diff_side_versions WHERE diff_id = ?`), ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.bind(`DELETE FROM diff_sides WHERE diff_id = ?`), ID)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, r.bind(`DELETE FROM diffs WHERE id = ?`), ID)
+		if err != nil {
+			return err
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		return r.addUsage(ctx, tx, domain.TenantOf(ID), -int(removed), -size)
+	})
+}
+
+// ListDiffs lists a page of the diffs whose ID starts with the prefix, in ID order.
+// IDs are compared with a trailing slash, as domain.LessID does, and diffs that only hold a session are not listed.
+func (r *SQLDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	sortKey := `(d.id || '/')` + r.dialect.BinaryCollation
+	query := `
+		SELECT d.id, d.updated_at, SUM(s.size) FROM diffs d
+		JOIN diff_sides s ON s.diff_id = d.id
+		WHERE d.id LIKE ? ESCAPE '\'`
+	args := []interface{}{escapeLike(prefix) + "%"}
+	if after != "" {
+		query += ` AND ` + sortKey + ` > ?`
+		args = append(args, after+"/")
+	}
+	query += `
+		GROUP BY d.id, d.updated_at ORDER BY ` + sortKey
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := r.db.QueryContext(ctx, r.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var diffs []domain.DiffSummary
+	for rows.Next() {
+		var d domain.DiffSummary
+		if err := rows.Scan(&d.ID, &d.LastModified, &d.Size); err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, rows.Err()
+}
+
+// GetUsage gets the usage of a tenant from its counters
+func (r *SQLDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	var usage domain.Usage
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := r.seedUsage(ctx, tx, tenant); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, r.bind(`SELECT diffs, bytes FROM diff_usage WHERE tenant = ?`), string(tenant)).
+			Scan(&usage.Diffs, &usage.Bytes)
+	})
+	return usage, err
+}
+
+// seedUsage counts the usage of a tenant from its stored diffs unless it is already counted.
+// It must run before the transaction changes any diff of the tenant, so that the changes are only added once.
+func (r *SQLDiffRepository) seedUsage(ctx context.Context, tx *sql.Tx, tenant domain.Tenant) error {
+	var counted int
+	err := tx.QueryRowContext(ctx, r.bind(`SELECT COUNT(*) FROM diff_usage WHERE tenant = ?`), string(tenant)).Scan(&counted)
+	if err != nil || counted > 0 {
+		return err
+	}
+	// IDs of the default tenant have no separator, while those of other tenants start with their scope
+	owned, pattern := `NOT LIKE ?`, "%/%"
+	if tenant != domain.DefaultTenant {
+		owned, pattern = `LIKE ? ESCAPE '\'`, escapeLike(tenant.Scope(""))+"%"
+	}
+	_, err = tx.ExecContext(ctx, r.bind(`
+		INSERT INTO diff_usage (tenant, diffs, bytes) VALUES (?,
+			(SELECT COUNT(*) FROM diffs WHERE id `+owned+`),
+			(SELECT COALESCE(SUM(size), 0) FROM diff_side_versions WHERE diff_id `+owned+`))
+		ON CONFLICT (tenant) DO NOTHING`),
+		string(tenant), pattern, pattern)
+	return err
+}
+
+// addUsage adds the changes in the number of diffs and bytes of a tenant to its counters
+func (r *SQLDiffRepository) addUsage(ctx context.Context, tx *sql.Tx, tenant domain.Tenant, diffs int, bytes int64) error {
+	if diffs == 0 && bytes == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, r.bind(`UPDATE diff_usage SET diffs = diffs + ?, bytes = bytes + ? WHERE tenant = ?`),
+		diffs, bytes, string(tenant))
+	return err
+}
+
+// SaveSession creates or updates the session of a diff
+func (r *SQLDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	if len(session.ID) == 0 {
+		return errors.New("cannot save session without ID")
+	}
+	var lockedAt sql.NullTime
+	if session.Locked() {
+		lockedAt = sql.NullTime{Time: session.LockedAt.UTC(), Valid: true}
+	}
+	_, err := r.db.ExecContext(ctx, r.bind(`
+		INSERT INTO diff_sessions (id, created_at, lock_when_complete, locked_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			lock_when_complete = excluded.lock_when_complete,
+			locked_at = excluded.locked_at`),
+		session.ID, session.CreatedAt.UTC(), session.LockWhenComplete, lockedAt)
+	return err
+}
+
+// GetSession gets the session of a diff, nil if it has none
+func (r *SQLDiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	session := domain.DiffSession{ID: ID}
+	var lockedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, r.bind(`SELECT created_at, lock_when_complete, locked_at FROM diff_sessions WHERE id = ?`), ID).
+		Scan(&session.CreatedAt, &session.LockWhenComplete, &lockedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.LockedAt = lockedAt.Time
+	return &session, nil
+}
+
+// Ping checks that the database is reachable
+func (r *SQLDiffRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *SQLDiffRepository) inTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// bind rewrites "?" placeholders into the dialect-specific bind parameters
+func (r *SQLDiffRepository) bind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString(r.dialect.Placeholder(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeLike escapes the wildcards of LIKE patterns
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,117 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+	_ "github.com/lib/pq"
+)
+
+// setUpPostgres runs the SQL repository against the database of POSTGRES_TEST_DSN,
+// whose tables are dropped first, skipping the test when it is not set
+func setUpPostgres(t *testing.T) *repository.SQLDiffRepository {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("cannot open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, table := range []string{"diff_side_versions", "diff_sides", "diff_sessions", "diff_usage", "diffs", "schema_migrations"} {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			t.Fatalf("cannot drop table %s: %v", table, err)
+		}
+	}
+	repo := repository.NewSQLDiffRepository(db, repository.PostgreSQL)
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	return repo
+}
+
+func TestPostgresVersionOperations(t *testing.T) {
+	repo := setUpPostgres(t)
+
+	for _, data := range []string{"hello", "hallo", "hullo!"} {
+		if err := repo.SaveDataSide(context.Background(), "1", "left", []byte(data), domain.SideMetadata{}); err != nil {
+			t.Fatalf("save operation failed, got: %v", err)
+		}
+	}
+
+	versions, err := repo.ListVersions(context.Background(), "1", "left")
+	if err != nil {
+		t.Fatalf("list versions operation failed, got: %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 1 || versions[2].Version != 3 || versions[2].Size != 6 {
+		t.Errorf("wrong versions, got: %v", versions)
+	}
+	ds, err := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 2})
+	if err != nil {
+		t.Fatalf("get versions operation failed, got: %v", err)
+	}
+	if string(ds["left"]) != "hallo" {
+		t.Errorf("wrong versioned data sides, got: %v", ds)
+	}
+}
+
+func TestPostgresConcurrentSavesGetTheirOwnVersions(t *testing.T) {
+	repo := setUpPostgres(t)
+
+	const saves = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, saves)
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent save operation failed, got: %v", err)
+		}
+	}
+	versions, _ := repo.ListVersions(context.Background(), "1", "left")
+	if len(versions) != saves || versions[saves-1].Version != saves {
+		t.Errorf("wrong versions, got: %v", versions)
+	}
+}
+
+func TestPostgresListOperation(t *testing.T) {
+	repo := setUpPostgres(t)
+
+	for _, ID := range []string{"ci_3", "ci-2", "ci-1"} {
+		repo.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+	}
+
+	diffs, err := repo.ListDiffs(context.Background(), "ci", "ci-1", 2)
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 2 || diffs[0].ID != "ci-2" || diffs[1].ID != "ci_3" || diffs[0].Size != 5 {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+}
+
+func TestPostgresConditionalSaveOperations(t *testing.T) {
+	testConditionalSaves(t, setUpPostgres(t))
+}
+
+func TestPostgresSessionOperations(t *testing.T) {
+	testSessions(t, setUpPostgres(t))
+}
+
+func TestPostgresUsageOperations(t *testing.T) {
+	testUsage(t, setUpPostgres(t))
+}
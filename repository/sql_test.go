@@ -0,0 +1,332 @@
+//go:build cgo
+// +build cgo
+
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setUpSQL(t *testing.T) (*repository.SQLDiffRepository, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("cannot open database: %v", err)
+	}
+	// a single connection keeps the in-memory database alive across statements
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewSQLDiffRepository(db, repository.SQLite)
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	return repo, db
+}
+
+func TestSQLMigrationIsIdempotent(t *testing.T) {
+	repo, db := setUpSQL(t)
+
+	var before, after int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("second migration failed: %v", err)
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	if before == 0 || before != after {
+		t.Errorf("migrations were not applied exactly once, before: %d, after: %d", before, after)
+	}
+}
+
+func TestSQLSaveAndGetOperations(t *testing.T) {
+	repo, _ := setUpSQL(t)
+
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+	if err := repo.SaveDataSide(context.Background(), "1", "right", []byte(""), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	expected := map[string]string{"left": "hello", "right": ""}
+	if len(ds) != len(expected) {
+		t.Errorf("wrong number of results, expected: %v, got: %v", len(expected), len(ds))
+	}
+	for k, v := range ds {
+		if expected[k] != string(v) {
+			t.Errorf("wrong diff side data for side %s, expected: %s, got: %s", k, expected[k], v)
+		}
+	}
+
+	ds, err = repo.GetDataSidesByID(context.Background(), "2")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	if len(ds) != 0 {
+		t.Errorf("expected empty map for absent ID, got: %v", ds)
+	}
+}
+
+func TestSQLSaveOverwritesSideAndMetadata(t *testing.T) {
+	repo, db := setUpSQL(t)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("bye"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+
+	var data []byte
+	var size int
+	var digest string
+	row := db.QueryRow("SELECT data, size, digest FROM diff_sides WHERE diff_id = '1' AND side = 'left'")
+	if err := row.Scan(&data, &size, &digest); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "bye" {
+		t.Errorf("side was not overwritten, got: %s", data)
+	}
+	if size != 3 {
+		t.Errorf("wrong size, expected: 3, got: %d", size)
+	}
+	// sha256("bye")
+	if digest != "b49f425a7e1f9cff3856329ada223f2f9d368f15a00cf48df16ca95986137fe8" {
+		t.Errorf("wrong digest, got: %s", digest)
+	}
+}
+
+func TestSQLDeleteOperations(t *testing.T) {
+	repo, db := setUpSQL(t)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "2", "left", []byte("hello"), domain.SideMetadata{})
+
+	if err := repo.DeleteDataSide(context.Background(), "1", "left"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 1 || ds["right"] == nil {
+		t.Errorf("wrong sides after deleting one side, got: %v", ds)
+	}
+
+	if err := repo.DeleteDataSidesByID(context.Background(), "1"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if ds, _ := repo.GetDataSidesByID(context.Background(), "1"); len(ds) != 0 {
+		t.Errorf("sides not deleted, got: %v", ds)
+	}
+
+	// deleting the last side also removes the diff
+	if err := repo.DeleteDataSide(context.Background(), "2", "left"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM diffs").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("diffs left behind, got: %d", count)
+	}
+}
+
+func TestSQLListOperation(t *testing.T) {
+	repo, _ := setUpSQL(t)
+
+	for _, ID := range []string{"ci-2", "ci-1", "ci_3", "other"} {
+		repo.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+	}
+	// diffs that only hold a session are not listed
+	repo.SaveSession(context.Background(), domain.DiffSession{ID: "ci-4"})
+
+	diffs, err := repo.ListDiffs(context.Background(), "ci-", "", 0)
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 2 || diffs[0].ID != "ci-1" || diffs[1].ID != "ci-2" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+	if diffs[0].LastModified.IsZero() {
+		t.Error("missing last modification time")
+	}
+	if diffs[0].Size != 5 {
+		t.Errorf("wrong size, expected: 5, got: %d", diffs[0].Size)
+	}
+
+	// LIKE wildcards in the prefix are matched literally
+	if diffs, _ := repo.ListDiffs(context.Background(), "ci_", "", 0); len(diffs) != 1 || diffs[0].ID != "ci_3" {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+
+	if diffs, _ := repo.ListDiffs(context.Background(), "ci", "ci-1", 1); len(diffs) != 1 || diffs[0].ID != "ci-2" {
+		t.Errorf("wrong page after ci-1, got: %v", diffs)
+	}
+}
+
+func TestSQLRejectedSaveOperation(t *testing.T) {
+	repo, _ := setUpSQL(t)
+
+	cases := []struct {
+		name     string
+		ID       string
+		side     string
+		expected error
+	}{
+		{
+			name:     "empty ID",
+			side:     "left",
+			expected: errors.New("cannot save diff side data without ID"),
+		},
+		{
+			name:     "empty side",
+			ID:       "1",
+			expected: errors.New("cannot save diff side data without side"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			err := repo.SaveDataSide(context.Background(), c.ID, c.side, []byte("hello"), domain.SideMetadata{})
+
+			if err == nil {
+				t.Fatal("accepted invalid input")
+			}
+			if reflect.TypeOf(err) != reflect.TypeOf(c.expected) {
+				t.Errorf("wrong error type, expected: %T, got: %T", c.expected, err)
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+
+		})
+
+	}
+
+}
+
+func TestSQLMetadataOperations(t *testing.T) {
+	repo, _ := setUpSQL(t)
+
+	meta := domain.SideMetadata{
+		Filename:    "left.txt",
+		ContentType: "text/plain",
+		Labels:      map[string]string{"pipeline": "ci"},
+		Uploader:    "gopher",
+		UploadedAt:  time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), meta)
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("hallo"), domain.SideMetadata{})
+
+	m, err := repo.GetMetadataByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get metadata operation failed, got: %v", err)
+	}
+	if len(m) != 2 || !reflect.DeepEqual(m["left"], meta) {
+		t.Errorf("wrong metadata, got: %v", m)
+	}
+	if m, _ := repo.GetMetadataByID(context.Background(), "2"); len(m) != 0 {
+		t.Errorf("expected empty map for absent ID, got: %v", m)
+	}
+}
+
+func TestSQLVersionOperations(t *testing.T) {
+	repo, _ := setUpSQL(t)
+
+	for _, data := range []string{"hello", "hallo", "hullo!"} {
+		if err := repo.SaveDataSide(context.Background(), "1", "left", []byte(data), domain.SideMetadata{}); err != nil {
+			t.Fatalf("save operation failed, got: %v", err)
+		}
+	}
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("world"), domain.SideMetadata{})
+
+	versions, err := repo.ListVersions(context.Background(), "1", "left")
+	if err != nil {
+		t.Fatalf("list versions operation failed, got: %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 1 || versions[2].Version != 3 || versions[2].Size != 6 {
+		t.Errorf("wrong versions, got: %v", versions)
+	}
+
+	ds, err := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 2, "right": domain.LatestVersion})
+	if err != nil {
+		t.Fatalf("get versions operation failed, got: %v", err)
+	}
+	if string(ds["left"]) != "hallo" || string(ds["right"]) != "world" {
+		t.Errorf("wrong versioned data sides, got: %v", ds)
+	}
+	if ds, _ := repo.GetDataSidesByVersion(context.Background(), "1", map[string]int{"left": 4}); len(ds) != 0 {
+		t.Errorf("expected empty map for absent version, got: %v", ds)
+	}
+
+	if err := repo.DeleteDataSidesByID(context.Background(), "1"); err != nil {
+		t.Fatalf("delete operation failed, got: %v", err)
+	}
+	if versions, _ := repo.ListVersions(context.Background(), "1", "left"); len(versions) != 0 {
+		t.Errorf("versions of deleted diff were kept, got: %v", versions)
+	}
+}
+
+func TestSQLConditionalSaveOperations(t *testing.T) {
+	repo, _ := setUpSQL(t)
+	testConditionalSaves(t, repo)
+
+	if versions, _ := repo.ListVersions(context.Background(), "1", "left"); len(versions) != 2 {
+		t.Errorf("failed saves created versions, got: %v", versions)
+	}
+}
+
+func TestSQLSessionOperations(t *testing.T) {
+	repo, _ := setUpSQL(t)
+	testSessions(t, repo)
+}
+
+func TestSQLUsageOperations(t *testing.T) {
+	repo, _ := setUpSQL(t)
+	testUsage(t, repo)
+}
+
+func TestSQLUsageCountsDiffsStoredBeforeIt(t *testing.T) {
+	repo, db := setUpSQL(t)
+
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "acme_co/1", "left", []byte("other tenant"), domain.SideMetadata{})
+	repo.SaveDataSide(context.Background(), "acmexco/1", "left", []byte("other tenant"), domain.SideMetadata{})
+	if _, err := db.Exec("DELETE FROM diff_usage"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo.SaveDataSide(context.Background(), "1", "right", []byte("abc"), domain.SideMetadata{})
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 13})
+	expectUsage(t, repo, domain.Tenant("acme_co"), domain.Usage{Diffs: 1, Bytes: 12})
+}
+
+func TestSQLPing(t *testing.T) {
+	repo, db := setUpSQL(t)
+
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Errorf("ping failed, got: %v", err)
+	}
+
+	db.Close()
+	if err := repo.Ping(context.Background()); err == nil {
+		t.Error("ping of closed database should have failed but it did not")
+	}
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/service"
+)
+
+// TenantDiffRepository is a DiffRepository decorator that confines a tenant to its own diffs.
+// IDs are scoped to the tenant before reaching the backend, so the diffs of other tenants
+// cannot be read, listed nor deleted through it.
+type TenantDiffRepository struct {
+	tenant  domain.Tenant
+	backend service.DiffRepository
+}
+
+// NewTenantDiffRepository creates a new instance of the TenantDiffRepository decorator
+func NewTenantDiffRepository(tenant domain.Tenant, backend service.DiffRepository) *TenantDiffRepository {
+	return &TenantDiffRepository{tenant, backend}
+}
+
+// SaveDataSide saves a data side of a diff of the tenant
+func (r *TenantDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	return r.backend.SaveDataSide(ctx, r.scope(ID), side, data, meta)
+}
+
+// SaveDataSideIf saves a data side of a diff of the tenant if the stored side satisfies the precondition
+func (r *TenantDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	err := r.backend.SaveDataSideIf(ctx, r.scope(ID), side, data, meta, cond)
+	if errors.Is(err, domain.CodePreconditionFailed) {
+		return domain.PreconditionFailedError{ID: ID, Side: side}
+	}
+	return err
+}
+
+// GetDataSidesByID gets the data sides of a diff of the tenant
+func (r *TenantDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	return r.backend.GetDataSidesByID(ctx, r.scope(ID))
+}
+
+// GetDataSidesByVersion gets versioned data sides of a diff of the tenant
+func (r *TenantDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	return r.backend.GetDataSidesByVersion(ctx, r.scope(ID), versions)
+}
+
+// ListVersions lists the versions of a side of a diff of the tenant
+func (r *TenantDiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	return r.backend.ListVersions(ctx, r.scope(ID), side)
+}
+
+// GetMetadataByID gets the side metadata of a diff of the tenant
+func (r *TenantDiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	return r.backend.GetMetadataByID(ctx, r.scope(ID))
+}
+
+// DeleteDataSide deletes a data side of a diff of the tenant
+func (r *TenantDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	return r.backend.DeleteDataSide(ctx, r.scope(ID), side)
+}
+
+// DeleteDataSidesByID deletes all data sides of a diff of the tenant
+func (r *TenantDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	return r.backend.DeleteDataSidesByID(ctx, r.scope(ID))
+}
+
+// ListDiffs lists a page of the diffs of the tenant whose ID starts with the prefix.
+// Diffs of other tenants sharing the storage prefix are left out,
+// so pages of the backend are listed until the page of the tenant is full.
+// Scoping keeps the order of IDs, since every scoped ID shares the scope of the tenant.
+func (r *TenantDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	after = r.scope(after)
+	var owned []domain.DiffSummary
+	for {
+		diffs, err := r.backend.ListDiffs(ctx, r.tenant.Scope(prefix), after, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range diffs {
+			if ID, ok := r.tenant.Unscope(d.ID); ok {
+				d.ID = ID
+				owned = append(owned, d)
+			}
+		}
+		if limit == 0 || len(diffs) < limit || len(owned) >= limit {
+			break
+		}
+		after = diffs[len(diffs)-1].ID
+	}
+	if limit > 0 && len(owned) > limit {
+		owned = owned[:limit]
+	}
+	return owned, nil
+}
+
+// GetUsage gets the usage of the diffs of the tenant.
+// Callers only see the diffs of the tenant, which belong to the default tenant from their point of view.
+func (r *TenantDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	if tenant != domain.DefaultTenant {
+		return domain.Usage{}, nil
+	}
+	return r.backend.GetUsage(ctx, r.tenant)
+}
+
+// SaveSession saves the session of a diff of the tenant
+func (r *TenantDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	if len(session.ID) > 0 {
+		session.ID = r.scope(session.ID)
+	}
+	return r.backend.SaveSession(ctx, session)
+}
+
+// GetSession gets the session of a diff of the tenant, nil if it has none
+func (r *TenantDiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	session, err := r.backend.GetSession(ctx, r.scope(ID))
+	if session != nil {
+		session.ID = ID
+	}
+	return session, err
+}
+
+// Ping checks that the backend shared by all tenants is reachable
+func (r *TenantDiffRepository) Ping(ctx context.Context) error {
+	return r.backend.Ping(ctx)
+}
+
+// scope returns the storage ID, leaving empty IDs for the backend to reject
+func (r *TenantDiffRepository) scope(ID string) string {
+	if len(ID) == 0 {
+		return ID
+	}
+	return r.tenant.Scope(ID)
+}
@@ -0,0 +1,116 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+)
+
+func TestTenantsAreIsolated(t *testing.T) {
+	backend := repository.NewMemoryDiffRepository(0, 0)
+	acme := repository.NewTenantDiffRepository(domain.Tenant("acme"), backend)
+	other := repository.NewTenantDiffRepository(domain.Tenant("other"), backend)
+	defaults := repository.NewTenantDiffRepository(domain.DefaultTenant, backend)
+
+	acme.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	other.SaveDataSide(context.Background(), "1", "left", []byte("hallo"), domain.SideMetadata{})
+	defaults.SaveDataSide(context.Background(), "2", "left", []byte("hullo"), domain.SideMetadata{})
+
+	if ds, _ := acme.GetDataSidesByID(context.Background(), "1"); string(ds["left"]) != "hello" {
+		t.Errorf("wrong data for own diff, got: %s", ds["left"])
+	}
+	if ds, _ := acme.GetDataSidesByID(context.Background(), "2"); len(ds) != 0 {
+		t.Errorf("read diff of another tenant, got: %v", ds)
+	}
+
+	cases := []struct {
+		name     string
+		repo     *repository.TenantDiffRepository
+		expected string
+	}{
+		{name: "acme", repo: acme, expected: "1"},
+		{name: "other", repo: other, expected: "1"},
+		{name: "default", repo: defaults, expected: "2"},
+	}
+	for _, c := range cases {
+		diffs, err := c.repo.ListDiffs(context.Background(), "", "", 0)
+		if err != nil {
+			t.Fatalf("list operation failed, got: %v", err)
+		}
+		if len(diffs) != 1 || diffs[0].ID != c.expected {
+			t.Errorf("%s: wrong diffs, got: %v", c.name, diffs)
+		}
+	}
+
+	other.DeleteDataSidesByID(context.Background(), "1")
+	if ds, _ := acme.GetDataSidesByID(context.Background(), "1"); len(ds) != 1 {
+		t.Error("deleted diff of another tenant")
+	}
+	if ds, _ := backend.GetDataSidesByID(context.Background(), "acme/1"); len(ds) != 1 {
+		t.Error("diff not stored under the tenant namespace")
+	}
+}
+
+func TestTenantListsFullPages(t *testing.T) {
+	backend := repository.NewMemoryDiffRepository(0, 0)
+	acme := repository.NewTenantDiffRepository(domain.Tenant("acme"), backend)
+	defaults := repository.NewTenantDiffRepository(domain.DefaultTenant, backend)
+
+	// diffs of acme sort before those of the default tenant in the backend
+	for _, ID := range []string{"1", "2"} {
+		acme.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+	}
+	for _, ID := range []string{"x", "y"} {
+		defaults.SaveDataSide(context.Background(), ID, "left", []byte("hello"), domain.SideMetadata{})
+	}
+
+	if diffs, _ := defaults.ListDiffs(context.Background(), "", "", 1); len(diffs) != 1 || diffs[0].ID != "x" {
+		t.Errorf("wrong first page, got: %v", diffs)
+	}
+	if diffs, _ := defaults.ListDiffs(context.Background(), "", "x", 1); len(diffs) != 1 || diffs[0].ID != "y" {
+		t.Errorf("wrong page after x, got: %v", diffs)
+	}
+	if diffs, _ := acme.ListDiffs(context.Background(), "", "1", 1); len(diffs) != 1 || diffs[0].ID != "2" {
+		t.Errorf("wrong page of acme after 1, got: %v", diffs)
+	}
+}
+
+func TestTenantReportsItsOwnUsage(t *testing.T) {
+	backend := repository.NewMemoryDiffRepository(0, 0)
+	acme := repository.NewTenantDiffRepository(domain.Tenant("acme"), backend)
+	defaults := repository.NewTenantDiffRepository(domain.DefaultTenant, backend)
+
+	acme.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	defaults.SaveDataSide(context.Background(), "1", "left", []byte("hi"), domain.SideMetadata{})
+
+	expectUsage(t, acme, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 5})
+	expectUsage(t, defaults, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 2})
+	expectUsage(t, acme, domain.Tenant("acme"), domain.Usage{})
+}
+
+func TestTenantScopesSessions(t *testing.T) {
+	backend := repository.NewMemoryDiffRepository(0, 0)
+	acme := repository.NewTenantDiffRepository(domain.Tenant("acme"), backend)
+
+	if err := acme.SaveSession(context.Background(), domain.DiffSession{ID: "1"}); err != nil {
+		t.Fatalf("save session operation failed, got: %v", err)
+	}
+	if s, _ := acme.GetSession(context.Background(), "1"); s == nil || s.ID != "1" {
+		t.Errorf("wrong session, got: %+v", s)
+	}
+	if s, _ := backend.GetSession(context.Background(), "1"); s != nil {
+		t.Errorf("session not stored under the tenant namespace, got: %+v", s)
+	}
+}
+
+func TestTenantPreconditionFailureKeepsID(t *testing.T) {
+	acme := repository.NewTenantDiffRepository(domain.Tenant("acme"), repository.NewMemoryDiffRepository(0, 0))
+
+	cond := domain.SidePrecondition{IfMatch: []string{domain.Digest([]byte("hello"))}}
+	err := acme.SaveDataSideIf(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}, cond)
+	if err != (domain.PreconditionFailedError{ID: "1", Side: "left"}) {
+		t.Errorf("wrong error, got: %v", err)
+	}
+}
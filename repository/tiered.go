@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/service"
+)
+
+// TieredDiffRepository is a DiffRepository decorator that puts a cache tier in front of a backend.
+// Writes go through to the backend and then to the cache, reads hit the cache first when it holds the whole diff,
+// and misses populate it with the latest version of both sides as read from the backend.
+// The cache also holds a generation for each diff, renewed by every write before it reaches the cache,
+// so that a read populating the cache with sides it read before a write removes them again.
+// Concurrent writes of a side may reach both tiers in different orders and a diff dropped by the cache
+// loses its generation, so caches should still expire their entries.
+type TieredDiffRepository struct {
+	cache   service.DiffRepository
+	backend service.DiffRepository
+}
+
+// generationSide is the cache side that holds the generation of a diff
+const generationSide = "generation"
+
+// NewTieredDiffRepository creates a new instance of the TieredDiffRepository decorator
+func NewTieredDiffRepository(cache, backend service.DiffRepository) *TieredDiffRepository {
+	return &TieredDiffRepository{cache, backend}
+}
+
+// SaveDataSide saves data sides to the backend and then to the cache
+func (r *TieredDiffRepository) SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	if err := r.backend.SaveDataSide(ctx, ID, side, data, meta); err != nil {
+		return err
+	}
+	return r.writeThrough(ctx, ID, func() error {
+		return r.replace(ctx, ID, side, data, meta)
+	})
+}
+
+// SaveDataSideIf saves data sides to the backend if they satisfy the precondition, and then to the cache.
+// The cache may be stale, so only the backend is checked against the precondition.
+func (r *TieredDiffRepository) SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error {
+	if err := r.backend.SaveDataSideIf(ctx, ID, side, data, meta, cond); err != nil {
+		return err
+	}
+	return r.writeThrough(ctx, ID, func() error {
+		return r.replace(ctx, ID, side, data, meta)
+	})
+}
+
+// writeThrough renews the generation of a diff and then applies a write to the cache.
+// A diff that cannot be written to the cache is invalidated instead,
+// and a failure to do so is reported so that clients retry instead of reading stale data.
+func (r *TieredDiffRepository) writeThrough(ctx context.Context, ID string, write func() error) error {
+	generation, err := newGeneration()
+	if err == nil {
+		err = r.replace(ctx, ID, generationSide, generation, domain.SideMetadata{})
+	}
+	if err == nil {
+		err = write()
+	}
+	if err == nil {
+		return nil
+	}
+	if err := r.invalidate(ctx, ID); err != nil {
+		return fmt.Errorf("cannot invalidate cache: %v", err)
+	}
+	return nil
+}
+
+// replace saves a side to the cache in place of its previous versions, so that the cache holds a single version of each side
+func (r *TieredDiffRepository) replace(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error {
+	if err := r.cache.DeleteDataSide(ctx, ID, side); err != nil {
+		return err
+	}
+	return r.cache.SaveDataSide(ctx, ID, side, data, meta)
+}
+
+// invalidate removes both sides of a diff from the cache, keeping its generation
+func (r *TieredDiffRepository) invalidate(ctx context.Context, ID string) error {
+	for _, side := range []string{"left", "right"} {
+		if err := r.cache.DeleteDataSide(ctx, ID, side); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newGeneration creates a random generation for a diff
+func newGeneration() ([]byte, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%x", b)), nil
+}
+
+// GetDataSidesByID gets data sides from the cache when it holds the whole diff,
+// falling back to the backend on misses or cache failures and caching whole diffs read from it
+func (r *TieredDiffRepository) GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error) {
+	cached, err := r.cache.GetDataSidesByID(ctx, ID)
+	if err == nil && isWhole(cached) {
+		delete(cached, generationSide)
+		return cached, nil
+	}
+	m, err := r.backend.GetDataSidesByID(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && isWhole(m) {
+		r.populate(ctx, ID, m, cached[generationSide])
+	}
+	return m, nil
+}
+
+// populate caches a whole diff, as a best effort since the backend remains the source of truth.
+// The generation of the diff must still be the one read from the cache before the backend, otherwise a write
+// may have gone through meanwhile, so the diff is invalidated, as it is when it cannot be completed,
+// and stale or partial diffs are never read from the cache.
+func (r *TieredDiffRepository) populate(ctx context.Context, ID string, m map[string][]byte, generation []byte) {
+	for _, side := range []string{"left", "right"} {
+		if r.replace(ctx, ID, side, m[side], domain.SideMetadata{}) != nil {
+			r.invalidate(ctx, ID)
+			return
+		}
+	}
+	current, err := r.cache.GetDataSidesByVersion(ctx, ID, map[string]int{generationSide: domain.LatestVersion})
+	if err != nil || !bytes.Equal(current[generationSide], generation) {
+		r.invalidate(ctx, ID)
+	}
+}
+
+// isWhole tells whether data sides hold both sides of a diff
+func isWhole(m map[string][]byte) bool {
+	_, left := m["left"]
+	_, right := m["right"]
+	return left && right
+}
+
+// SaveSession saves the session of a diff to the backend only, since it is read from there
+func (r *TieredDiffRepository) SaveSession(ctx context.Context, session domain.DiffSession) error {
+	return r.backend.SaveSession(ctx, session)
+}
+
+// GetSession gets the session of a diff from the backend, so that lock states are never stale
+func (r *TieredDiffRepository) GetSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	return r.backend.GetSession(ctx, ID)
+}
+
+// Ping checks that both tiers are reachable, since writes fail when the cache is not
+func (r *TieredDiffRepository) Ping(ctx context.Context) error {
+	if err := r.backend.Ping(ctx); err != nil {
+		return err
+	}
+	if err := r.cache.Ping(ctx); err != nil {
+		return fmt.Errorf("cannot reach cache: %v", err)
+	}
+	return nil
+}
+
+// GetDataSidesByVersion gets versioned data sides from the backend, since the cache only holds the latest versions
+func (r *TieredDiffRepository) GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error) {
+	return r.backend.GetDataSidesByVersion(ctx, ID, versions)
+}
+
+// ListVersions lists the versions of a side from the backend
+func (r *TieredDiffRepository) ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error) {
+	return r.backend.ListVersions(ctx, ID, side)
+}
+
+// GetMetadataByID gets side metadata from the backend, since cached diffs do not carry metadata
+func (r *TieredDiffRepository) GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error) {
+	return r.backend.GetMetadataByID(ctx, ID)
+}
+
+// DeleteDataSide deletes a data side from the backend and then from the cache
+func (r *TieredDiffRepository) DeleteDataSide(ctx context.Context, ID string, side string) error {
+	if err := r.backend.DeleteDataSide(ctx, ID, side); err != nil {
+		return err
+	}
+	return r.writeThrough(ctx, ID, func() error {
+		return r.cache.DeleteDataSide(ctx, ID, side)
+	})
+}
+
+// DeleteDataSidesByID deletes all data sides of an ID from the backend and then from the cache, keeping its generation
+func (r *TieredDiffRepository) DeleteDataSidesByID(ctx context.Context, ID string) error {
+	if err := r.backend.DeleteDataSidesByID(ctx, ID); err != nil {
+		return err
+	}
+	return r.writeThrough(ctx, ID, func() error {
+		return r.invalidate(ctx, ID)
+	})
+}
+
+// ListDiffs lists diffs from the backend, since the cache only holds a subset of them
+func (r *TieredDiffRepository) ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	return r.backend.ListDiffs(ctx, prefix, after, limit)
+}
+
+// GetUsage gets the usage of a tenant from the backend, since the cache only holds a subset of its diffs
+func (r *TieredDiffRepository) GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error) {
+	return r.backend.GetUsage(ctx, tenant)
+}
@@ -0,0 +1,391 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/repository"
+	"github.com/ehpalumbo/go-diff/service/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+func setUpTiered(t *testing.T) (*repository.TieredDiffRepository, *mocks.MockDiffRepository, *mocks.MockDiffRepository) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+	cache := mocks.NewMockDiffRepository(ctrl)
+	backend := mocks.NewMockDiffRepository(ctrl)
+	return repository.NewTieredDiffRepository(cache, backend), cache, backend
+}
+
+func TestTieredWritesGoThroughToBothTiers(t *testing.T) {
+	backend := mocks.NewMockDiffRepository(gomock.NewController(t))
+	cache := repository.NewMemoryDiffRepository(0, 0)
+	repo := repository.NewTieredDiffRepository(cache, backend)
+	ctx := context.Background()
+
+	backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", gomock.Any(), domain.SideMetadata{}).Return(nil).Times(2)
+
+	for _, data := range []string{"hello", "hallo"} {
+		if err := repo.SaveDataSide(ctx, "1", "left", []byte(data), domain.SideMetadata{}); err != nil {
+			t.Fatalf("save operation failed, got: %v", err)
+		}
+	}
+	if ds, _ := cache.GetDataSidesByID(ctx, "1"); string(ds["left"]) != "hallo" || len(ds["generation"]) == 0 {
+		t.Errorf("wrong cached data, got: %v", ds)
+	}
+	// the cache holds a single version of each side
+	if versions, _ := cache.ListVersions(ctx, "1", "left"); len(versions) != 1 {
+		t.Errorf("cache should hold a single version, got: %v", versions)
+	}
+}
+
+func TestTieredDoesNotCacheFailedWrites(t *testing.T) {
+	repo, _, backend := setUpTiered(t)
+
+	backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(errors.New("Oops!"))
+
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}); err == nil {
+		t.Error("should have failed but it did not")
+	}
+}
+
+func TestTieredInvalidatesCacheWhenWriteThroughFails(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	gomock.InOrder(
+		backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(nil),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "generation").Return(nil),
+		cache.EXPECT().SaveDataSide(gomock.Any(), "1", "generation", gomock.Any(), domain.SideMetadata{}).Return(nil),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "left").Return(nil),
+		cache.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(errors.New("Oops!")),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "left").Return(nil),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "right").Return(nil),
+	)
+
+	if err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}); err != nil {
+		t.Errorf("save operation failed, got: %v", err)
+	}
+}
+
+func TestTieredReportsCacheInvalidationFailure(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(nil)
+	cache.EXPECT().DeleteDataSide(gomock.Any(), "1", gomock.Any()).Return(errors.New("Oops!")).Times(2)
+
+	err := repo.SaveDataSide(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{})
+	if err == nil || err.Error() != "cannot invalidate cache: Oops!" {
+		t.Errorf("wrong error, got: %v", err)
+	}
+}
+
+func TestTieredReadsHitCacheFirst(t *testing.T) {
+	repo, cache, _ := setUpTiered(t)
+
+	cache.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{
+		"left":       []byte("hello"),
+		"right":      []byte("hallo"),
+		"generation": []byte("1"),
+	}, nil)
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	if len(ds) != 2 || string(ds["left"]) != "hello" || string(ds["right"]) != "hallo" {
+		t.Errorf("wrong data, got: %v", ds)
+	}
+}
+
+func TestTieredReadsWholeDiffsAfterWritingSingleSides(t *testing.T) {
+	backend := repository.NewMemoryDiffRepository(0, 0)
+	cache := repository.NewMemoryDiffRepository(0, 0)
+	repo := repository.NewTieredDiffRepository(cache, backend)
+	ctx := context.Background()
+
+	// the left side is stored before the cache is in place, and read once both sides are stored
+	backend.SaveDataSide(ctx, "1", "left", []byte("hello"), domain.SideMetadata{})
+	if err := repo.SaveDataSide(ctx, "1", "right", []byte("hallo"), domain.SideMetadata{}); err != nil {
+		t.Fatalf("save operation failed, got: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		ds, err := repo.GetDataSidesByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("get operation failed, got: %v", err)
+		}
+		if string(ds["left"]) != "hello" || string(ds["right"]) != "hallo" {
+			t.Errorf("wrong data, got: %v", ds)
+		}
+	}
+}
+
+func TestTieredTreatsPartialCacheEntriesAsMisses(t *testing.T) {
+	backend := mocks.NewMockDiffRepository(gomock.NewController(t))
+	cache := repository.NewMemoryDiffRepository(0, 0)
+	repo := repository.NewTieredDiffRepository(cache, backend)
+	ctx := context.Background()
+
+	cache.SaveDataSide(ctx, "1", "right", []byte("stale"), domain.SideMetadata{})
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{
+		"left":  []byte("hello"),
+		"right": []byte("hallo"),
+	}, nil).Times(1)
+
+	for i := 0; i < 2; i++ {
+		ds, err := repo.GetDataSidesByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("get operation failed, got: %v", err)
+		}
+		if string(ds["left"]) != "hello" || string(ds["right"]) != "hallo" {
+			t.Errorf("wrong data, got: %v", ds)
+		}
+	}
+	// the partial entry is replaced rather than added to
+	if versions, _ := cache.ListVersions(ctx, "1", "right"); len(versions) != 1 {
+		t.Errorf("cache should hold a single version, got: %v", versions)
+	}
+}
+
+func TestTieredDoesNotCacheIncompleteDiffs(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	cache.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(nil, nil)
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{"left": []byte("hello")}, nil)
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil || string(ds["left"]) != "hello" {
+		t.Errorf("wrong data, got: %v, %v", ds, err)
+	}
+}
+
+func TestTieredRemovesCacheEntriesThatCannotBeCompleted(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	whole := map[string][]byte{"left": []byte("hello"), "right": []byte("hallo")}
+	cache.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{}, nil)
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(whole, nil)
+	gomock.InOrder(
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "left").Return(nil),
+		cache.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}).Return(nil),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "right").Return(nil),
+		cache.EXPECT().SaveDataSide(gomock.Any(), "1", "right", []byte("hallo"), domain.SideMetadata{}).Return(errors.New("Oops!")),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "left").Return(nil),
+		cache.EXPECT().DeleteDataSide(gomock.Any(), "1", "right").Return(nil),
+	)
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil || len(ds) != 2 {
+		t.Errorf("cache failures should not fail reads, got: %v, %v", ds, err)
+	}
+}
+
+func TestTieredMissPopulatesCache(t *testing.T) {
+	backend := mocks.NewMockDiffRepository(gomock.NewController(t))
+	// a real cache tier checks that the next read is served from it
+	repo := repository.NewTieredDiffRepository(repository.NewMemoryDiffRepository(0, 0), backend)
+
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{
+		"left":  []byte("hello"),
+		"right": []byte("hallo"),
+	}, nil).Times(1)
+
+	for i := 0; i < 2; i++ {
+		ds, err := repo.GetDataSidesByID(context.Background(), "1")
+		if err != nil {
+			t.Fatalf("get operation failed, got: %v", err)
+		}
+		if string(ds["left"]) != "hello" || string(ds["right"]) != "hallo" {
+			t.Errorf("wrong data, got: %v", ds)
+		}
+	}
+}
+
+func TestTieredFallsBackToBackendOnCacheFailure(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	cache.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(nil, errors.New("Oops!"))
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{"left": []byte("hello"), "right": []byte("hallo")}, nil)
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get operation failed, got: %v", err)
+	}
+	if string(ds["left"]) != "hello" {
+		t.Errorf("wrong data, got: %v", ds)
+	}
+}
+
+func TestTieredPropagatesBackendFailure(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	cache.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{}, nil)
+	backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(nil, errors.New("Oops!"))
+
+	ds, err := repo.GetDataSidesByID(context.Background(), "1")
+	if err == nil {
+		t.Fatal("should have failed but it did not")
+	}
+	if ds != nil {
+		t.Errorf("failed but returned non-nil map, got: %v", ds)
+	}
+}
+
+func TestTieredDeletesFromBothTiers(t *testing.T) {
+	backend := repository.NewMemoryDiffRepository(0, 0)
+	cache := repository.NewMemoryDiffRepository(0, 0)
+	repo := repository.NewTieredDiffRepository(cache, backend)
+	ctx := context.Background()
+
+	repo.SaveDataSide(ctx, "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(ctx, "1", "right", []byte("hallo"), domain.SideMetadata{})
+
+	if err := repo.DeleteDataSide(ctx, "1", "left"); err != nil {
+		t.Errorf("delete operation failed, got: %v", err)
+	}
+	if ds, _ := cache.GetDataSidesByID(ctx, "1"); ds["left"] != nil || string(ds["right"]) != "hallo" {
+		t.Errorf("wrong cached data, got: %v", ds)
+	}
+	if err := repo.DeleteDataSidesByID(ctx, "1"); err != nil {
+		t.Errorf("delete operation failed, got: %v", err)
+	}
+	if ds, _ := cache.GetDataSidesByID(ctx, "1"); ds["left"] != nil || ds["right"] != nil {
+		t.Errorf("wrong cached data, got: %v", ds)
+	}
+	if ds, _ := backend.GetDataSidesByID(ctx, "1"); len(ds) != 0 {
+		t.Errorf("wrong stored data, got: %v", ds)
+	}
+}
+
+func TestTieredDoesNotCacheSidesReadBeforeAWrite(t *testing.T) {
+	ctx := context.Background()
+	for name, write := range map[string]func(*repository.TieredDiffRepository) error{
+		"save": func(repo *repository.TieredDiffRepository) error {
+			return repo.SaveDataSide(ctx, "1", "left", []byte("hullo"), domain.SideMetadata{})
+		},
+		"delete": func(repo *repository.TieredDiffRepository) error {
+			return repo.DeleteDataSide(ctx, "1", "left")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// given
+			backend := mocks.NewMockDiffRepository(gomock.NewController(t))
+			cache := repository.NewMemoryDiffRepository(0, 0)
+			repo := repository.NewTieredDiffRepository(cache, backend)
+			backend.EXPECT().SaveDataSide(gomock.Any(), "1", "left", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			backend.EXPECT().DeleteDataSide(gomock.Any(), "1", "left").Return(nil).AnyTimes()
+
+			// when the write goes through while the sides read before it are being cached
+			backend.EXPECT().GetDataSidesByID(gomock.Any(), "1").DoAndReturn(func(context.Context, string) (map[string][]byte, error) {
+				if err := write(repo); err != nil {
+					t.Fatalf("write operation failed, got: %v", err)
+				}
+				return map[string][]byte{"left": []byte("hello"), "right": []byte("hallo")}, nil
+			})
+			repo.GetDataSidesByID(ctx, "1")
+
+			// then
+			if ds, _ := cache.GetDataSidesByID(ctx, "1"); string(ds["left"]) == "hello" {
+				t.Errorf("stale data sides were cached, got: %v", ds)
+			}
+		})
+	}
+}
+
+func TestTieredKeepsCacheWhenBackendDeleteFails(t *testing.T) {
+	repo, _, backend := setUpTiered(t)
+
+	backend.EXPECT().DeleteDataSidesByID(gomock.Any(), "1").Return(errors.New("Oops!"))
+
+	if err := repo.DeleteDataSidesByID(context.Background(), "1"); err == nil {
+		t.Error("should have failed but it did not")
+	}
+}
+
+func TestTieredListsFromBackend(t *testing.T) {
+	repo, _, backend := setUpTiered(t)
+
+	backend.EXPECT().ListDiffs(gomock.Any(), "ci-", "ci-0", 10).Return([]domain.DiffSummary{{ID: "ci-1"}}, nil)
+
+	diffs, err := repo.ListDiffs(context.Background(), "ci-", "ci-0", 10)
+	if err != nil {
+		t.Fatalf("list operation failed, got: %v", err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("wrong diffs, got: %v", diffs)
+	}
+}
+
+func TestTieredGetsMetadataFromBackend(t *testing.T) {
+	repo, _, backend := setUpTiered(t)
+
+	backend.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(map[string]domain.SideMetadata{"left": {Filename: "left.txt"}}, nil)
+
+	m, err := repo.GetMetadataByID(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("get metadata operation failed, got: %v", err)
+	}
+	if m["left"].Filename != "left.txt" {
+		t.Errorf("wrong metadata, got: %v", m)
+	}
+}
+
+func TestTieredGetsVersionsFromBackend(t *testing.T) {
+	repo, _, backend := setUpTiered(t)
+
+	versions := map[string]int{"left": 1, "right": 2}
+	backend.EXPECT().GetDataSidesByVersion(gomock.Any(), "1", versions).Return(map[string][]byte{"left": []byte("hello")}, nil)
+	backend.EXPECT().ListVersions(gomock.Any(), "1", "left").Return([]domain.SideVersion{{Version: 1}}, nil)
+
+	if m, err := repo.GetDataSidesByVersion(context.Background(), "1", versions); err != nil || string(m["left"]) != "hello" {
+		t.Errorf("wrong versioned data sides, got: %v, %v", m, err)
+	}
+	if v, err := repo.ListVersions(context.Background(), "1", "left"); err != nil || len(v) != 1 {
+		t.Errorf("wrong versions, got: %v, %v", v, err)
+	}
+}
+
+func TestTieredChecksPreconditionOnBackend(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	cond := domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}}
+	backend.EXPECT().SaveDataSideIf(gomock.Any(), "1", "left", []byte("hello"), domain.SideMetadata{}, cond).Return(nil)
+	cache.EXPECT().DeleteDataSide(gomock.Any(), "1", gomock.Any()).Return(nil).Times(2)
+	cache.EXPECT().SaveDataSide(gomock.Any(), "1", gomock.Any(), gomock.Any(), domain.SideMetadata{}).Return(nil).Times(2)
+	backend.EXPECT().SaveDataSideIf(gomock.Any(), "1", "right", []byte("hello"), domain.SideMetadata{}, cond).
+		Return(domain.PreconditionFailedError{ID: "1", Side: "right"})
+
+	if err := repo.SaveDataSideIf(context.Background(), "1", "left", []byte("hello"), domain.SideMetadata{}, cond); err != nil {
+		t.Errorf("save operation failed, got: %v", err)
+	}
+	if err := repo.SaveDataSideIf(context.Background(), "1", "right", []byte("hello"), domain.SideMetadata{}, cond); err == nil {
+		t.Error("expected precondition failure, got none")
+	}
+}
+
+func TestTieredSessionsUseBackend(t *testing.T) {
+	repo, _, backend := setUpTiered(t)
+
+	session := domain.DiffSession{ID: "1", LockWhenComplete: true}
+	backend.EXPECT().SaveSession(gomock.Any(), session).Return(nil)
+	backend.EXPECT().GetSession(gomock.Any(), "1").Return(&session, nil)
+
+	if err := repo.SaveSession(context.Background(), session); err != nil {
+		t.Errorf("save session operation failed, got: %v", err)
+	}
+	if s, err := repo.GetSession(context.Background(), "1"); err != nil || s == nil || !s.LockWhenComplete {
+		t.Errorf("wrong session, got: %v, %v", s, err)
+	}
+}
+
+func TestTieredPingsBothTiers(t *testing.T) {
+	repo, cache, backend := setUpTiered(t)
+
+	backend.EXPECT().Ping(gomock.Any()).Return(nil)
+	cache.EXPECT().Ping(gomock.Any()).Return(errors.New("Oops!"))
+
+	if err := repo.Ping(context.Background()); err == nil || err.Error() != "cannot reach cache: Oops!" {
+		t.Errorf("wrong ping result, got: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+type usageRepository interface {
+	SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error
+	DeleteDataSide(ctx context.Context, ID string, side string) error
+	DeleteDataSidesByID(ctx context.Context, ID string) error
+	GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error)
+}
+
+// expectUsage checks the usage of a tenant
+func expectUsage(t *testing.T, repo usageRepository, tenant domain.Tenant, expected domain.Usage) {
+	t.Helper()
+	usage, err := repo.GetUsage(context.Background(), tenant)
+	if err != nil {
+		t.Fatalf("get usage operation failed, got: %v", err)
+	}
+	if usage != expected {
+		t.Errorf("wrong usage of tenant %q, expected: %+v, got: %+v", tenant, expected, usage)
+	}
+}
+
+// testUsage runs the same sequence of writes against any repository, checking the usage of each tenant
+func testUsage(t *testing.T, repo usageRepository) {
+	ctx := context.Background()
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{})
+
+	repo.SaveDataSide(ctx, "1", "left", []byte("hello"), domain.SideMetadata{})
+	repo.SaveDataSide(ctx, "1", "left", []byte("hallo!"), domain.SideMetadata{})
+	repo.SaveDataSide(ctx, "1", "right", []byte("abc"), domain.SideMetadata{})
+	repo.SaveDataSide(ctx, "2", "left", []byte("abcd"), domain.SideMetadata{})
+	repo.SaveDataSide(ctx, "acme/1", "left", []byte("other tenant"), domain.SideMetadata{})
+
+	// every version counts
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 2, Bytes: 18})
+	expectUsage(t, repo, domain.Tenant("acme"), domain.Usage{Diffs: 1, Bytes: 12})
+
+	repo.DeleteDataSide(ctx, "1", "left")
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 2, Bytes: 7})
+
+	repo.DeleteDataSide(ctx, "2", "left")
+	repo.DeleteDataSide(ctx, "2", "right")
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{Diffs: 1, Bytes: 3})
+
+	repo.DeleteDataSidesByID(ctx, "1")
+	repo.DeleteDataSidesByID(ctx, "3")
+	expectUsage(t, repo, domain.DefaultTenant, domain.Usage{})
+	expectUsage(t, repo, domain.Tenant("acme"), domain.Usage{Diffs: 1, Bytes: 12})
+}
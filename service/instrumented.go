@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/metrics"
+)
+
+// diffFailed is the result label of diffs that did not complete
+const diffFailed = "ERROR"
+
+// InstrumentedDiffer is a Differ decorator that measures the duration of diffs by differ and result
+type InstrumentedDiffer struct {
+	differ   Differ
+	name     string
+	duration *metrics.Histogram
+}
+
+// NewInstrumentedDiffer creates a new instance of the InstrumentedDiffer decorator, naming the differ in its metrics
+func NewInstrumentedDiffer(d Differ, name string, registry *metrics.Registry) InstrumentedDiffer {
+	return InstrumentedDiffer{
+		differ: d,
+		name:   name,
+		duration: registry.Histogram("godiff_diff_duration_seconds",
+			"Duration of diff computations by differ and result.",
+			metrics.Seconds, metrics.DefBuckets, "differ", "result"),
+	}
+}
+
+// Diff compares the data with the decorated differ, measuring how long it takes
+func (d InstrumentedDiffer) Diff(ctx context.Context, left, right []byte) (domain.DiffReport, error) {
+	start := time.Now()
+	report, err := d.differ.Diff(ctx, left, right)
+	result := report.Result.String()
+	if err != nil {
+		result = diffFailed
+	}
+	d.duration.Observe(time.Since(start).Seconds(), d.name, result)
+	return report, err
+}
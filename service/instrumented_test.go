@@ -0,0 +1,39 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/metrics"
+	"github.com/ehpalumbo/go-diff/service"
+)
+
+func TestInstrumentedDifferMeasuresDiffsByResult(t *testing.T) {
+
+	// given
+	registry := metrics.NewRegistry()
+	differ := service.NewInstrumentedDiffer(domain.NewDifferImpl(), "bytewise", registry)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	differ.Diff(context.Background(), []byte("abc"), []byte("abc"))
+	differ.Diff(context.Background(), []byte("abc"), []byte("abd"))
+	differ.Diff(context.Background(), []byte("abc"), []byte("ab"))
+	_, err := differ.Diff(cancelled, []byte("abc"), []byte("abd"))
+
+	// then
+	if err == nil {
+		t.Error("cancelled diff should have failed but it did not")
+	}
+	var b strings.Builder
+	registry.WriteText(&b)
+	for _, result := range []string{"EQUAL", "NOT_EQUAL", "SIZE_MISMATCH", "ERROR"} {
+		sample := `godiff_diff_duration_seconds_count{differ="bytewise",result="` + result + `"} 1`
+		if !strings.Contains(b.String(), sample) {
+			t.Errorf("missing sample %s, got:\n%s", sample, b.String())
+		}
+	}
+}
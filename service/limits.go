@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// WithSizeLimits returns a copy of the service that rejects payloads exceeding the limits
+func (ds DiffService) WithSizeLimits(l domain.SizeLimits) DiffService {
+	ds.limits = l
+	return ds
+}
+
+// checkEncodedSize fails with domain.PayloadTooLargeError if a base64 value cannot decode within the limits,
+// so oversized payloads are rejected before being decoded.
+func (ds DiffService) checkEncodedSize(p domain.DiffPayload) error {
+	max := ds.limits.MaxPayloadBytes()
+	// padding may take up to two of the decoded bytes
+	if max > 0 && int64(base64.StdEncoding.DecodedLen(len(p.Value))-2) > max {
+		return domain.PayloadTooLargeError{ID: p.ID, Side: p.Side, Limit: max}
+	}
+	return nil
+}
+
+// checkSize fails with domain.PayloadTooLargeError if saving size bytes to a side would exceed the limits,
+// including the latest version of the other side of the diff.
+func (ds DiffService) checkSize(ctx context.Context, ID string, side domain.DiffSide, size int) error {
+	if ds.limits.MaxSideBytes > 0 && int64(size) > ds.limits.MaxSideBytes {
+		return domain.PayloadTooLargeError{ID: ID, Side: side, Limit: ds.limits.MaxSideBytes}
+	}
+	if ds.limits.MaxDiffBytes <= 0 {
+		return nil
+	}
+	if int64(size) > ds.limits.MaxDiffBytes {
+		return domain.PayloadTooLargeError{ID: ID, Side: side, Limit: ds.limits.MaxDiffBytes}
+	}
+	other := otherSide(side)
+	versions, err := ds.repository.ListVersions(ctx, ID, other.String())
+	if err != nil {
+		return storageError(err, "cannot get resource %s/%s versions from storage", ID, other)
+	}
+	if len(versions) > 0 && versions[len(versions)-1].Size+int64(size) > ds.limits.MaxDiffBytes {
+		return domain.PayloadTooLargeError{ID: ID, Side: side, Limit: ds.limits.MaxDiffBytes}
+	}
+	return nil
+}
+
+// checkMetadata fails with domain.IllegalDiffPayloadError if the metadata is too large for repositories to store
+func checkMetadata(meta domain.SideMetadata) error {
+	if len(meta.Labels) > domain.MaxLabels {
+		return domain.IllegalDiffPayloadError(fmt.Sprintf("payload cannot have more than %d labels", domain.MaxLabels))
+	}
+	if meta.Size() > domain.MaxMetadataBytes {
+		return domain.IllegalDiffPayloadError(fmt.Sprintf("payload filename, uploader and labels cannot exceed %d bytes", domain.MaxMetadataBytes))
+	}
+	return nil
+}
+
+func otherSide(side domain.DiffSide) domain.DiffSide {
+	if side == domain.LeftSide {
+		return domain.RightSide
+	}
+	return domain.LeftSide
+}
@@ -0,0 +1,117 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestServiceEnforcesSizeLimits(t *testing.T) {
+
+	// "aGVsbG8=" is "hello", 5 bytes long
+	cases := []struct {
+		name     string
+		value    string
+		limits   domain.SizeLimits
+		stored   bool
+		other    []domain.SideVersion
+		exceeded bool
+		// early rejections happen before decoding the value
+		early bool
+		limit int64
+	}{
+		{
+			name:   "side within limits",
+			value:  "aGVsbG8=",
+			limits: domain.SizeLimits{MaxSideBytes: 5},
+			stored: true,
+		},
+		{
+			name:     "side exceeding limit",
+			value:    "aGVsbG8=",
+			limits:   domain.SizeLimits{MaxSideBytes: 4},
+			exceeded: true,
+			limit:    4,
+		},
+		{
+			name:     "encoded value exceeding limit",
+			value:    "aGVsbG8gd29ybGQ=",
+			limits:   domain.SizeLimits{MaxSideBytes: 5},
+			exceeded: true,
+			early:    true,
+			limit:    5,
+		},
+		{
+			name:   "diff within limits",
+			value:  "aGVsbG8=",
+			limits: domain.SizeLimits{MaxDiffBytes: 8},
+			other:  []domain.SideVersion{{Version: 1, Size: 9}, {Version: 2, Size: 3}},
+			stored: true,
+		},
+		{
+			name:     "diff exceeding limit",
+			value:    "aGVsbG8=",
+			limits:   domain.SizeLimits{MaxSideBytes: 5, MaxDiffBytes: 8},
+			other:    []domain.SideVersion{{Version: 1, Size: 4}},
+			exceeded: true,
+			limit:    8,
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			limited := svc.WithSizeLimits(c.limits)
+			if !c.early {
+				repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+			}
+			if c.other != nil {
+				repMock.EXPECT().ListVersions(gomock.Any(), "1", "right").Return(c.other, nil)
+			} else if c.stored && c.limits.MaxDiffBytes > 0 {
+				repMock.EXPECT().ListVersions(gomock.Any(), "1", "right").Return(nil, nil)
+			}
+			if c.stored {
+				repMock.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("hello"), gomock.Any()).Return(nil)
+			}
+
+			// when
+			err := limited.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: c.value})
+
+			// then
+			if c.exceeded {
+				expected := domain.PayloadTooLargeError{ID: "1", Side: domain.LeftSide, Limit: c.limit}
+				if err != expected {
+					t.Errorf("wrong error, expected: %v, got: %v", expected, err)
+				}
+			} else if err != nil {
+				t.Errorf("failed with error: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestServiceSizeLimitsPropagateStorageFailure(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	limited := svc.WithSizeLimits(domain.SizeLimits{MaxDiffBytes: 10})
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+	repMock.EXPECT().ListVersions(gomock.Any(), "1", "right").Return(nil, errors.New("oops"))
+
+	// when
+	err := limited.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: "aGVsbG8="})
+
+	// then
+	if err == nil || err.Error() != "cannot save payload: cannot get resource 1/right versions from storage: oops" {
+		t.Errorf("wrong error, got: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// DefaultListLimit is the page size used when a listing does not specify one
+const DefaultListLimit = 100
+
+// MaxListLimit is the maximum page size of a listing
+const MaxListLimit = 1000
+
+// MaxSortedDiffs is the maximum number of diffs a listing sorted by other than ID can sort,
+// since they are all listed on every page
+const MaxSortedDiffs = 10000
+
+// ListDiffs returns a page of the stored diffs matching the query.
+// Cursors identify the last diff of the previous page, so pages stay
+// consistent when diffs are added or removed between requests.
+// Listings sorted by ID are paged by the repository, while other orders
+// need every matching diff to be listed and sorted first, so they are
+// rejected when more than MaxSortedDiffs diffs match.
+func (ds DiffService) ListDiffs(ctx context.Context, q domain.DiffListQuery) (domain.DiffPage, error) {
+	var page domain.DiffPage
+
+	limit := q.Limit
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return page, domain.IllegalDiffQueryError(fmt.Sprintf("limit must be between 1 and %d", MaxListLimit))
+	}
+	less, err := lessFunc(q.SortBy)
+	if err != nil {
+		return page, domain.IllegalDiffQueryError(err.Error())
+	}
+
+	var after *domain.DiffSummary
+	if q.Cursor != "" {
+		d, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return page, domain.IllegalDiffQueryError("invalid cursor")
+		}
+		after = &d
+	}
+
+	if q.SortBy == "" || q.SortBy == domain.SortByID {
+		var afterID string
+		if after != nil {
+			afterID = after.ID
+		}
+		// one more diff tells whether there is a next page
+		diffs, err := ds.repository.ListDiffs(ctx, q.Prefix, afterID, limit+1)
+		if err != nil {
+			return page, storageError(err, "cannot list resources from storage")
+		}
+		if len(diffs) > limit {
+			diffs = diffs[:limit]
+			page.NextCursor = encodeCursor(diffs[limit-1])
+		}
+		page.Diffs = diffs
+		return page, nil
+	}
+
+	diffs, err := ds.repository.ListDiffs(ctx, q.Prefix, "", MaxSortedDiffs+1)
+	if err != nil {
+		return page, storageError(err, "cannot list resources from storage")
+	}
+	if len(diffs) > MaxSortedDiffs {
+		return page, domain.IllegalDiffQueryError(fmt.Sprintf("cannot sort more than %d diffs, sort by id or narrow the prefix", MaxSortedDiffs))
+	}
+	sort.Slice(diffs, func(i, j int) bool { return less(diffs[i], diffs[j]) })
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(diffs), func(i int) bool { return less(*after, diffs[i]) })
+	}
+
+	end := start + limit
+	if end >= len(diffs) {
+		end = len(diffs)
+	} else {
+		page.NextCursor = encodeCursor(diffs[end-1])
+	}
+	page.Diffs = diffs[start:end]
+	return page, nil
+}
+
+func lessFunc(o domain.DiffSortOrder) (func(a, b domain.DiffSummary) bool, error) {
+	switch o {
+	case "", domain.SortByID:
+		return func(a, b domain.DiffSummary) bool {
+			return domain.LessID(a.ID, b.ID)
+		}, nil
+	case domain.SortByLastModified:
+		return func(a, b domain.DiffSummary) bool {
+			if a.LastModified.Equal(b.LastModified) {
+				return domain.LessID(a.ID, b.ID)
+			}
+			return a.LastModified.Before(b.LastModified)
+		}, nil
+	case domain.SortByLastModifiedNewest:
+		return func(a, b domain.DiffSummary) bool {
+			if a.LastModified.Equal(b.LastModified) {
+				return domain.LessID(a.ID, b.ID)
+			}
+			return a.LastModified.After(b.LastModified)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid sort value: %s", o)
+}
+
+func encodeCursor(d domain.DiffSummary) string {
+	raw := strconv.FormatInt(d.LastModified.UnixNano(), 10) + ":" + d.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (domain.DiffSummary, error) {
+	var d domain.DiffSummary
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return d, err
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return d, fmt.Errorf("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return d, err
+	}
+	d.ID = parts[1]
+	d.LastModified = time.Unix(0, nanos)
+	return d, nil
+}
@@ -0,0 +1,222 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/service"
+	"github.com/golang/mock/gomock"
+)
+
+func summaries() []domain.DiffSummary {
+	base := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	return []domain.DiffSummary{
+		{ID: "c", LastModified: base.Add(1 * time.Hour)},
+		{ID: "a", LastModified: base.Add(3 * time.Hour)},
+		{ID: "d", LastModified: base.Add(1 * time.Hour)},
+		{ID: "b", LastModified: base.Add(2 * time.Hour)},
+	}
+}
+
+// listSummaries pages the summaries as repositories do
+func listSummaries(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error) {
+	diffs := summaries()
+	sort.Slice(diffs, func(i, j int) bool { return domain.LessID(diffs[i].ID, diffs[j].ID) })
+	var page []domain.DiffSummary
+	for _, d := range diffs {
+		if (after == "" || domain.LessID(after, d.ID)) && (limit == 0 || len(page) < limit) {
+			page = append(page, d)
+		}
+	}
+	return page, nil
+}
+
+func TestServiceListsDiffsInPages(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	cases := []struct {
+		name  string
+		sort  domain.DiffSortOrder
+		limit int
+		pages [][]string
+	}{
+		{
+			name:  "by ID",
+			sort:  domain.SortByID,
+			limit: 4,
+			pages: [][]string{{"a", "b", "c"}, {"d"}},
+		},
+		{
+			name:  "by last modified",
+			sort:  domain.SortByLastModified,
+			limit: service.MaxSortedDiffs + 1,
+			pages: [][]string{{"c", "d", "b"}, {"a"}},
+		},
+		{
+			name:  "by last modified, newest first",
+			sort:  domain.SortByLastModifiedNewest,
+			limit: service.MaxSortedDiffs + 1,
+			pages: [][]string{{"a", "b", "c"}, {"d"}},
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			repMock.EXPECT().ListDiffs(gomock.Any(), "", gomock.Any(), c.limit).DoAndReturn(listSummaries).Times(len(c.pages))
+
+			cursor := ""
+			for i, expected := range c.pages {
+				// when
+				page, err := svc.ListDiffs(context.Background(), domain.DiffListQuery{Cursor: cursor, Limit: 3, SortBy: c.sort})
+
+				// then
+				if err != nil {
+					t.Fatalf("failed with error: %v", err)
+				}
+				if len(page.Diffs) != len(expected) {
+					t.Fatalf("wrong page %d size, expected: %d, got: %d", i, len(expected), len(page.Diffs))
+				}
+				for j, ID := range expected {
+					if page.Diffs[j].ID != ID {
+						t.Errorf("wrong diff at page %d position %d, expected: %s, got: %s", i, j, ID, page.Diffs[j].ID)
+					}
+				}
+				last := i == len(c.pages)-1
+				if last != (page.NextCursor == "") {
+					t.Errorf("wrong next cursor at page %d, got: %q", i, page.NextCursor)
+				}
+				cursor = page.NextCursor
+			}
+		})
+
+	}
+
+}
+
+func TestServiceListPassesPrefixToRepository(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().ListDiffs(gomock.Any(), "ci-", "", 101).Return([]domain.DiffSummary{{ID: "ci-1"}}, nil)
+
+	// when
+	page, err := svc.ListDiffs(context.Background(), domain.DiffListQuery{Prefix: "ci-"})
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if len(page.Diffs) != 1 || page.NextCursor != "" {
+		t.Errorf("wrong page, got: %v", page)
+	}
+}
+
+func TestServiceListsByIDAfterTheCursor(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	gomock.InOrder(
+		repMock.EXPECT().ListDiffs(gomock.Any(), "", "", 3).DoAndReturn(listSummaries),
+		repMock.EXPECT().ListDiffs(gomock.Any(), "", "b", 3).DoAndReturn(listSummaries),
+	)
+	first, err := svc.ListDiffs(context.Background(), domain.DiffListQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+
+	// when
+	page, err := svc.ListDiffs(context.Background(), domain.DiffListQuery{Cursor: first.NextCursor, Limit: 2})
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if len(page.Diffs) != 2 || page.Diffs[0].ID != "c" || page.Diffs[1].ID != "d" || page.NextCursor != "" {
+		t.Errorf("wrong page, got: %v", page)
+	}
+}
+
+func TestServiceCannotListDiffsIf(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	cases := []struct {
+		name     string
+		query    domain.DiffListQuery
+		diffs    []domain.DiffSummary
+		err      error
+		expected error
+	}{
+		{
+			name:     "limit is negative",
+			query:    domain.DiffListQuery{Limit: -1},
+			expected: domain.IllegalDiffQueryError("limit must be between 1 and 1000"),
+		},
+		{
+			name:     "limit is too large",
+			query:    domain.DiffListQuery{Limit: 1001},
+			expected: domain.IllegalDiffQueryError("limit must be between 1 and 1000"),
+		},
+		{
+			name:     "sort order is unknown",
+			query:    domain.DiffListQuery{SortBy: "size"},
+			expected: domain.IllegalDiffQueryError("invalid sort value: size"),
+		},
+		{
+			name:     "cursor is malformed",
+			query:    domain.DiffListQuery{Cursor: "%%%"},
+			expected: domain.IllegalDiffQueryError("invalid cursor"),
+		},
+		{
+			name:     "too many diffs to sort",
+			query:    domain.DiffListQuery{SortBy: domain.SortByLastModified},
+			diffs:    make([]domain.DiffSummary, service.MaxSortedDiffs+1),
+			expected: domain.IllegalDiffQueryError("cannot sort more than 10000 diffs, sort by id or narrow the prefix"),
+		},
+		{
+			name:     "repository's list operation failed",
+			err:      errors.New("oops"),
+			expected: errors.New("cannot list resources from storage: oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			if c.diffs != nil {
+				repMock.EXPECT().ListDiffs(gomock.Any(), "", "", service.MaxSortedDiffs+1).Return(c.diffs, nil)
+			}
+			if c.err != nil {
+				repMock.EXPECT().ListDiffs(gomock.Any(), "", "", 101).Return(nil, c.err)
+			}
+
+			// when
+			_, err := svc.ListDiffs(context.Background(), c.query)
+
+			// then
+			if err == nil {
+				t.Fatal("did not return error")
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+			if _, ok := c.expected.(domain.IllegalDiffQueryError); ok {
+				if _, ok := err.(domain.IllegalDiffQueryError); !ok {
+					t.Errorf("wrong error type, got: %T", err)
+				}
+			}
+		})
+
+	}
+
+}
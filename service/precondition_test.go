@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestServiceSavesConditionally(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	cond := domain.SidePrecondition{IfMatch: []string{domain.Digest([]byte("hello"))}}
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+	repMock.EXPECT().SaveDataSideIf(gomock.Any(), "1", "left", []byte("Go go go!"), gomock.Any(), cond).Return(nil)
+
+	p := domain.DiffPayload{
+		ID:           "1",
+		Side:         domain.LeftSide,
+		Value:        "R28gZ28gZ28h",
+		Precondition: cond,
+	}
+
+	// when
+	err := svc.Save(context.Background(), p)
+
+	// then
+	if err != nil {
+		t.Errorf("failed to accept valid payload, got: %v", err)
+	}
+}
+
+func TestServiceCannotSaveConditionallyIf(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "precondition failed",
+			err:      domain.PreconditionFailedError{ID: "1", Side: "left"},
+			expected: domain.PreconditionFailedError{ID: "1", Side: "left"},
+		},
+		{
+			name:     "wrapped precondition failed",
+			err:      fmt.Errorf("acme: %w", domain.PreconditionFailedError{ID: "1", Side: "left"}),
+			expected: fmt.Errorf("acme: %w", domain.PreconditionFailedError{ID: "1", Side: "left"}),
+		},
+		{
+			name:     "repository failure",
+			err:      errors.New("oops"),
+			expected: errors.New("cannot save payload: oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			cond := domain.SidePrecondition{IfNoneMatch: []string{domain.AnyTag}}
+			repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+			repMock.EXPECT().SaveDataSideIf(gomock.Any(), "1", "left", []byte("Go go go!"), gomock.Any(), cond).Return(c.err)
+
+			p := domain.DiffPayload{
+				ID:           "1",
+				Side:         domain.LeftSide,
+				Value:        "R28gZ28gZ28h",
+				Precondition: cond,
+			}
+
+			// when
+			err := svc.Save(context.Background(), p)
+
+			// then
+			if err == nil {
+				t.Fatal("expected error, got none")
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error, expected: %v, got: %v", c.expected, err)
+			}
+			if errors.Is(err, domain.CodePreconditionFailed) != errors.Is(c.expected, domain.CodePreconditionFailed) {
+				t.Errorf("wrong error code, got: %v", domain.CodeOf(err))
+			}
+		})
+
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// WithQuota returns a copy of the service that limits the diffs stored through it.
+// Quotas apply to the usage the repository reports for the default tenant,
+// so a tenant-scoped repository gets a per-tenant quota.
+func (ds DiffService) WithQuota(q domain.TenantQuota) DiffService {
+	ds.quota = q
+	return ds
+}
+
+// checkQuota fails with domain.QuotaExceededError if saving size bytes to a side would exceed the quota.
+// Every saved side is kept as a new version, so its size adds to the usage even when it overwrites a side.
+// The check is best effort: concurrent saves may overshoot the quota by the size of the saved sides.
+func (ds DiffService) checkQuota(ctx context.Context, ID string, size int) error {
+	if ds.quota.IsZero() {
+		return nil
+	}
+	usage, err := ds.repository.GetUsage(ctx, domain.DefaultTenant)
+	if err != nil {
+		return storageError(err, "cannot get usage from storage")
+	}
+
+	if ds.quota.MaxDiffs > 0 && usage.Diffs >= ds.quota.MaxDiffs {
+		// only new diffs count against the limit
+		sides, err := ds.repository.GetMetadataByID(ctx, ID)
+		if err != nil {
+			return storageError(err, "cannot get resource %s from storage", ID)
+		}
+		if len(sides) == 0 {
+			return domain.QuotaExceededError{ID: ID, Reason: fmt.Sprintf("cannot store more than %d diffs", ds.quota.MaxDiffs)}
+		}
+	}
+	if ds.quota.MaxBytes > 0 && usage.Bytes+int64(size) > ds.quota.MaxBytes {
+		return domain.QuotaExceededError{ID: ID, Reason: fmt.Sprintf("cannot store more than %d bytes", ds.quota.MaxBytes)}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestServiceEnforcesQuota(t *testing.T) {
+
+	// "aGVsbG8=" is "hello", 5 bytes long
+	usage := domain.Usage{Diffs: 2, Bytes: 12}
+
+	cases := []struct {
+		name     string
+		ID       string
+		quota    domain.TenantQuota
+		sides    map[string]domain.SideMetadata
+		exceeded bool
+	}{
+		{
+			name:  "new diff within quota",
+			ID:    "3",
+			quota: domain.TenantQuota{MaxDiffs: 3, MaxBytes: 17},
+		},
+		{
+			name:     "too many diffs",
+			ID:       "3",
+			quota:    domain.TenantQuota{MaxDiffs: 2},
+			sides:    map[string]domain.SideMetadata{},
+			exceeded: true,
+		},
+		{
+			name:     "too many bytes",
+			ID:       "3",
+			quota:    domain.TenantQuota{MaxBytes: 16},
+			exceeded: true,
+		},
+		{
+			name:  "overwrite of stored diff at diff limit",
+			ID:    "1",
+			quota: domain.TenantQuota{MaxDiffs: 2, MaxBytes: 17},
+			sides: map[string]domain.SideMetadata{"left": {}},
+		},
+		{
+			name:     "overwrite adding a version beyond bytes",
+			ID:       "1",
+			quota:    domain.TenantQuota{MaxBytes: 16},
+			exceeded: true,
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			quoted := svc.WithQuota(c.quota)
+			repMock.EXPECT().GetSession(gomock.Any(), c.ID).Return(nil, nil)
+			repMock.EXPECT().GetUsage(gomock.Any(), domain.DefaultTenant).Return(usage, nil)
+			if c.sides != nil {
+				repMock.EXPECT().GetMetadataByID(gomock.Any(), c.ID).Return(c.sides, nil)
+			}
+			if !c.exceeded {
+				repMock.EXPECT().SaveDataSide(gomock.Any(), c.ID, "left", []byte("hello"), gomock.Any()).Return(nil)
+			}
+
+			// when
+			err := quoted.Save(context.Background(), domain.DiffPayload{ID: c.ID, Side: domain.LeftSide, Value: "aGVsbG8="})
+
+			// then
+			if _, ok := err.(domain.QuotaExceededError); ok != c.exceeded {
+				t.Errorf("wrong outcome, got: %v", err)
+			} else if !c.exceeded && err != nil {
+				t.Errorf("failed with error: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestServiceQuotaPropagatesStorageFailure(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	quoted := svc.WithQuota(domain.TenantQuota{MaxDiffs: 1})
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+	repMock.EXPECT().GetUsage(gomock.Any(), domain.DefaultTenant).Return(domain.Usage{}, errors.New("oops"))
+
+	// when
+	err := quoted.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: "aGVsbG8="})
+
+	// then
+	if err == nil || err.Error() != "cannot save payload: cannot get usage from storage: oops" {
+		t.Errorf("wrong error, got: %v", err)
+	}
+}
@@ -1,12 +1,16 @@
 package service
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"mime"
 	"strings"
+	"time"
 
 	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/tracing"
 )
 
 // DiffService is the service layer implementation.
@@ -15,53 +19,127 @@ import (
 type DiffService struct {
 	differ     Differ
 	repository DiffRepository
+	quota      domain.TenantQuota
+	limits     domain.SizeLimits
 }
 
 // Differ is the contract of the diffing logic
 type Differ interface {
-	Diff([]byte, []byte) (domain.DiffReport, error)
+	Diff(context.Context, []byte, []byte) (domain.DiffReport, error)
 }
 
-// DiffRepository is the contract of the persistence layer
+// DiffRepository is the contract of the persistence layer.
+// Every saved side is kept as a new version, the latest one being returned by GetDataSidesByID.
+// GetUsage reports the usage of the diffs whose IDs belong to a tenant, as told by domain.TenantOf,
+// from counters kept up to date by every write rather than by scanning the stored diffs.
+// ListDiffs lists the diffs whose IDs start with the prefix in the order of domain.LessID,
+// only those after the ID after unless it is empty, and at most limit of them unless it is zero.
 type DiffRepository interface {
-	SaveDataSide(ID string, side string, data []byte) error
-	GetDataSidesByID(ID string) (map[string][]byte, error)
+	SaveDataSide(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata) error
+	SaveDataSideIf(ctx context.Context, ID string, side string, data []byte, meta domain.SideMetadata, cond domain.SidePrecondition) error
+	GetDataSidesByID(ctx context.Context, ID string) (map[string][]byte, error)
+	GetDataSidesByVersion(ctx context.Context, ID string, versions map[string]int) (map[string][]byte, error)
+	ListVersions(ctx context.Context, ID string, side string) ([]domain.SideVersion, error)
+	GetMetadataByID(ctx context.Context, ID string) (map[string]domain.SideMetadata, error)
+	DeleteDataSide(ctx context.Context, ID string, side string) error
+	DeleteDataSidesByID(ctx context.Context, ID string) error
+	ListDiffs(ctx context.Context, prefix, after string, limit int) ([]domain.DiffSummary, error)
+	GetUsage(ctx context.Context, tenant domain.Tenant) (domain.Usage, error)
+	SaveSession(ctx context.Context, session domain.DiffSession) error
+	GetSession(ctx context.Context, ID string) (*domain.DiffSession, error)
+	Ping(ctx context.Context) error
 }
 
 // NewDiffService can be used by client code to obtain a DiffService
 func NewDiffService(d Differ, rep DiffRepository) DiffService {
-	return DiffService{d, rep}
+	return DiffService{differ: d, repository: rep}
 }
 
-// Save a DiffPayload for comparison
-func (ds DiffService) Save(p domain.DiffPayload) error {
+// Save a DiffPayload for comparison.
+// Payloads with a precondition are only saved if the stored side satisfies it,
+// failing with domain.PreconditionFailedError otherwise.
+// Locked sessions reject payloads with domain.DiffLockedError,
+// and payloads exceeding the quota of the service fail with domain.QuotaExceededError.
+// Payloads exceeding the size limits of the service fail with domain.PayloadTooLargeError.
+func (ds DiffService) Save(ctx context.Context, p domain.DiffPayload) (err error) {
+	ctx, span := tracing.Start(ctx, "DiffService.Save", tracing.String("diff.id", p.ID), tracing.String("diff.side", p.Side.String()))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	if !validID(p.ID) {
 		return domain.IllegalDiffPayloadError("cannot save payload without ID")
 	}
+	if err := ds.checkEncodedSize(p); err != nil {
+		return err
+	}
 	b, err := base64.StdEncoding.DecodeString(p.Value)
 	if err != nil {
 		return domain.IllegalDiffPayloadError("payload value is not in base64")
 	}
-	err = ds.repository.SaveDataSide(p.ID, p.Side.String(), b)
+	span.SetAttributes(tracing.Int("diff.size", len(b)))
+	meta := p.Metadata
+	if meta.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(meta.ContentType); err != nil {
+			return domain.IllegalDiffPayloadError("payload content type is not a valid media type")
+		}
+	}
+	if err := checkMetadata(meta); err != nil {
+		return err
+	}
+	session, err := ds.unlockedSession(ctx, p.ID)
+	if errors.Is(err, domain.CodeConflict) {
+		return err
+	}
 	if err != nil {
-		return errors.New("cannot save payload: " + err.Error())
+		return fmt.Errorf("cannot save payload: %w", err)
 	}
-	return nil
+	err = ds.checkSize(ctx, p.ID, p.Side, len(b))
+	if errors.Is(err, domain.CodeTooLarge) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("cannot save payload: %w", err)
+	}
+	err = ds.checkQuota(ctx, p.ID, len(b))
+	if errors.Is(err, domain.CodeQuotaExceeded) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("cannot save payload: %w", err)
+	}
+	meta.UploadedAt = time.Now().UTC()
+	if p.Precondition.IsZero() {
+		err = ds.repository.SaveDataSide(ctx, p.ID, p.Side.String(), b, meta)
+	} else {
+		err = ds.repository.SaveDataSideIf(ctx, p.ID, p.Side.String(), b, meta, p.Precondition)
+	}
+	if errors.Is(err, domain.CodePreconditionFailed) {
+		return err
+	}
+	if err != nil {
+		return storageError(err, "cannot save payload")
+	}
+	return ds.lockIfComplete(ctx, session)
 }
 
 // GetDiffReport returns a report of the comparison with result
 // and insights of the differences
-func (ds DiffService) GetDiffReport(ID string) (domain.DiffReport, error) {
-
-	var r domain.DiffReport
+func (ds DiffService) GetDiffReport(ctx context.Context, ID string) (r domain.DiffReport, err error) {
+	ctx, span := tracing.Start(ctx, "DiffService.GetDiffReport", tracing.String("diff.id", ID))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
 
 	if !validID(ID) {
 		return r, domain.DiffNotFoundError{ID: ID}
 	}
 
-	data, err := ds.repository.GetDataSidesByID(ID)
+	data, err := ds.repository.GetDataSidesByID(ctx, ID)
 	if err != nil {
-		return r, fmt.Errorf("cannot get resource %s from storage: %v", ID, err)
+		return r, storageError(err, "cannot get resource %s from storage", ID)
 	}
 
 	left, okLeft := data[domain.LeftSide.String()]
@@ -70,7 +148,95 @@ func (ds DiffService) GetDiffReport(ID string) (domain.DiffReport, error) {
 		return r, domain.DiffNotFoundError{ID: ID}
 	}
 
-	return ds.differ.Diff(nilToEmpty(left), nilToEmpty(right))
+	return ds.diff(ctx, nilToEmpty(left), nilToEmpty(right))
+}
+
+// diff compares the data of the sides within a span of its own
+func (ds DiffService) diff(ctx context.Context, left, right []byte) (domain.DiffReport, error) {
+	ctx, span := tracing.Start(ctx, "Differ.Diff", tracing.Int("diff.left_size", len(left)), tracing.Int("diff.right_size", len(right)))
+	defer span.End()
+
+	report, err := ds.differ.Diff(ctx, left, right)
+	if err != nil {
+		span.SetError(err)
+		return report, err
+	}
+	span.SetAttributes(tracing.String("diff.result", report.Result.String()))
+	return report, nil
+}
+
+// GetSide returns the data stored for a side along with its metadata
+func (ds DiffService) GetSide(ctx context.Context, ID string, side domain.DiffSide) ([]byte, domain.SideMetadata, error) {
+	var meta domain.SideMetadata
+
+	if !validID(ID) {
+		return nil, meta, domain.DiffNotFoundError{ID: ID}
+	}
+
+	data, err := ds.repository.GetDataSidesByID(ctx, ID)
+	if err != nil {
+		return nil, meta, storageError(err, "cannot get resource %s from storage", ID)
+	}
+
+	b, ok := data[side.String()]
+	if !ok {
+		return nil, meta, domain.DiffNotFoundError{ID: ID}
+	}
+
+	metadata, err := ds.repository.GetMetadataByID(ctx, ID)
+	if err != nil {
+		return nil, meta, storageError(err, "cannot get resource %s metadata from storage", ID)
+	}
+	return nilToEmpty(b), metadata[side.String()], nil
+}
+
+// GetMetadata returns the metadata of every side stored for an ID
+func (ds DiffService) GetMetadata(ctx context.Context, ID string) (map[domain.DiffSide]domain.SideMetadata, error) {
+	if !validID(ID) {
+		return nil, domain.DiffNotFoundError{ID: ID}
+	}
+
+	metadata, err := ds.repository.GetMetadataByID(ctx, ID)
+	if err != nil {
+		return nil, storageError(err, "cannot get resource %s metadata from storage", ID)
+	}
+
+	m := make(map[domain.DiffSide]domain.SideMetadata, len(metadata))
+	for _, side := range []domain.DiffSide{domain.LeftSide, domain.RightSide} {
+		if meta, ok := metadata[side.String()]; ok {
+			m[side] = meta
+		}
+	}
+	if len(m) == 0 {
+		return nil, domain.DiffNotFoundError{ID: ID}
+	}
+	return m, nil
+}
+
+// Delete removes all the data sides stored for an ID along with its session.
+// Locks only protect the sides from changes, so locked diffs can still be deleted as a whole, as deletion requests require.
+func (ds DiffService) Delete(ctx context.Context, ID string) error {
+	if !validID(ID) {
+		return domain.DiffNotFoundError{ID: ID}
+	}
+	if err := ds.repository.DeleteDataSidesByID(ctx, ID); err != nil {
+		return storageError(err, "cannot delete resource %s from storage", ID)
+	}
+	return nil
+}
+
+// DeleteSide removes a single data side stored for an ID, unless its session is locked
+func (ds DiffService) DeleteSide(ctx context.Context, ID string, side domain.DiffSide) error {
+	if !validID(ID) {
+		return domain.DiffNotFoundError{ID: ID}
+	}
+	if _, err := ds.unlockedSession(ctx, ID); err != nil {
+		return err
+	}
+	if err := ds.repository.DeleteDataSide(ctx, ID, side.String()); err != nil {
+		return storageError(err, "cannot delete resource %s/%s from storage", ID, side)
+	}
+	return nil
 }
 
 func validID(ID string) bool {
@@ -83,3 +249,8 @@ func nilToEmpty(b []byte) []byte {
 	}
 	return b
 }
+
+// storageError wraps a failure of the repository, so that it can be told apart from other errors
+func storageError(err error, format string, a ...interface{}) error {
+	return domain.StorageError{Op: fmt.Sprintf(format, a...), Err: err}
+}
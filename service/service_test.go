@@ -2,9 +2,11 @@
 package service_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ehpalumbo/go-diff/domain"
@@ -62,7 +64,8 @@ func TestServiceSavesValidDiffSide(t *testing.T) {
 
 		t.Run(c.name, func(t *testing.T) {
 			// given
-			repMock.EXPECT().SaveDataSide("1", c.side.String(), []byte(c.decoded)).Return(nil)
+			repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+			repMock.EXPECT().SaveDataSide(gomock.Any(), "1", c.side.String(), []byte(c.decoded), gomock.Any()).Return(nil)
 
 			p := domain.DiffPayload{
 				ID:    "1",
@@ -71,7 +74,7 @@ func TestServiceSavesValidDiffSide(t *testing.T) {
 			}
 
 			// when
-			err := svc.Save(p)
+			err := svc.Save(context.Background(), p)
 
 			// then
 			if err != nil {
@@ -124,7 +127,7 @@ func TestServiceRejectsInvalidInputs(t *testing.T) {
 			}
 
 			// when
-			err := svc.Save(p)
+			err := svc.Save(context.Background(), p)
 
 			// then
 			if err == nil {
@@ -147,7 +150,8 @@ func TestServiceRejectsPayloadIfRepositorySaveOperationFailed(t *testing.T) {
 	tearDown := setUp(t)
 	defer tearDown()
 	// given
-	repMock.EXPECT().SaveDataSide("1", "left", []byte("Go go go!")).Return(errors.New("oops"))
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+	repMock.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("Go go go!"), gomock.Any()).Return(errors.New("oops"))
 
 	p := domain.DiffPayload{
 		ID:    "1",
@@ -156,7 +160,7 @@ func TestServiceRejectsPayloadIfRepositorySaveOperationFailed(t *testing.T) {
 	}
 
 	// when
-	err := svc.Save(p)
+	err := svc.Save(context.Background(), p)
 
 	// then
 	if err == nil {
@@ -198,7 +202,7 @@ func TestServiceCannotProduceDiffReportIf(t *testing.T) {
 		{
 			name:     "repository's get operation failed",
 			err:      errors.New("oops"),
-			expected: fmt.Errorf("cannot get resource %s from storage: %v", "1", "oops"),
+			expected: domain.StorageError{Op: "cannot get resource 1 from storage", Err: errors.New("oops")},
 		},
 	}
 
@@ -206,10 +210,10 @@ func TestServiceCannotProduceDiffReportIf(t *testing.T) {
 
 		t.Run(c.name, func(t *testing.T) {
 			// given
-			repMock.EXPECT().GetDataSidesByID("1").Return(c.data, c.err)
+			repMock.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(c.data, c.err)
 
 			// when
-			_, err := svc.GetDiffReport("1")
+			_, err := svc.GetDiffReport(context.Background(), "1")
 
 			// then
 			if err == nil {
@@ -251,7 +255,7 @@ func TestServiceGetDiffReportRejectsIllegalID(t *testing.T) {
 	for _, c := range cases {
 
 		t.Run(c.name, func(t *testing.T) {
-			_, err := svc.GetDiffReport(c.ID)
+			_, err := svc.GetDiffReport(context.Background(), c.ID)
 
 			if err == nil {
 				t.Error("did not return error")
@@ -337,10 +341,10 @@ func TestServiceProducesDiffReportIf(t *testing.T) {
 
 		t.Run(c.name, func(t *testing.T) {
 			// given
-			repMock.EXPECT().GetDataSidesByID("1").Return(c.data, nil)
+			repMock.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(c.data, nil)
 
 			// when
-			r, err := svc.GetDiffReport("1")
+			r, err := svc.GetDiffReport(context.Background(), "1")
 
 			// then
 			if err != nil {
@@ -363,3 +367,442 @@ func TestServiceProducesDiffReportIf(t *testing.T) {
 	}
 
 }
+
+func TestServiceDeletesDiff(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().DeleteDataSidesByID(gomock.Any(), "1").Return(nil)
+
+	// when
+	err := svc.Delete(context.Background(), "1")
+
+	// then
+	if err != nil {
+		t.Errorf("failed to delete diff, got: %v", err)
+	}
+}
+
+func TestServiceDeletesDiffSide(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+	repMock.EXPECT().DeleteDataSide(gomock.Any(), "1", "right").Return(nil)
+
+	// when
+	err := svc.DeleteSide(context.Background(), "1", domain.RightSide)
+
+	// then
+	if err != nil {
+		t.Errorf("failed to delete diff side, got: %v", err)
+	}
+}
+
+func TestServiceCannotDeleteIf(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	cases := []struct {
+		name     string
+		ID       string
+		delete   func(context.Context, string) error
+		expected error
+	}{
+		{
+			name:     "diff ID is blank",
+			ID:       " ",
+			delete:   svc.Delete,
+			expected: domain.DiffNotFoundError{ID: " "},
+		},
+		{
+			name:     "side ID is blank",
+			ID:       " ",
+			delete:   func(ctx context.Context, ID string) error { return svc.DeleteSide(ctx, ID, domain.LeftSide) },
+			expected: domain.DiffNotFoundError{ID: " "},
+		},
+		{
+			name: "repository's diff delete operation failed",
+			ID:   "1",
+			delete: func(ctx context.Context, ID string) error {
+				repMock.EXPECT().DeleteDataSidesByID(ctx, ID).Return(errors.New("oops"))
+				return svc.Delete(ctx, ID)
+			},
+			expected: errors.New("cannot delete resource 1 from storage: oops"),
+		},
+		{
+			name: "repository's side delete operation failed",
+			ID:   "1",
+			delete: func(ctx context.Context, ID string) error {
+				repMock.EXPECT().GetSession(ctx, ID).Return(nil, nil)
+				repMock.EXPECT().DeleteDataSide(ctx, ID, "left").Return(errors.New("oops"))
+				return svc.DeleteSide(ctx, ID, domain.LeftSide)
+			},
+			expected: errors.New("cannot delete resource 1/left from storage: oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// when
+			err := c.delete(context.Background(), c.ID)
+
+			// then
+			if err == nil {
+				t.Fatal("did not return error")
+			}
+			if _, ok := c.expected.(domain.DiffNotFoundError); ok && reflect.TypeOf(err) != reflect.TypeOf(c.expected) {
+				t.Errorf("wrong error type, expected: %T, got: %T", c.expected, err)
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+		})
+
+	}
+
+}
+
+func TestServiceGetsSide(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	cases := []struct {
+		name     string
+		data     map[string][]byte
+		expected string
+	}{
+		{
+			name:     "side with contents",
+			data:     map[string][]byte{"left": []byte("hello"), "right": []byte("hallo")},
+			expected: "hello",
+		},
+		{
+			name:     "side present but nil",
+			data:     map[string][]byte{"left": nil},
+			expected: "",
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			repMock.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(c.data, nil)
+			metadata := map[string]domain.SideMetadata{"left": {Filename: "hello.txt"}}
+			repMock.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(metadata, nil)
+
+			// when
+			data, meta, err := svc.GetSide(context.Background(), "1", domain.LeftSide)
+
+			// then
+			if err != nil {
+				t.Fatalf("failed with error: %v", err)
+			}
+			if data == nil || string(data) != c.expected {
+				t.Errorf("wrong side data, expected: %q, got: %q", c.expected, data)
+			}
+			if meta.Filename != "hello.txt" {
+				t.Errorf("wrong side metadata, got: %v", meta)
+			}
+		})
+
+	}
+
+}
+
+func TestServiceCannotGetSideIf(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	cases := []struct {
+		name     string
+		ID       string
+		data     map[string][]byte
+		err      error
+		metaErr  error
+		expected error
+	}{
+		{
+			name:     "ID is blank",
+			ID:       " ",
+			expected: domain.DiffNotFoundError{ID: " "},
+		},
+		{
+			name:     "side is missing",
+			ID:       "1",
+			data:     map[string][]byte{"right": []byte("hallo")},
+			expected: domain.DiffNotFoundError{ID: "1"},
+		},
+		{
+			name:     "repository's get operation failed",
+			ID:       "1",
+			err:      errors.New("oops"),
+			expected: errors.New("cannot get resource 1 from storage: oops"),
+		},
+		{
+			name:     "repository's metadata get operation failed",
+			ID:       "1",
+			data:     map[string][]byte{"left": []byte("hello")},
+			metaErr:  errors.New("oops"),
+			expected: errors.New("cannot get resource 1 metadata from storage: oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			if c.ID != " " {
+				repMock.EXPECT().GetDataSidesByID(gomock.Any(), c.ID).Return(c.data, c.err)
+			}
+			if c.metaErr != nil {
+				repMock.EXPECT().GetMetadataByID(gomock.Any(), c.ID).Return(nil, c.metaErr)
+			}
+
+			// when
+			_, _, err := svc.GetSide(context.Background(), c.ID, domain.LeftSide)
+
+			// then
+			if err == nil {
+				t.Fatal("did not return error")
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+		})
+
+	}
+
+}
+
+func TestServiceSavesMetadata(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	var saved domain.SideMetadata
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+	repMock.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("Go go go!"), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, _ []byte, meta domain.SideMetadata) error {
+			saved = meta
+			return nil
+		})
+
+	p := domain.DiffPayload{
+		ID:    "1",
+		Side:  domain.LeftSide,
+		Value: "R28gZ28gZ28h",
+		Metadata: domain.SideMetadata{
+			Filename:    "go.txt",
+			ContentType: "text/plain; charset=utf-8",
+			Labels:      map[string]string{"pipeline": "ci"},
+			Uploader:    "gopher",
+		},
+	}
+
+	// when
+	err := svc.Save(context.Background(), p)
+
+	// then
+	if err != nil {
+		t.Fatalf("failed to accept valid payload, got: %v", err)
+	}
+	if saved.Filename != "go.txt" || saved.ContentType != "text/plain; charset=utf-8" ||
+		saved.Labels["pipeline"] != "ci" || saved.Uploader != "gopher" {
+		t.Errorf("wrong metadata saved, got: %v", saved)
+	}
+	if saved.UploadedAt.IsZero() {
+		t.Error("upload time was not set")
+	}
+}
+
+func TestServiceRejectsInvalidContentType(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	p := domain.DiffPayload{
+		ID:       "1",
+		Side:     domain.LeftSide,
+		Value:    "R28gZ28gZ28h",
+		Metadata: domain.SideMetadata{ContentType: "not a media type"},
+	}
+
+	// when
+	err := svc.Save(context.Background(), p)
+
+	// then
+	if _, ok := err.(domain.IllegalDiffPayloadError); !ok {
+		t.Errorf("wrong error type, got: %v", err)
+	}
+}
+
+func TestServiceRejectsOversizedMetadata(t *testing.T) {
+
+	labels := make(map[string]string, domain.MaxLabels+1)
+	for i := 0; i <= domain.MaxLabels; i++ {
+		labels[fmt.Sprintf("label%d", i)] = "x"
+	}
+	cases := []struct {
+		name string
+		meta domain.SideMetadata
+	}{
+		{"long filename", domain.SideMetadata{Filename: strings.Repeat("a", domain.MaxMetadataBytes+1)}},
+		{"long labels", domain.SideMetadata{Filename: "go.txt", Labels: map[string]string{"pipeline": strings.Repeat("a", domain.MaxMetadataBytes)}}},
+		{"too many labels", domain.SideMetadata{Labels: labels}},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			p := domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: "R28gZ28gZ28h", Metadata: c.meta}
+
+			// when
+			err := svc.Save(context.Background(), p)
+
+			// then
+			if _, ok := err.(domain.IllegalDiffPayloadError); !ok {
+				t.Errorf("wrong error type, got: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestServiceGetsMetadata(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(map[string]domain.SideMetadata{
+		"right":   {Filename: "right.txt"},
+		"unknown": {Filename: "unknown.txt"},
+	}, nil)
+
+	// when
+	m, err := svc.GetMetadata(context.Background(), "1")
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if len(m) != 1 || m[domain.RightSide].Filename != "right.txt" {
+		t.Errorf("wrong metadata, got: %v", m)
+	}
+}
+
+func TestServiceCannotGetMetadataIf(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	cases := []struct {
+		name     string
+		ID       string
+		metadata map[string]domain.SideMetadata
+		err      error
+		expected error
+	}{
+		{
+			name:     "ID is blank",
+			ID:       " ",
+			expected: domain.DiffNotFoundError{ID: " "},
+		},
+		{
+			name:     "no side is stored",
+			ID:       "1",
+			metadata: map[string]domain.SideMetadata{},
+			expected: domain.DiffNotFoundError{ID: "1"},
+		},
+		{
+			name:     "repository's get operation failed",
+			ID:       "1",
+			err:      errors.New("oops"),
+			expected: errors.New("cannot get resource 1 metadata from storage: oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			// given
+			if c.ID != " " {
+				repMock.EXPECT().GetMetadataByID(gomock.Any(), c.ID).Return(c.metadata, c.err)
+			}
+
+			// when
+			_, err := svc.GetMetadata(context.Background(), c.ID)
+
+			// then
+			if err == nil {
+				t.Fatal("did not return error")
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error message, expected: %v, got: %v", c.expected, err)
+			}
+		})
+
+	}
+
+}
+
+func TestServiceClassifiesStorageFailures(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		err      error
+		expected domain.ErrorCode
+	}{
+		{name: "unavailable storage", err: errors.New("connection refused"), expected: domain.CodeStorageUnavailable},
+		{name: "storage timeout", err: fmt.Errorf("operation error: %w", context.DeadlineExceeded), expected: domain.CodeTimeout},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			repMock.EXPECT().GetSession(gomock.Any(), "1").Return(nil, nil)
+			repMock.EXPECT().SaveDataSide(gomock.Any(), "1", "left", gomock.Any(), gomock.Any()).Return(c.err)
+
+			// when
+			err := svc.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: "aGVsbG8="})
+
+			// then
+			if !errors.Is(err, c.expected) || !errors.Is(err, c.err) {
+				t.Errorf("wrong error, expected %s wrapping %v, got: %v", c.expected, c.err, err)
+			}
+		})
+
+	}
+}
+
+func TestServiceHonorsContextCancellation(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	repMock.EXPECT().GetDataSidesByID(ctx, "1").Return(map[string][]byte{
+		"left":  []byte("hello"),
+		"right": []byte("hallo"),
+	}, nil)
+
+	// when
+	_, err := svc.GetDiffReport(ctx, "1")
+
+	// then
+	if err != context.Canceled {
+		t.Errorf("did not stop on cancellation, got: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+)
+
+// CreateSession creates a diff under a random UUID, so that clients do not need to agree on IDs
+func (ds DiffService) CreateSession(ctx context.Context, lockWhenComplete bool) (domain.DiffSession, error) {
+	var s domain.DiffSession
+
+	ID, err := newSessionID()
+	if err != nil {
+		return s, fmt.Errorf("cannot generate session ID: %w", err)
+	}
+	s = domain.DiffSession{
+		ID:               ID,
+		CreatedAt:        time.Now().UTC(),
+		LockWhenComplete: lockWhenComplete,
+	}
+	if err := ds.repository.SaveSession(ctx, s); err != nil {
+		return s, storageError(err, "cannot save session %s to storage", ID)
+	}
+	return s, nil
+}
+
+// GetSession returns the session of a diff created by CreateSession
+func (ds DiffService) GetSession(ctx context.Context, ID string) (domain.DiffSession, error) {
+	if !validID(ID) {
+		return domain.DiffSession{}, domain.DiffNotFoundError{ID: ID}
+	}
+	s, err := ds.repository.GetSession(ctx, ID)
+	if err != nil {
+		return domain.DiffSession{}, storageError(err, "cannot get session %s from storage", ID)
+	}
+	if s == nil {
+		return domain.DiffSession{}, domain.DiffNotFoundError{ID: ID}
+	}
+	return *s, nil
+}
+
+// unlockedSession returns the session of a diff that accepts changes, if any.
+// Diffs with client-chosen IDs have no session and are never locked.
+func (ds DiffService) unlockedSession(ctx context.Context, ID string) (*domain.DiffSession, error) {
+	s, err := ds.repository.GetSession(ctx, ID)
+	if err != nil {
+		return nil, storageError(err, "cannot get session %s from storage", ID)
+	}
+	if s != nil && s.Locked() {
+		return nil, domain.DiffLockedError{ID: ID}
+	}
+	return s, nil
+}
+
+// lockIfComplete locks sessions created with LockWhenComplete once both sides are stored
+func (ds DiffService) lockIfComplete(ctx context.Context, s *domain.DiffSession) error {
+	if s == nil || !s.LockWhenComplete {
+		return nil
+	}
+	metadata, err := ds.repository.GetMetadataByID(ctx, s.ID)
+	if err != nil {
+		return storageError(err, "cannot get resource %s metadata from storage", s.ID)
+	}
+	if _, ok := metadata[domain.LeftSide.String()]; !ok {
+		return nil
+	}
+	if _, ok := metadata[domain.RightSide.String()]; !ok {
+		return nil
+	}
+	s.LockedAt = time.Now().UTC()
+	if err := ds.repository.SaveSession(ctx, *s); err != nil {
+		return storageError(err, "cannot lock session %s", s.ID)
+	}
+	return nil
+}
+
+// newSessionID returns a random (version 4) UUID
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
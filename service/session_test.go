@@ -0,0 +1,204 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestServiceCreatesSession(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	var saved domain.DiffSession
+	repMock.EXPECT().SaveSession(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, s domain.DiffSession) error {
+		saved = s
+		return nil
+	})
+
+	// when
+	s, err := svc.CreateSession(context.Background(), true)
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if !uuidPattern.MatchString(s.ID) {
+		t.Errorf("session ID is not a random UUID, got: %s", s.ID)
+	}
+	if s.CreatedAt.IsZero() || !s.LockWhenComplete || s.Locked() {
+		t.Errorf("wrong session, got: %v", s)
+	}
+	if saved != s {
+		t.Errorf("wrong session saved, expected: %v, got: %v", s, saved)
+	}
+}
+
+func TestServiceCreatesDistinctSessions(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().SaveSession(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	// when
+	first, _ := svc.CreateSession(context.Background(), false)
+	second, _ := svc.CreateSession(context.Background(), false)
+
+	// then
+	if first.ID == second.ID {
+		t.Errorf("session IDs collided: %s", first.ID)
+	}
+}
+
+func TestServiceCannotCreateSessionIfRepositoryFails(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().SaveSession(gomock.Any(), gomock.Any()).Return(errors.New("oops"))
+
+	// when
+	_, err := svc.CreateSession(context.Background(), false)
+
+	// then
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
+
+func TestServiceGetsSession(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	stored := domain.DiffSession{ID: "1", CreatedAt: time.Now()}
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(&stored, nil)
+	repMock.EXPECT().GetSession(gomock.Any(), "2").Return(nil, nil)
+
+	// when
+	s, err := svc.GetSession(context.Background(), "1")
+	_, notFound := svc.GetSession(context.Background(), "2")
+
+	// then
+	if err != nil || s != stored {
+		t.Errorf("wrong session, got: %v, %v", s, err)
+	}
+	if _, ok := notFound.(domain.DiffNotFoundError); !ok {
+		t.Errorf("expected not found error for diff without session, got: %v", notFound)
+	}
+}
+
+func TestServiceLocksCompleteSession(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	session := domain.DiffSession{ID: "1", LockWhenComplete: true}
+	var locked domain.DiffSession
+	gomock.InOrder(
+		repMock.EXPECT().GetSession(gomock.Any(), "1").Return(&session, nil),
+		repMock.EXPECT().SaveDataSide(gomock.Any(), "1", "right", []byte("Go go go!"), gomock.Any()).Return(nil),
+		repMock.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(map[string]domain.SideMetadata{"left": {}, "right": {}}, nil),
+		repMock.EXPECT().SaveSession(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, s domain.DiffSession) error {
+			locked = s
+			return nil
+		}),
+	)
+
+	// when
+	err := svc.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.RightSide, Value: "R28gZ28gZ28h"})
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if locked.ID != "1" || !locked.Locked() {
+		t.Errorf("session was not locked, got: %v", locked)
+	}
+}
+
+func TestServiceDoesNotLockIncompleteSession(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	session := domain.DiffSession{ID: "1", LockWhenComplete: true}
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(&session, nil)
+	repMock.EXPECT().SaveDataSide(gomock.Any(), "1", "left", []byte("Go go go!"), gomock.Any()).Return(nil)
+	repMock.EXPECT().GetMetadataByID(gomock.Any(), "1").Return(map[string]domain.SideMetadata{"left": {}}, nil)
+
+	// when
+	err := svc.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: "R28gZ28gZ28h"})
+
+	// then
+	if err != nil {
+		t.Errorf("failed with error: %v", err)
+	}
+}
+
+func TestServiceRejectsChangesToLockedSession(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		change func() error
+	}{
+		{
+			name: "save",
+			change: func() error {
+				return svc.Save(context.Background(), domain.DiffPayload{ID: "1", Side: domain.LeftSide, Value: "R28gZ28gZ28h"})
+			},
+		},
+		{
+			name:   "delete side",
+			change: func() error { return svc.DeleteSide(context.Background(), "1", domain.LeftSide) },
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			session := domain.DiffSession{ID: "1", LockWhenComplete: true, LockedAt: time.Now()}
+			repMock.EXPECT().GetSession(gomock.Any(), "1").Return(&session, nil)
+
+			// when
+			err := c.change()
+
+			// then
+			if _, ok := err.(domain.DiffLockedError); !ok {
+				t.Errorf("expected locked error, got: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestServiceDeletesLockedDiff(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	session := domain.DiffSession{ID: "1", LockWhenComplete: true, LockedAt: time.Now()}
+	repMock.EXPECT().GetSession(gomock.Any(), "1").Return(&session, nil).AnyTimes()
+	repMock.EXPECT().DeleteDataSidesByID(gomock.Any(), "1").Return(nil)
+
+	// when
+	err := svc.Delete(context.Background(), "1")
+
+	// then
+	if err != nil {
+		t.Errorf("locked diff should be deleted, got: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/tracing"
+	"github.com/golang/mock/gomock"
+)
+
+func TestServiceTracesReports(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	var b strings.Builder
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&b), "go-diff")
+	ctx, root := tracer.Start(context.Background(), "GET /v1/diff/:id", tracing.KindServer)
+	repMock.EXPECT().GetDataSidesByID(gomock.Any(), "1").Return(map[string][]byte{"left": []byte("abc"), "right": []byte("abd")}, nil)
+
+	// when
+	svc.GetDiffReport(ctx, "1")
+	root.End()
+	tracer.Shutdown(context.Background())
+
+	// then
+	spans := make(map[string]tracing.SpanLine)
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var span tracing.SpanLine
+		json.Unmarshal([]byte(line), &span)
+		spans[span.Name] = span
+	}
+	report, diff := spans["DiffService.GetDiffReport"], spans["Differ.Diff"]
+	if report.ParentSpanID != root.SpanContext().SpanID().String() || report.Attributes["diff.id"] != "1" {
+		t.Errorf("wrong report span, got: %+v", report)
+	}
+	if diff.ParentSpanID != report.SpanID || diff.Attributes["diff.result"] != "NOT_EQUAL" {
+		t.Errorf("wrong diff span, got: %+v", diff)
+	}
+}
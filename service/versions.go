@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/ehpalumbo/go-diff/tracing"
+)
+
+// ListVersions returns the stored versions of a side, oldest first
+func (ds DiffService) ListVersions(ctx context.Context, ID string, side domain.DiffSide) ([]domain.SideVersion, error) {
+	if !validID(ID) {
+		return nil, domain.DiffNotFoundError{ID: ID}
+	}
+
+	versions, err := ds.repository.ListVersions(ctx, ID, side.String())
+	if err != nil {
+		return nil, storageError(err, "cannot get resource %s/%s versions from storage", ID, side)
+	}
+	if len(versions) == 0 {
+		return nil, domain.DiffNotFoundError{ID: ID}
+	}
+	return versions, nil
+}
+
+// GetVersionedDiffReport returns a report of the comparison between
+// the given versions of each side. domain.LatestVersion selects the
+// most recent version, which may be missing like in GetDiffReport,
+// while explicitly requested versions must exist.
+func (ds DiffService) GetVersionedDiffReport(ctx context.Context, ID string, left, right int) (r domain.DiffReport, err error) {
+	ctx, span := tracing.Start(ctx, "DiffService.GetVersionedDiffReport",
+		tracing.String("diff.id", ID), tracing.Int("diff.left_version", left), tracing.Int("diff.right_version", right))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	if !validID(ID) {
+		return r, domain.DiffNotFoundError{ID: ID}
+	}
+	if left < 0 || right < 0 {
+		return r, domain.IllegalDiffQueryError("versions must be positive numbers")
+	}
+
+	versions := map[string]int{
+		domain.LeftSide.String():  left,
+		domain.RightSide.String(): right,
+	}
+	data, err := ds.repository.GetDataSidesByVersion(ctx, ID, versions)
+	if err != nil {
+		return r, storageError(err, "cannot get resource %s from storage", ID)
+	}
+
+	for side, version := range versions {
+		if _, ok := data[side]; !ok && version != domain.LatestVersion {
+			return r, domain.DiffNotFoundError{ID: ID}
+		}
+	}
+	leftData, okLeft := data[domain.LeftSide.String()]
+	rightData, okRight := data[domain.RightSide.String()]
+	if !okLeft && !okRight {
+		return r, domain.DiffNotFoundError{ID: ID}
+	}
+
+	return ds.diff(ctx, nilToEmpty(leftData), nilToEmpty(rightData))
+}
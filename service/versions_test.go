@@ -0,0 +1,184 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/domain"
+	"github.com/golang/mock/gomock"
+)
+
+func TestServiceListsVersions(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	expected := []domain.SideVersion{{Version: 1, Size: 5}, {Version: 2, Size: 6}}
+	repMock.EXPECT().ListVersions(gomock.Any(), "1", "left").Return(expected, nil)
+
+	// when
+	versions, err := svc.ListVersions(context.Background(), "1", domain.LeftSide)
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if len(versions) != 2 || versions[1].Version != 2 {
+		t.Errorf("wrong versions, got: %v", versions)
+	}
+}
+
+func TestServiceCannotListVersionsIf(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		ID       string
+		versions []domain.SideVersion
+		err      error
+		notFound bool
+	}{
+		{
+			name:     "blank ID",
+			ID:       " ",
+			notFound: true,
+		},
+		{
+			name:     "no versions stored",
+			ID:       "1",
+			versions: []domain.SideVersion{},
+			notFound: true,
+		},
+		{
+			name: "repository failure",
+			ID:   "1",
+			err:  errors.New("oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			if c.versions != nil || c.err != nil {
+				repMock.EXPECT().ListVersions(gomock.Any(), c.ID, "left").Return(c.versions, c.err)
+			}
+
+			// when
+			_, err := svc.ListVersions(context.Background(), c.ID, domain.LeftSide)
+
+			// then
+			if err == nil {
+				t.Fatal("expected error, got none")
+			}
+			if _, ok := err.(domain.DiffNotFoundError); ok != c.notFound {
+				t.Errorf("wrong error, got: %v", err)
+			}
+		})
+
+	}
+}
+
+func TestServiceComparesVersions(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().GetDataSidesByVersion(gomock.Any(), "1", map[string]int{"left": 3, "right": 5}).
+		Return(map[string][]byte{"left": []byte("hello"), "right": []byte("hallo")}, nil)
+
+	// when
+	r, err := svc.GetVersionedDiffReport(context.Background(), "1", 3, 5)
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if r.Result != domain.NotEqual || len(r.Insights) != 1 {
+		t.Errorf("wrong report, got: %v", r)
+	}
+}
+
+func TestServiceComparesVersionWithMissingLatestSide(t *testing.T) {
+	tearDown := setUp(t)
+	defer tearDown()
+
+	// given
+	repMock.EXPECT().GetDataSidesByVersion(gomock.Any(), "1", map[string]int{"left": 2, "right": domain.LatestVersion}).
+		Return(map[string][]byte{"left": []byte("hello")}, nil)
+
+	// when
+	r, err := svc.GetVersionedDiffReport(context.Background(), "1", 2, domain.LatestVersion)
+
+	// then
+	if err != nil {
+		t.Fatalf("failed with error: %v", err)
+	}
+	if r.Result != domain.SizeMismatch {
+		t.Errorf("wrong report, got: %v", r)
+	}
+}
+
+func TestServiceCannotCompareVersionsIf(t *testing.T) {
+
+	cases := []struct {
+		name        string
+		left, right int
+		data        map[string][]byte
+		err         error
+		expected    error
+	}{
+		{
+			name:     "negative version",
+			left:     -1,
+			expected: domain.IllegalDiffQueryError("versions must be positive numbers"),
+		},
+		{
+			name:     "requested version is missing",
+			left:     3,
+			right:    domain.LatestVersion,
+			data:     map[string][]byte{"right": []byte("hallo")},
+			expected: domain.DiffNotFoundError{ID: "1"},
+		},
+		{
+			name:     "no sides stored",
+			data:     map[string][]byte{},
+			expected: domain.DiffNotFoundError{ID: "1"},
+		},
+		{
+			name:     "repository failure",
+			left:     1,
+			right:    1,
+			err:      errors.New("oops"),
+			expected: errors.New("cannot get resource 1 from storage: oops"),
+		},
+	}
+
+	for _, c := range cases {
+
+		t.Run(c.name, func(t *testing.T) {
+			tearDown := setUp(t)
+			defer tearDown()
+
+			// given
+			if c.data != nil || c.err != nil {
+				repMock.EXPECT().GetDataSidesByVersion(gomock.Any(), "1", map[string]int{"left": c.left, "right": c.right}).Return(c.data, c.err)
+			}
+
+			// when
+			_, err := svc.GetVersionedDiffReport(context.Background(), "1", c.left, c.right)
+
+			// then
+			if err == nil {
+				t.Fatal("expected error, got none")
+			}
+			if err.Error() != c.expected.Error() {
+				t.Errorf("wrong error, expected: %v, got: %v", c.expected, err)
+			}
+		})
+
+	}
+}
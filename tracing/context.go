@@ -0,0 +1,27 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator propagates spans across services with the W3C traceparent header
+var propagator = propagation.TraceContext{}
+
+// SpanFromContext returns the current span of the context, one recording nothing if there is none
+func SpanFromContext(ctx context.Context) Span {
+	return Span{trace.SpanFromContext(ctx)}
+}
+
+// Extract returns a copy of the context carrying the span context of the caller from the headers, if valid
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject sets the headers to propagate the current span of the context, if any
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
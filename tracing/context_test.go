@@ -0,0 +1,76 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExtractIgnoresInvalidTraceparent(t *testing.T) {
+
+	cases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true},
+		{name: "future version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: true},
+		{name: "forbidden version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "zero trace ID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero span ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "short trace ID", value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+		{name: "empty", value: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// given
+			header := http.Header{}
+			header.Set("traceparent", c.value)
+
+			// when
+			ctx := tracing.Extract(context.Background(), header)
+
+			// then
+			sc := tracing.SpanFromContext(ctx).SpanContext()
+			if sc.IsValid() != c.valid {
+				t.Fatalf("wrong validity, expected: %v, got: %+v", c.valid, sc)
+			}
+			if c.valid && (sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID().String() != "00f067aa0ba902b7" || !sc.IsRemote()) {
+				t.Errorf("wrong span context, got: %+v", sc)
+			}
+		})
+	}
+}
+
+func TestExtractAndInjectPropagateTheTrace(t *testing.T) {
+
+	// given
+	tracer := tracing.NewTracer(tracetest.NewInMemoryExporter(), "go-diff")
+	defer tracer.Shutdown(context.Background())
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// when
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), incoming), "GET /", tracing.KindServer)
+	outgoing := http.Header{}
+	tracing.Inject(ctx, outgoing)
+
+	// then
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext().SpanID().String() + "-01"
+	if outgoing.Get("traceparent") != expected {
+		t.Errorf("wrong propagated trace, expected: %s, got: %s", expected, outgoing.Get("traceparent"))
+	}
+}
+
+func TestInjectWithoutSpan(t *testing.T) {
+	header := http.Header{}
+	tracing.Inject(context.Background(), header)
+	if header.Get("traceparent") != "" {
+		t.Errorf("should not propagate anything, got: %s", header.Get("traceparent"))
+	}
+}
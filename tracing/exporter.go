@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// WriterExporter writes each span as a JSON line, for tests and local debugging
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter creates a new WriterExporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// SpanLine is the JSON line written by a WriterExporter for each span
+type SpanLine struct {
+	Name          string                 `json:"name"`
+	Kind          Kind                   `json:"kind"`
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Status        StatusCode             `json:"status"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+}
+
+// ExportSpans writes the spans, one line each
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, span := range spans {
+		line := SpanLine{
+			Name:          span.Name(),
+			Kind:          span.SpanKind(),
+			TraceID:       span.SpanContext().TraceID().String(),
+			SpanID:        span.SpanContext().SpanID().String(),
+			Start:         span.StartTime(),
+			End:           span.EndTime(),
+			Status:        span.Status().Code,
+			StatusMessage: span.Status().Description,
+		}
+		if parent := span.Parent(); parent.IsValid() {
+			line.ParentSpanID = parent.SpanID().String()
+		}
+		if attrs := span.Attributes(); len(attrs) > 0 {
+			line.Attributes = make(map[string]interface{}, len(attrs))
+			for _, attr := range attrs {
+				line.Attributes[string(attr.Key)] = attr.Value.AsInterface()
+			}
+		}
+		if err := enc.Encode(&line); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(b.Bytes())
+	return err
+}
+
+// Shutdown does nothing, since spans are written as soon as they are exported
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// NewOTLPExporter creates an exporter sending spans to the OpenTelemetry collector at the endpoint,
+// like http://localhost:4318, with OTLP over HTTP
+func NewOTLPExporter(endpoint string) (Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
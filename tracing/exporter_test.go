@@ -0,0 +1,127 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehpalumbo/go-diff/tracing"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collector "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func testSpan() sdktrace.ReadOnlySpan {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	start := time.Unix(1625097600, 0)
+	return tracetest.SpanStub{
+		Name:        "GET /v1/diff/:id",
+		SpanKind:    tracing.KindServer,
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}),
+		StartTime:   start,
+		EndTime:     start.Add(time.Millisecond),
+		Attributes:  []tracing.Attribute{tracing.String("http.method", "GET"), tracing.Int("http.status_code", 500), tracing.Bool("retried", false)},
+		Status:      sdktrace.Status{Code: codes.Error, Description: "Internal Server Error"},
+	}.Snapshot()
+}
+
+func TestWriterExporterWritesJSONLines(t *testing.T) {
+
+	// given
+	var b strings.Builder
+	exporter := tracing.NewWriterExporter(&b)
+
+	// when
+	err := exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{testSpan(), testSpan()})
+
+	// then
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if err != nil || len(lines) != 2 {
+		t.Fatalf("should have written two lines, got: %v, %q", err, b.String())
+	}
+	var line tracing.SpanLine
+	json.Unmarshal([]byte(lines[0]), &line)
+	if line.Name != "GET /v1/diff/:id" || line.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || line.ParentSpanID != "" ||
+		line.Attributes["http.method"] != "GET" || line.Attributes["http.status_code"] != 500.0 || line.Status != tracing.StatusError {
+		t.Errorf("wrong span line, got: %s", lines[0])
+	}
+}
+
+func TestOTLPExporterSendsSpansToCollector(t *testing.T) {
+
+	// given
+	var path, contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	exporter, err := tracing.NewOTLPExporter(server.URL + "/")
+	if err != nil {
+		t.Fatalf("cannot create exporter: %v", err)
+	}
+	tracer := tracing.NewTracer(exporter, "go-diff")
+	_, span := tracer.Start(context.Background(), "GET /v1/diff/:id", tracing.KindServer, tracing.Int("http.status_code", 200))
+	span.End()
+
+	// when
+	err = tracer.Shutdown(context.Background())
+
+	// then
+	if err != nil || path != "/v1/traces" || contentType != "application/x-protobuf" {
+		t.Fatalf("wrong export request, got: %v, %s, %s", err, path, contentType)
+	}
+	var req collector.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil || len(req.ResourceSpans) != 1 {
+		t.Fatalf("wrong export body, got: %v, %+v", err, &req)
+	}
+	resource := req.ResourceSpans[0].Resource.Attributes
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if !hasServiceName(resource, "go-diff") || len(spans) != 1 || spans[0].Name != "GET /v1/diff/:id" || spans[0].Attributes[0].Value.GetIntValue() != 200 {
+		t.Errorf("wrong exported spans, got: %+v", &req)
+	}
+}
+
+func hasServiceName(attrs []*common.KeyValue, name string) bool {
+	for _, attr := range attrs {
+		if attr.Key == "service.name" && attr.Value.GetStringValue() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOTLPExporterReportsRejections(t *testing.T) {
+
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer server.Close()
+	exporter, _ := tracing.NewOTLPExporter(server.URL)
+
+	// when
+	err := exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{testSpan()})
+
+	// then
+	if err == nil {
+		t.Error("should have failed")
+	}
+}
+
+func TestOTLPExporterRejectsInvalidEndpoints(t *testing.T) {
+	if _, err := tracing.NewOTLPExporter("localhost:4318"); err == nil {
+		t.Error("should have failed without scheme")
+	}
+}
@@ -0,0 +1,120 @@
+// Package tracing provides distributed tracing with OpenTelemetry:
+// spans follow the W3C trace context of incoming requests and are exported in batches by the SDK,
+// to an OpenTelemetry collector over OTLP or as JSON lines to any writer.
+//
+// The current span travels in the context, so that code deeper in the call stack
+// starts child spans with Start without depending on a tracer. Without a span in
+// the context, Start returns a span that records nothing.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kind is the role of a span in a trace
+type Kind = trace.SpanKind
+
+// Span kinds
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+)
+
+// StatusCode is the outcome of a span
+type StatusCode = codes.Code
+
+// Span status codes
+const (
+	StatusUnset = codes.Unset
+	StatusOK    = codes.Ok
+	StatusError = codes.Error
+)
+
+// Attribute describes a span
+type Attribute = attribute.KeyValue
+
+// String creates a string attribute
+func String(key, value string) Attribute {
+	return attribute.String(key, value)
+}
+
+// Int creates an integer attribute
+func Int(key string, value int) Attribute {
+	return attribute.Int(key, value)
+}
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return attribute.Bool(key, value)
+}
+
+// Exporter sends batches of ended spans to a tracing backend
+type Exporter = sdktrace.SpanExporter
+
+// instrumentationName names the tracer of the application in exported spans
+const instrumentationName = "github.com/ehpalumbo/go-diff"
+
+// Tracer starts spans and exports them in batches once ended, from a background goroutine.
+// Spans ending while the queue is full are dropped rather than slowing requests down.
+// Tracers must be shut down to export the last spans.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewTracer creates a new Tracer exporting the spans of the named service with the exporter
+func NewTracer(exporter Exporter, serviceName string) *Tracer {
+	// merging a resource without schema never fails
+	res, _ := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return &Tracer{provider, provider.Tracer(instrumentationName)}
+}
+
+// Start starts a child of the current span of the context, if any, returning a copy of the context carrying it
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, Span{parent}
+	}
+	ctx, span := parent.TracerProvider().Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, Span{span}
+}
+
+// Start starts a span, returning a copy of the context carrying it.
+// The span continues the trace of the current span of the context, or else of the caller extracted into it,
+// and starts a new sampled trace otherwise. Spans of unsampled traces propagate the trace without recording.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, attrs ...Attribute) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	return ctx, Span{span}
+}
+
+// Flush exports the spans ended so far, waiting until they are exported or the context is done
+func (t *Tracer) Flush(ctx context.Context) error {
+	return t.provider.ForceFlush(ctx)
+}
+
+// Shutdown exports the spans ended so far and stops exporting, dropping spans ending later
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// Span is an operation within a trace. It is safe for concurrent use.
+type Span struct {
+	trace.Span
+}
+
+// SetError records the error and marks the span as failed because of it, unless it is nil
+func (s Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.RecordError(err)
+	s.SetStatus(codes.Error, err.Error())
+}
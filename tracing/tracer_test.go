@@ -0,0 +1,156 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ehpalumbo/go-diff/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func byName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	m := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		m[span.Name] = span
+	}
+	return m
+}
+
+func TestSpansFormATree(t *testing.T) {
+
+	// given
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter, "go-diff")
+	defer tracer.Shutdown(context.Background())
+
+	// when
+	ctx, root := tracer.Start(context.Background(), "GET /v1/diff/:id", tracing.KindServer, tracing.String("http.method", "GET"))
+	_, child := tracing.Start(ctx, "DiffService.GetDiffReport", tracing.String("diff.id", "1"))
+	child.SetError(errors.New("Oops!"))
+	child.End()
+	root.SetAttributes(tracing.Int("http.status_code", 500))
+	root.End()
+	tracer.Flush(context.Background())
+
+	// then
+	spans := byName(exporter)
+	server, internal := spans["GET /v1/diff/:id"], spans["DiffService.GetDiffReport"]
+	if len(spans) != 2 {
+		t.Fatalf("wrong spans, got: %+v", exporter.GetSpans())
+	}
+	if server.Parent.IsValid() || server.SpanKind != tracing.KindServer || len(server.Attributes) != 2 {
+		t.Errorf("wrong root span, got: %+v", server)
+	}
+	if server.Resource.String() == "" || !strings.Contains(server.Resource.String(), "service.name=go-diff") {
+		t.Errorf("wrong resource, got: %v", server.Resource)
+	}
+	if internal.SpanContext.TraceID() != server.SpanContext.TraceID() || internal.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("child span not in the trace of its parent, got: %+v", internal)
+	}
+	if internal.SpanKind != tracing.KindInternal || internal.Status.Code != tracing.StatusError || internal.Status.Description != "Oops!" {
+		t.Errorf("wrong child span, got: %+v", internal)
+	}
+	if internal.EndTime.Before(internal.StartTime) || server.EndTime.Before(internal.EndTime) {
+		t.Errorf("wrong span timing, got: %+v and %+v", server, internal)
+	}
+}
+
+func TestSpansContinueRemoteTrace(t *testing.T) {
+
+	cases := []struct {
+		name      string
+		sampled   string
+		recording bool
+	}{
+		{name: "sampled", sampled: "01", recording: true},
+		{name: "not sampled", sampled: "00", recording: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			// given
+			exporter := tracetest.NewInMemoryExporter()
+			tracer := tracing.NewTracer(exporter, "go-diff")
+			defer tracer.Shutdown(context.Background())
+			header := http.Header{}
+			header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-"+c.sampled)
+
+			// when
+			ctx, span := tracer.Start(tracing.Extract(context.Background(), header), "GET /", tracing.KindServer)
+			_, child := tracing.Start(ctx, "child")
+			recording := []bool{span.IsRecording(), child.IsRecording()}
+			child.End()
+			span.End()
+			tracer.Flush(context.Background())
+
+			// then
+			if recording[0] != c.recording || recording[1] != c.recording {
+				t.Errorf("wrong recording, expected: %v", c.recording)
+			}
+			if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("remote trace not continued, got: %v", span.SpanContext().TraceID())
+			}
+			if recorded := len(byName(exporter)); (recorded == 2) != c.recording {
+				t.Errorf("wrong recorded spans, got: %d", recorded)
+			}
+			if c.recording && byName(exporter)["GET /"].Parent.SpanID().String() != "00f067aa0ba902b7" {
+				t.Errorf("remote parent not recorded, got: %+v", byName(exporter)["GET /"])
+			}
+		})
+	}
+}
+
+func TestStartWithoutSpanRecordsNothing(t *testing.T) {
+
+	// when
+	ctx, span := tracing.Start(context.Background(), "orphan")
+	span.SetAttributes(tracing.Bool("ignored", true))
+	span.SetError(errors.New("Oops!"))
+	span.End()
+
+	// then
+	if span.IsRecording() || span.SpanContext().IsValid() || ctx != context.Background() {
+		t.Errorf("span should record nothing, got: %+v", span)
+	}
+}
+
+func TestFlushExportsEndedSpans(t *testing.T) {
+
+	// given
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter, "go-diff")
+	defer tracer.Shutdown(context.Background())
+	_, span := tracer.Start(context.Background(), "GET /", tracing.KindServer)
+	span.End()
+	span.End()
+
+	// when
+	err := tracer.Flush(context.Background())
+
+	// then
+	if spans := exporter.GetSpans(); err != nil || len(spans) != 1 {
+		t.Errorf("ended span not exported once, got: %v, %+v", err, spans)
+	}
+}
+
+func TestSpansEndingAfterShutdownAreDropped(t *testing.T) {
+
+	// given
+	var b strings.Builder
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&b), "go-diff")
+	_, span := tracer.Start(context.Background(), "GET /", tracing.KindServer)
+	tracer.Shutdown(context.Background())
+
+	// when
+	span.End()
+	tracer.Flush(context.Background())
+
+	// then
+	if b.Len() != 0 {
+		t.Errorf("span should have been dropped, got: %s", b.String())
+	}
+}